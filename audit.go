@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultAuditLogSize is how many word status changes the audit log keeps.
+const defaultAuditLogSize = 500
+
+// Audit record results.
+const (
+	auditResultOK      = "ok"
+	auditResultPartial = "partial"
+	auditResultError   = "error"
+	// auditResultQueued is a change saved locally whose push is waiting
+	// for the sync server.
+	auditResultQueued = "queued"
+)
+
+// AuditRecord is one word status change request and how it ended.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Client is the account's profile key, a hash of its email, never the
+	// API key.
+	Client   string           `json:"client"`
+	Items    []WordStatusItem `json:"items"`
+	Language string           `json:"language,omitempty"`
+	// KnownStatus and Tracked are the fields the change set; an unset one
+	// was left as it was.
+	KnownStatus *string             `json:"knownStatus,omitempty"`
+	Tracked     *bool               `json:"tracked,omitempty"`
+	Result      string              `json:"result"`
+	Failures    []WordStatusFailure `json:"failures,omitempty"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// auditLog keeps the most recent word status changes of this process in a
+// ring buffer, optionally appending each one as a JSON line to out as well.
+type auditLog struct {
+	mu      sync.Mutex
+	records []AuditRecord
+	next    int
+	full    bool
+	out     io.Writer
+}
+
+// newAuditLog returns a log holding the last size records. A size of 0
+// keeps none in memory, though records are still written to out.
+func newAuditLog(size int, out io.Writer) *auditLog {
+	return &auditLog{records: make([]AuditRecord, size), out: out}
+}
+
+// record adds a word status change. A failed write to out is returned but
+// the record is kept in memory regardless.
+func (l *auditLog) record(
+	client *MigakuClient,
+	items []WordStatusItem,
+	update wordStatusUpdate,
+	language string,
+	failures []WordStatusFailure,
+	err error,
+) error {
+	rec := AuditRecord{
+		Time:     time.Now().UTC(),
+		Items:    slices.Clone(items),
+		Language: language,
+		Tracked:  update.Tracked,
+		Failures: failures,
+		Result:   auditResultOK,
+	}
+	if client != nil {
+		rec.Client = client.key
+	}
+	if update.KnownStatus != nil {
+		status := strings.ToLower(*update.KnownStatus)
+		rec.KnownStatus = &status
+	}
+	switch {
+	case errors.Is(err, ErrSyncQueued):
+		rec.Result = auditResultQueued
+	case err != nil:
+		rec.Result = auditResultError
+		rec.Error = err.Error()
+	case len(failures) > 0:
+		rec.Result = auditResultPartial
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.records) > 0 {
+		l.records[l.next] = rec
+		l.next = (l.next + 1) % len(l.records)
+		l.full = l.full || l.next == 0
+	}
+	if l.out != nil {
+		return json.NewEncoder(l.out).Encode(rec)
+	}
+	return nil
+}
+
+// recent returns up to limit of the client's records, newest first. A
+// limit of 0 or less returns all of them.
+func (l *auditLog) recent(clientKey string, limit int) []AuditRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count := l.next
+	if l.full {
+		count = len(l.records)
+	}
+	out := []AuditRecord{}
+	for i := range count {
+		rec := l.records[(l.next-1-i+len(l.records))%len(l.records)]
+		if rec.Client != clientKey {
+			continue
+		}
+		out = append(out, rec)
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	return out
+}
+
+// RecentAudit returns the client's latest word status changes, newest first.
+func (s *MigakuService) RecentAudit(client *MigakuClient, limit int) []AuditRecord {
+	return s.audit.recent(client.key, limit)
+}
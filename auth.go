@@ -4,14 +4,20 @@ import (
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
+// Authentication uses a single scheme: logging in returns an API key that is
+// an HMAC of the credentials under API_SECRET, and that key identifies the
+// session in the X-Api-Key header. API_SECRET itself is never accepted as a
+// key; it only signs them.
+
 type clientContextKey int
 
 const requestClientKey clientContextKey = iota
@@ -24,17 +30,91 @@ func clientFromContext(ctx context.Context) (*MigakuClient, bool) {
 	return client, true
 }
 
+// deriveAPIKey derives the API key for new sessions from the primary secret.
 func (app *Application) deriveAPIKey(email, password string) (string, error) {
-	if app.secretKey == "" {
+	if len(app.secretKeys) == 0 || app.secretKeys[0] == "" {
 		return "", errors.New("API_SECRET not configured")
 	}
 
-	mac := hmac.New(sha256.New, []byte(app.secretKey))
+	return deriveAPIKeyWith(app.secretKeys[0], email, password), nil
+}
+
+func deriveAPIKeyWith(secret, email, password string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
 	_, _ = io.WriteString(mac, email)
 	_, _ = mac.Write([]byte{0})
 	_, _ = io.WriteString(mac, password)
 
-	return hex.EncodeToString(mac.Sum(nil)), nil
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// existingAPIKey returns the key of a live session for these credentials,
+// whichever of the configured secrets it was derived from, so a session
+// opened before a secret rotation is reused rather than duplicated.
+func (app *Application) existingAPIKey(email, password string) (string, bool) {
+	app.accountsMu.RLock()
+	defer app.accountsMu.RUnlock()
+	return app.existingAPIKeyLocked(email, password)
+}
+
+// existingAPIKeyLocked is existingAPIKey for a caller holding accountsMu.
+func (app *Application) existingAPIKeyLocked(email, password string) (string, bool) {
+	for _, secret := range app.secretKeys {
+		candidate := deriveAPIKeyWith(secret, email, password)
+		if _, ok := app.lookupAccountLocked(candidate); ok {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// addAccount stores db under apiKey. If a concurrent login for the same
+// account stored its client first, db is closed instead and the stored key
+// returned, so only one client per account ever runs.
+func (app *Application) addAccount(email, password, apiKey string, db *MigakuClient) (string, bool) {
+	app.accountsMu.Lock()
+	if existingKey, exists := app.existingAPIKeyLocked(email, password); exists {
+		app.accountsMu.Unlock()
+		db.Close()
+		return existingKey, false
+	}
+	app.accounts[apiKey] = db
+	app.accountsMu.Unlock()
+	return apiKey, true
+}
+
+// lookupAccount finds the client logged in under apiKey. Every stored key is
+// compared in constant time instead of indexing the map, so response timing
+// reveals nothing about how close a guessed key is to a real one.
+func (app *Application) lookupAccount(apiKey string) (*MigakuClient, bool) {
+	app.accountsMu.RLock()
+	defer app.accountsMu.RUnlock()
+	return app.lookupAccountLocked(apiKey)
+}
+
+// lookupAccountLocked is lookupAccount for a caller holding accountsMu.
+func (app *Application) lookupAccountLocked(apiKey string) (*MigakuClient, bool) {
+	var found *MigakuClient
+	for key, client := range app.accounts {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+			found = client
+		}
+	}
+	return found, found != nil
+}
+
+// warmCache fills the cache for a freshly logged-in account. It runs in the
+// background, detached from the login request, so the login answers first.
+func (app *Application) warmCache(client *MigakuClient) {
+	ctx, cancel := context.WithTimeout(context.Background(), backgroundRefreshTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := app.service.WarmCache(ctx, client); err != nil {
+		app.logger.Warn("Cache warm-up incomplete", "error", err)
+		return
+	}
+	app.logger.Info("Cache warmed", "duration", time.Since(start).String())
 }
 
 type loginRequest struct {
@@ -42,21 +122,30 @@ type loginRequest struct {
 	Password string `json:"password"`
 }
 
+func (req loginRequest) Valid(context.Context) map[string]string {
+	problems := make(map[string]string)
+	if strings.TrimSpace(req.Email) == "" {
+		problems["email"] = "is required"
+	}
+	if strings.TrimSpace(req.Password) == "" {
+		problems["password"] = "is required"
+	}
+	return problems
+}
+
 func (app *Application) handleLogin(w http.ResponseWriter, r *http.Request) {
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields()
-	var req loginRequest
-	if err := decoder.Decode(&req); err != nil {
-		app.writeJSONError(w, r, http.StatusBadRequest, "Invalid JSON")
+	req, problems, err := decodeValid[loginRequest](r)
+	if len(problems) > 0 {
+		app.writeValidationError(w, r, problems)
+		return
+	}
+	if err != nil {
+		app.writeError(w, r, decodeErrorStatus(err), err)
 		return
 	}
 
 	email := strings.TrimSpace(req.Email)
 	password := strings.TrimSpace(req.Password)
-	if email == "" || password == "" {
-		app.writeJSONError(w, r, http.StatusBadRequest, "Missing required fields")
-		return
-	}
 
 	apiKey, err := app.deriveAPIKey(email, password)
 	if err != nil {
@@ -64,13 +153,8 @@ func (app *Application) handleLogin(w http.ResponseWriter, r *http.Request) {
 		app.writeJSONError(w, r, http.StatusInternalServerError, "Server misconfigured")
 		return
 	}
-	if _, exists := app.accounts[apiKey]; exists {
-		if err := encode(w, r, http.StatusOK, map[string]string{
-			"api_key": apiKey,
-			"message": "Already logged in",
-		}); err != nil {
-			app.logger.Error("Failed to encode JSON response", "error", err)
-		}
+	if existingKey, exists := app.existingAPIKey(email, password); exists {
+		app.respondAlreadyLoggedIn(w, r, existingKey)
 		return
 	}
 
@@ -79,15 +163,42 @@ func (app *Application) handleLogin(w http.ResponseWriter, r *http.Request) {
 		app.logger,
 		email,
 		password,
-		app.cache.ttl,
+		app.refreshTTL,
+		app.loginTimeout,
 	)
 	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			app.logger.Info("Login rejected: invalid credentials")
+			app.writeJSONError(w, r, http.StatusUnauthorized, "Invalid email or password")
+			return
+		}
 		app.logger.Error("Failed to initialize client", "error", err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			app.writeJSONError(w, r, http.StatusGatewayTimeout, "Login timed out")
+			return
+		}
 		app.writeJSONError(w, r, http.StatusInternalServerError, "Failed to initialize client")
 		return
 	}
 
-	app.accounts[apiKey] = db
+	// Another login for this account may have finished while this one was
+	// downloading; keep whichever client was stored first.
+	if existingKey, added := app.addAccount(email, password, apiKey, db); !added {
+		app.respondAlreadyLoggedIn(w, r, existingKey)
+		return
+	}
+
+	if validation, err := app.service.ValidateSchema(r.Context(), db); err != nil {
+		app.logger.Warn("Failed to validate database schema", "error", err)
+	} else if !validation.Valid {
+		app.logger.Warn("Database schema changed; some queries may fail",
+			"missing_tables", validation.MissingTables,
+			"missing_columns", validation.MissingColumns,
+		)
+	}
+	if app.warmCacheOnLogin {
+		go app.warmCache(db)
+	}
 	if err := encode(w, r, http.StatusOK, map[string]string{
 		"api_key": apiKey,
 		"message": "Login successful",
@@ -96,6 +207,15 @@ func (app *Application) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (app *Application) respondAlreadyLoggedIn(w http.ResponseWriter, r *http.Request, apiKey string) {
+	if err := encode(w, r, http.StatusOK, map[string]string{
+		"api_key": apiKey,
+		"message": "Already logged in",
+	}); err != nil {
+		app.logger.Error("Failed to encode JSON response", "error", err)
+	}
+}
+
 func (app *Application) handleLogout(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		app.writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
@@ -108,17 +228,17 @@ func (app *Application) handleLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, exists := app.accounts[apiKey]
-	if !exists || db == nil {
+	db, exists := app.lookupAccount(apiKey)
+	if !exists {
 		app.writeJSONError(w, r, http.StatusUnauthorized, "Not logged in")
 		return
 	}
 
-	if db.cleanUp != nil {
-		db.cleanUp()
-	}
+	db.Close()
 
+	app.accountsMu.Lock()
 	delete(app.accounts, apiKey)
+	app.accountsMu.Unlock()
 	if err := encode(w, r, http.StatusOK, map[string]string{
 		"message": "Logout successful",
 	}); err != nil {
@@ -126,6 +246,10 @@ func (app *Application) handleLogout(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// authMiddleware resolves the X-Api-Key header to a logged-in client. It is
+// the only auth check in the server and guards /auth/logout, every /api/v1
+// route and the /dev/database routes; /dev/status and /dev/cache/clear are
+// left open.
 func (app *Application) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		apiKey := r.Header.Get("X-Api-Key")
@@ -134,8 +258,8 @@ func (app *Application) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		client, exists := app.accounts[apiKey]
-		if !exists || client == nil {
+		client, exists := app.lookupAccount(apiKey)
+		if !exists {
 			app.writeJSONError(w, r, http.StatusUnauthorized, "Invalid or expired API key")
 			return
 		}
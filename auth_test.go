@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	app := newTestApp(t)
+	client := newTestClient(t)
+	apiKey := deriveAPIKeyWith(app.secretKeys[0], "user@example.com", "password")
+	app.accounts[apiKey] = client
+	app.accounts[deriveAPIKeyWith(app.secretKeys[0], "other@example.com", "password")] = newTestClient(t)
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		wantStatus int
+	}{
+		{"matching key", apiKey, http.StatusOK},
+		{"missing key", "", http.StatusUnauthorized},
+		{"unknown key", deriveAPIKeyWith(app.secretKeys[0], "nobody@example.com", "password"), http.StatusUnauthorized},
+		{"key prefix", apiKey[:len(apiKey)-1], http.StatusUnauthorized},
+		{"key with extra byte", apiKey + "0", http.StatusUnauthorized},
+		{"key differing in the last byte", apiKey[:len(apiKey)-1] + "x", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *MigakuClient
+			handler := app.authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = clientFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/words", nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-Api-Key", tt.apiKey)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && got != client {
+				t.Errorf("handler got client %p, want the one logged in under the key (%p)", got, client)
+			}
+		})
+	}
+}
+
+func TestExistingAPIKeyAfterRotation(t *testing.T) {
+	app := newTestApp(t)
+	oldKey := deriveAPIKeyWith("old-secret", "user@example.com", "password")
+	app.accounts[oldKey] = newTestClient(t)
+	app.secretKeys = []string{"new-secret", "old-secret"}
+
+	got, ok := app.existingAPIKey("user@example.com", "password")
+	if !ok || got != oldKey {
+		t.Errorf("existingAPIKey = %q, %v; want the key derived from the old secret", got, ok)
+	}
+	if _, ok := app.existingAPIKey("user@example.com", "wrong"); ok {
+		t.Error("existingAPIKey found a session for the wrong password")
+	}
+}
+
+// TestAccountsConcurrentAccess logs accounts out while readiness checks and
+// authenticated requests read the accounts map; run it with -race.
+func TestAccountsConcurrentAccess(t *testing.T) {
+	app := newTestApp(t)
+	var keys []string
+	for i := range 8 {
+		key := deriveAPIKeyWith(app.secretKeys[0], fmt.Sprintf("user%d@example.com", i), "password")
+		app.accounts[key] = newTestClient(t)
+		keys = append(keys, key)
+	}
+
+	auth := app.authMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Go(func() {
+			req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+			req.Header.Set("X-Api-Key", key)
+			app.handleLogout(httptest.NewRecorder(), req)
+		})
+		wg.Go(func() {
+			app.handleReadyz(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		})
+		wg.Go(func() {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/words", nil)
+			req.Header.Set("X-Api-Key", key)
+			auth(httptest.NewRecorder(), req)
+		})
+	}
+	wg.Wait()
+
+	app.accountsMu.RLock()
+	if len(app.accounts) != 0 {
+		t.Errorf("%d accounts left after logging every one out", len(app.accounts))
+	}
+	app.accountsMu.RUnlock()
+
+	// Logins for one account that finish together keep the first client
+	// and close the rest.
+	const logins = 8
+	apiKey := deriveAPIKeyWith(app.secretKeys[0], "same@example.com", "password")
+	var closed atomic.Int32
+	clients := make([]*MigakuClient, logins)
+	for i := range clients {
+		clients[i] = newTestClient(t)
+		clients[i].cleanUp = func() { closed.Add(1) }
+	}
+	keys = make([]string, logins)
+	added := make([]bool, logins)
+	for i, client := range clients {
+		wg.Go(func() {
+			keys[i], added[i] = app.addAccount("same@example.com", "password", apiKey, client)
+		})
+	}
+	wg.Wait()
+
+	winners := 0
+	for i := range clients {
+		if keys[i] != apiKey {
+			t.Errorf("login %d got key %s, want %s", i, keys[i], apiKey)
+		}
+		if added[i] {
+			winners++
+			if stored, _ := app.lookupAccount(apiKey); stored != clients[i] {
+				t.Errorf("login %d was added but another client is stored", i)
+			}
+		}
+	}
+	if winners != 1 {
+		t.Errorf("%d logins stored a client, want 1", winners)
+	}
+	if got := closed.Load(); got != logins-1 {
+		t.Errorf("%d duplicate clients closed, want %d", got, logins-1)
+	}
+	app.accountsMu.RLock()
+	defer app.accountsMu.RUnlock()
+	if len(app.accounts) != 1 {
+		t.Errorf("%d accounts after concurrent logins for one account, want 1", len(app.accounts))
+	}
+}
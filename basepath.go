@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// normalizeBasePath turns a BASE_PATH value into "" (mounted at the root) or
+// "/segment[/segment...]" without a trailing slash.
+func normalizeBasePath(basePath string) (string, error) {
+	basePath = strings.Trim(strings.TrimSpace(basePath), "/")
+	if basePath == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(basePath, "?#%\\ ") {
+		return "", errors.New("must be a plain URL path like /migoku")
+	}
+	for segment := range strings.SplitSeq(basePath, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", errors.New("must not contain empty, . or .. segments")
+		}
+	}
+	return "/" + basePath, nil
+}
+
+// mountBasePath serves handler under basePath, stripping the prefix so
+// routes keep their root-relative patterns. The probes stay reachable at the
+// root as well, since orchestrators usually hit the container directly
+// rather than through the proxy that owns the sub-path.
+func mountBasePath(basePath string, handler http.Handler, probes map[string]http.HandlerFunc) http.Handler {
+	if basePath == "" {
+		return handler
+	}
+
+	outer := http.NewServeMux()
+	for pattern, probe := range probes {
+		outer.HandleFunc(pattern, probe)
+	}
+	// The subtree pattern also redirects a bare basePath to basePath + "/".
+	outer.Handle(basePath+"/", http.StripPrefix(basePath, handler))
+	return outer
+}
+
+// withServerURL replaces the top-level servers list of an OpenAPI document
+// with a single entry for url, so "Try it out" in the docs targets the
+// sub-path the API is mounted on.
+func withServerURL(spec []byte, url string) []byte {
+	lines := bytes.SplitAfter(spec, []byte("\n"))
+	var out bytes.Buffer
+	inServers := false
+	for _, line := range lines {
+		switch {
+		case bytes.HasPrefix(line, []byte("servers:")):
+			inServers = true
+			out.WriteString("servers:\n  - url: " + url + "\n    description: This server\n")
+			continue
+		case inServers && len(bytes.TrimSpace(line)) > 0 && line[0] != ' ' && line[0] != '-':
+			inServers = false
+		}
+		if !inServers {
+			out.Write(line)
+		}
+	}
+	return out.Bytes()
+}
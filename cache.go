@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log/slog"
 	"sync"
 	"time"
@@ -61,6 +62,49 @@ func (c *Cache) Set(key string, value any) {
 	slog.Default().Debug("Cache set", "key", key, "ttl", c.ttl.String())
 }
 
+// SetWithTTL stores value with its own ttl, capped at the cache-wide ttl,
+// for data that goes stale faster than everything else.
+func (c *Cache) SetWithTTL(key string, value any, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ttl = min(ttl, c.ttl)
+	c.cache[key] = &CacheEntry{
+		Data:      value,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	slog.Default().Debug("Cache set", "key", key, "ttl", ttl.String())
+}
+
+// CacheGet returns the entry under key as a T. An entry of any other type
+// is logged and reported as a miss. This is a runtime guard only: nothing
+// ties a key to the type stored under it at compile time, so a getter and
+// setter that disagree on T just never hit the cache.
+func CacheGet[T any](c *Cache, key string) (T, bool) {
+	var zero T
+	data, ok := c.Get(key)
+	if !ok {
+		return zero, false
+	}
+	value, ok := data.(T)
+	if !ok {
+		slog.Default().Warn("Cache type mismatch", "key", key, "type", fmt.Sprintf("%T", data))
+		return zero, false
+	}
+	return value, true
+}
+
+// CacheSet stores value under key; pair it with CacheGet of the same T, which
+// the compiler doesn't check.
+func CacheSet[T any](c *Cache, key string, value T) {
+	c.Set(key, value)
+}
+
+// CacheSetWithTTL is the typed counterpart of Cache.SetWithTTL.
+func CacheSetWithTTL[T any](c *Cache, key string, value T, ttl time.Duration) {
+	c.SetWithTTL(key, value, ttl)
+}
+
 func (c *Cache) Clear() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
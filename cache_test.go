@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheGetTyped(t *testing.T) {
+	c := NewCache(time.Minute)
+	CacheSet(c, "words", []Word{{DictForm: "本"}})
+
+	words, ok := CacheGet[[]Word](c, "words")
+	if !ok || len(words) != 1 || words[0].DictForm != "本" {
+		t.Fatalf("CacheGet[[]Word] = %v, %v; want the stored words", words, ok)
+	}
+
+	// A getter that asks for another type misses rather than panicking.
+	if got, ok := CacheGet[*StudyStats](c, "words"); ok || got != nil {
+		t.Errorf("CacheGet[*StudyStats] on []Word = %v, %v; want a miss", got, ok)
+	}
+	if got, ok := CacheGet[[]Deck](c, "words"); ok || got != nil {
+		t.Errorf("CacheGet[[]Deck] on []Word = %v, %v; want a miss", got, ok)
+	}
+	if _, ok := CacheGet[[]Word](c, "missing"); ok {
+		t.Error("CacheGet hit a key that was never set")
+	}
+
+	CacheSetWithTTL(c, "short", 42, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok := CacheGet[int](c, "short"); ok {
+		t.Error("CacheGet returned an expired entry")
+	}
+}
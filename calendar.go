@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migakuEpoch is day 0 of Migaku's day numbering (card.due, review.day).
+var migakuEpoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// dayNumber returns the Migaku day number of t's calendar date in loc.
+// The calendar date is projected onto UTC before subtracting, so DST
+// transitions in loc never make a day shorter or longer than 24 hours.
+func dayNumber(t time.Time, loc *time.Location) int {
+	y, m, d := t.In(loc).Date()
+	date := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return int(date.Sub(migakuEpoch) / (24 * time.Hour))
+}
+
+// dayStart returns midnight in loc of the given Migaku day number.
+func dayStart(day int, loc *time.Location) time.Time {
+	return time.Date(migakuEpoch.Year(), migakuEpoch.Month(), migakuEpoch.Day()+day, 0, 0, 0, 0, loc)
+}
+
+// startOfDay truncates t to midnight of its calendar date in loc.
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// daysAgo returns the day number of the calendar date days before today in loc.
+func daysAgo(days int, loc *time.Location) int {
+	return dayNumber(time.Now(), loc) - days
+}
+
+// periodFormats lists the stats periods parsePeriod accepts, for messages.
+const periodFormats = `"All time", "N Month(s)" or "N Year(s)" with N >= 1, e.g. "6 Months"`
+
+// ErrInvalidPeriod is returned for a stats period that isn't one of
+// periodFormats.
+var ErrInvalidPeriod = errors.New("invalid period")
+
+var periodPattern = regexp.MustCompile(`(?i)^(\d+)\s*(months?|years?)$`)
+
+// parsePeriod parses a stats period such as "1 Month", "6 Months" or
+// "2 Years" into a number of months. allTime is set for "All time", in
+// which case months is 0.
+func parsePeriod(periodID string) (months int, allTime bool, err error) {
+	periodID = strings.TrimSpace(periodID)
+	if strings.EqualFold(periodID, periodAllTime) {
+		return 0, true, nil
+	}
+	m := periodPattern.FindStringSubmatch(periodID)
+	if m == nil {
+		return 0, false, fmt.Errorf("%w: %q; use %s", ErrInvalidPeriod, periodID, periodFormats)
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n <= 0 {
+		return 0, false, fmt.Errorf("%w: %q; use %s", ErrInvalidPeriod, periodID, periodFormats)
+	}
+	if strings.HasPrefix(strings.ToLower(m[2]), "year") {
+		n *= 12
+	}
+	return n, false, nil
+}
+
+// maxDateRangeDays caps an explicit from/to stats window at about ten years,
+// the same horizon as an "All time" due forecast.
+const maxDateRangeDays = 3650
+
+// ErrInvalidDateRange is returned for from/to dates that don't parse, are
+// given one without the other, or run backwards.
+var ErrInvalidDateRange = errors.New("invalid date range")
+
+// DayRange is an inclusive span of Migaku day numbers picked with explicit
+// from/to dates. It takes the place of a named stats period.
+type DayRange struct {
+	From int
+	To   int
+}
+
+// Days is the number of days the range covers.
+func (dr DayRange) Days() int {
+	return dr.To - dr.From + 1
+}
+
+// String formats the range for cache keys and logs.
+func (dr DayRange) String() string {
+	return dayStart(dr.From, time.UTC).Format(windowDateLayout) + ".." +
+		dayStart(dr.To, time.UTC).Format(windowDateLayout)
+}
+
+// rangeKey is the cache-key part for an optional range, empty when unset.
+func rangeKey(dr *DayRange) string {
+	if dr == nil {
+		return ""
+	}
+	return dr.String()
+}
+
+// parseDateRange parses from and to as YYYY-MM-DD calendar dates. It returns
+// nil when neither is set, so the caller falls back to its period. A day
+// number only depends on the calendar date, so no timezone is needed here.
+func parseDateRange(from, to string) (*DayRange, error) {
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if from == "" && to == "" {
+		return nil, nil
+	}
+	if from == "" || to == "" {
+		return nil, fmt.Errorf("%w: from and to must be given together", ErrInvalidDateRange)
+	}
+	fromDate, err := time.Parse(windowDateLayout, from)
+	if err != nil {
+		return nil, fmt.Errorf("%w: from must be a date in YYYY-MM-DD form", ErrInvalidDateRange)
+	}
+	toDate, err := time.Parse(windowDateLayout, to)
+	if err != nil {
+		return nil, fmt.Errorf("%w: to must be a date in YYYY-MM-DD form", ErrInvalidDateRange)
+	}
+	dr := DayRange{From: dayNumber(fromDate, time.UTC), To: dayNumber(toDate, time.UTC)}
+	if dr.From > dr.To {
+		return nil, fmt.Errorf("%w: from must not be after to", ErrInvalidDateRange)
+	}
+	if dr.Days() > maxDateRangeDays {
+		return nil, fmt.Errorf("%w: a range may span at most %d days", ErrInvalidDateRange, maxDateRangeDays)
+	}
+	return &dr, nil
+}
+
+// ErrInvalidToday is returned for a today override that isn't a date.
+var ErrInvalidToday = errors.New("invalid today")
+
+// parseToday parses a today override (YYYY-MM-DD), which stands in for the
+// current date in stats windows and forecasts. It returns the zero time
+// when unset; the date is at UTC midnight and only its calendar date counts.
+func parseToday(today string) (time.Time, error) {
+	today = strings.TrimSpace(today)
+	if today == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(windowDateLayout, today)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %q is not a date in YYYY-MM-DD form", ErrInvalidToday, today)
+	}
+	return t, nil
+}
+
+// todayKey is the cache-key part for an optional today override.
+func todayKey(today time.Time) string {
+	if today.IsZero() {
+		return ""
+	}
+	return today.Format(windowDateLayout)
+}
+
+// Stats granularities: how many days each bucket of a day-based series
+// covers. Weeks start on Monday.
+const (
+	granularityDay   = "day"
+	granularityWeek  = "week"
+	granularityMonth = "month"
+)
+
+// ErrInvalidGranularity is returned for a granularity other than day, week
+// or month.
+var ErrInvalidGranularity = errors.New("granularity must be one of: day, week, month")
+
+// parseGranularity validates a granularity, defaulting an empty one to day.
+func parseGranularity(granularity string) (string, error) {
+	switch g := strings.ToLower(strings.TrimSpace(granularity)); g {
+	case "":
+		return granularityDay, nil
+	case granularityDay, granularityWeek, granularityMonth:
+		return g, nil
+	default:
+		return "", ErrInvalidGranularity
+	}
+}
+
+// bucketStart returns the day number of the first day of the week or month
+// holding day.
+func bucketStart(day int, granularity string, loc *time.Location) int {
+	t := dayStart(day, loc)
+	switch granularity {
+	case granularityWeek:
+		return day - (int(t.Weekday())+6)%7
+	case granularityMonth:
+		return day - t.Day() + 1
+	default:
+		return day
+	}
+}
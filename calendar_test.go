@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("load %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestDayNumber(t *testing.T) {
+	// Day numbers of the calendar dates used below, counted by hand from
+	// 2020-01-01 (day 0).
+	const (
+		mar9_2024  = 1529
+		mar10_2024 = 1530
+		mar31_2024 = 1551
+		oct27_2024 = 1761
+		nov3_2024  = 1768
+	)
+
+	tests := []struct {
+		name string
+		loc  string
+		time func(loc *time.Location) time.Time
+		want int
+	}{
+		{"epoch", "UTC", func(loc *time.Location) time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, loc) }, 0},
+		{"day before epoch", "UTC", func(loc *time.Location) time.Time { return time.Date(2019, 12, 31, 23, 59, 0, 0, loc) }, -1},
+
+		// US spring forward: 2024-03-10 02:00 EST jumps to 03:00 EDT.
+		{"US spring forward 00:00", "America/New_York", localTime(2024, 3, 10, 0, 0), mar10_2024},
+		{"US spring forward 00:30", "America/New_York", localTime(2024, 3, 10, 0, 30), mar10_2024},
+		{"US spring forward 01:59", "America/New_York", localTime(2024, 3, 10, 1, 59), mar10_2024},
+		{"US spring forward 03:00", "America/New_York", localTime(2024, 3, 10, 3, 0), mar10_2024},
+		{"US spring forward 23:59", "America/New_York", localTime(2024, 3, 10, 23, 59), mar10_2024},
+		{"US day before spring forward 23:59", "America/New_York", localTime(2024, 3, 9, 23, 59), mar9_2024},
+		{"US spring forward as UTC instant", "America/New_York", func(*time.Location) time.Time {
+			return time.Date(2024, 3, 10, 4, 59, 0, 0, time.UTC) // 23:59 EST on the 9th
+		}, mar9_2024},
+
+		// US fall back: 2024-11-03 02:00 EDT falls back to 01:00 EST.
+		{"US fall back 00:00", "America/New_York", localTime(2024, 11, 3, 0, 0), nov3_2024},
+		{"US fall back 00:30", "America/New_York", localTime(2024, 11, 3, 0, 30), nov3_2024},
+		{"US fall back 01:30", "America/New_York", localTime(2024, 11, 3, 1, 30), nov3_2024},
+		{"US fall back second 01:30", "America/New_York", func(*time.Location) time.Time {
+			return time.Date(2024, 11, 3, 6, 30, 0, 0, time.UTC) // 01:30 EST
+		}, nov3_2024},
+		{"US fall back 23:59", "America/New_York", localTime(2024, 11, 3, 23, 59), nov3_2024},
+
+		// EU spring forward: 2024-03-31 02:00 CET jumps to 03:00 CEST.
+		{"EU spring forward 00:00", "Europe/Berlin", localTime(2024, 3, 31, 0, 0), mar31_2024},
+		{"EU spring forward 00:30", "Europe/Berlin", localTime(2024, 3, 31, 0, 30), mar31_2024},
+		{"EU spring forward 23:59", "Europe/Berlin", localTime(2024, 3, 31, 23, 59), mar31_2024},
+
+		// EU fall back: 2024-10-27 03:00 CEST falls back to 02:00 CET.
+		{"EU fall back 00:00", "Europe/Berlin", localTime(2024, 10, 27, 0, 0), oct27_2024},
+		{"EU fall back 00:30", "Europe/Berlin", localTime(2024, 10, 27, 0, 30), oct27_2024},
+		{"EU fall back 23:59", "Europe/Berlin", localTime(2024, 10, 27, 23, 59), oct27_2024},
+
+		// The extremes of the UTC offsets, where the local date is a day
+		// ahead of or behind UTC for most of the day.
+		{"UTC+14 00:00", "Pacific/Kiritimati", localTime(2024, 3, 10, 0, 0), mar10_2024},
+		{"UTC+14 00:30", "Pacific/Kiritimati", localTime(2024, 3, 10, 0, 30), mar10_2024},
+		{"UTC+14 23:59", "Pacific/Kiritimati", localTime(2024, 3, 10, 23, 59), mar10_2024},
+		{"UTC+14 from UTC instant", "Pacific/Kiritimati", func(*time.Location) time.Time {
+			return time.Date(2024, 3, 9, 10, 0, 0, 0, time.UTC) // 00:00 on the 10th
+		}, mar10_2024},
+		{"UTC-11 00:00", "Pacific/Pago_Pago", localTime(2024, 3, 10, 0, 0), mar10_2024},
+		{"UTC-11 00:30", "Pacific/Pago_Pago", localTime(2024, 3, 10, 0, 30), mar10_2024},
+		{"UTC-11 23:59", "Pacific/Pago_Pago", localTime(2024, 3, 10, 23, 59), mar10_2024},
+		{"UTC-11 from UTC instant", "Pacific/Pago_Pago", func(*time.Location) time.Time {
+			return time.Date(2024, 3, 11, 10, 59, 0, 0, time.UTC) // 23:59 on the 10th
+		}, mar10_2024},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := mustLoadLocation(t, tt.loc)
+			if got := dayNumber(tt.time(loc), loc); got != tt.want {
+				t.Errorf("dayNumber(%s) = %d, want %d", tt.time(loc).In(loc), got, tt.want)
+			}
+		})
+	}
+}
+
+func localTime(year int, month time.Month, day, hour, minute int) func(*time.Location) time.Time {
+	return func(loc *time.Location) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, loc)
+	}
+}
+
+func TestDayStartRoundTrip(t *testing.T) {
+	for _, name := range []string{"UTC", "America/New_York", "Europe/Berlin", "Pacific/Kiritimati", "Pacific/Pago_Pago"} {
+		loc := mustLoadLocation(t, name)
+		// Every day of 2024, which takes in both DST transitions.
+		for day := 1461; day < 1461+366; day++ {
+			start := dayStart(day, loc)
+			if got := dayNumber(start, loc); got != day {
+				t.Fatalf("%s: dayNumber(dayStart(%d)) = %d", name, day, got)
+			}
+			if got := dayNumber(start.Add(-time.Minute), loc); got != day-1 {
+				t.Fatalf("%s: the minute before day %d starts is on day %d", name, day, got)
+			}
+		}
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		in         string
+		wantMonths int
+		wantAll    bool
+		wantErr    bool
+	}{
+		{"1 Month", 1, false, false},
+		{"1 month", 1, false, false},
+		{"1 Months", 1, false, false},
+		{"3 Months", 3, false, false},
+		{"3 MONTHS", 3, false, false},
+		{"6months", 6, false, false},
+		{"1 Year", 12, false, false},
+		{"2 years", 24, false, false},
+		{"All time", 0, true, false},
+		{"all TIME", 0, true, false},
+		{"  3 Months  ", 3, false, false},
+		{"\t2 Years\n", 24, false, false},
+		{"  All time ", 0, true, false},
+		{"0 months", 0, false, true},
+		{"0 Years", 0, false, true},
+		{"-1 months", 0, false, true},
+		{"-2 Years", 0, false, true},
+		{"", 0, false, true},
+		{"   ", 0, false, true},
+		{"Months", 0, false, true},
+		{"3", 0, false, true},
+		{"1 week", 0, false, true},
+		{"1.5 Months", 0, false, true},
+		{"3 Months ago", 0, false, true},
+		{"Alltime", 0, false, true},
+		{"99999999999999999999 Months", 0, false, true},
+		{"garbage", 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			months, allTime, err := parsePeriod(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidPeriod) {
+					t.Fatalf("parsePeriod(%q) error = %v, want ErrInvalidPeriod", tt.in, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePeriod(%q): %v", tt.in, err)
+			}
+			if months != tt.wantMonths || allTime != tt.wantAll {
+				t.Errorf("parsePeriod(%q) = %d, %v; want %d, %v", tt.in, months, allTime, tt.wantMonths, tt.wantAll)
+			}
+		})
+	}
+}
@@ -2,13 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -20,18 +26,123 @@ type MigakuClient struct {
 	logger  *slog.Logger
 	session *MigakuSession
 	db      *sqlx.DB
+	// writeDB is a second connection to the same snapshot used only by
+	// runWriteQuery, so local status updates don't queue behind reads on db.
+	writeDB *sqlx.DB
 	dbPath  string
 	cleanUp func()
 	key     string
 
-	lastRefresh time.Time
-	refreshTTL  time.Duration
-	refreshWg   sync.WaitGroup
-	refreshStop context.CancelFunc
+	lastRefresh        time.Time
+	lastRefreshAttempt time.Time
+	lastRefreshErr     error
+	refreshTTL         time.Duration
+	refreshWg          sync.WaitGroup
+	refreshStop        context.CancelFunc
+	closeOnce          sync.Once
+
+	refreshMu  sync.Mutex
+	refreshing *refreshCall
+	// refreshNow asks the refresh loop for an immediate download; it holds
+	// at most one pending request.
+	refreshNow chan struct{}
+
+	// localWrites counts successful local writes, which change the data
+	// without a refresh.
+	localWrites atomic.Uint64
+
+	// pending holds word status changes applied locally but not yet pushed,
+	// oldest first. flushMu keeps two flushes from pushing the same change.
+	pendingMu sync.Mutex
+	pending   []pendingSync
+	flushMu   sync.Mutex
 }
 
+// refreshCall is a db refresh in progress that concurrent callers wait on
+// instead of starting downloads of their own.
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+// backgroundRefreshTimeout bounds a single background refresh so a hung
+// download cannot stall the refresh loop indefinitely.
+const backgroundRefreshTimeout = 5 * time.Minute
+
+// defaultDownloadConcurrency is how many snapshot downloads may run at once
+// across all accounts unless MAX_CONCURRENT_DOWNLOADS says otherwise.
+const defaultDownloadConcurrency = 4
+
+// downloadSlots bounds concurrent snapshot downloads server-wide, so accounts
+// whose refreshes line up on the same TTL don't all download at once. nil
+// means unlimited. It is set once at startup.
+var downloadSlots = make(chan struct{}, defaultDownloadConcurrency)
+
+// configureDownloadConcurrency allows n snapshot downloads at once; zero
+// lifts the limit.
+func configureDownloadConcurrency(n int) {
+	if n <= 0 {
+		downloadSlots = nil
+		return
+	}
+	downloadSlots = make(chan struct{}, n)
+}
+
+// acquireDownloadSlot waits for a free download slot, giving up when ctx
+// ends. The returned func gives the slot back.
+func acquireDownloadSlot(ctx context.Context) (func(), error) {
+	if downloadSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case downloadSlots <- struct{}{}:
+		return func() { <-downloadSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// defaultRefreshJitter is the fraction of the TTL by which each refresh
+// interval is randomly shifted unless REFRESH_JITTER says otherwise.
+const defaultRefreshJitter = 0.1
+
+// refreshJitter spreads refreshes of clients created together, so they don't
+// all download on the same tick. It is set once at startup.
+var refreshJitter = defaultRefreshJitter
+
+// configureRefreshJitter sets the jitter fraction; it must be in [0, 1).
+func configureRefreshJitter(fraction float64) error {
+	if fraction < 0 || fraction >= 1 {
+		return fmt.Errorf("jitter %v must be at least 0 and below 1", fraction)
+	}
+	refreshJitter = fraction
+	return nil
+}
+
+// minRefreshTTL is the shortest REFRESH_TTL accepted. Each refresh
+// downloads the account's whole database, so a few seconds would hammer
+// Migaku for no real gain in freshness.
+const minRefreshTTL = time.Minute
+
+// jitteredInterval returns ttl moved by a random amount of up to
+// ±refreshJitter of it.
+func jitteredInterval(ttl time.Duration) time.Duration {
+	if refreshJitter == 0 {
+		return ttl
+	}
+	spread := float64(ttl) * refreshJitter
+	//nolint:gosec // Scheduling jitter, not a secret.
+	return ttl + time.Duration((rand.Float64()*2-1)*spread)
+}
+
+// ErrDBNotReady is returned by reads while the local snapshot is missing and a
+// download has been requested in the background.
+var ErrDBNotReady = errors.New("local database is not ready")
+
 // NewMigakuClient initializes an API session and downloads the Migaku SRS database.
 // It returns an error if login fails or if the database cannot be fetched.
+// A positive loginTimeout bounds the whole login: authentication and the
+// initial database download.
 //
 //nolint:contextcheck // background refresh loop not tied to request context
 func NewMigakuClient(
@@ -39,19 +150,27 @@ func NewMigakuClient(
 	logger *slog.Logger,
 	email, password string,
 	ttl time.Duration,
+	loginTimeout time.Duration,
 ) (c *MigakuClient, err error) {
 	defer func() {
 		if err != nil && c != nil {
 			c.Close()
+			c = nil
 		}
 	}()
 
+	if loginTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, loginTimeout)
+		defer cancel()
+	}
+
 	authToken, err := TryFromEmailPassword(ctx, email, password)
 	if err != nil {
 		return nil, err
 	}
 	if authToken == nil {
-		return nil, errors.New("login failed: invalid credentials")
+		return nil, ErrInvalidCredentials
 	}
 
 	logger.Debug("Auth token acquired")
@@ -61,50 +180,154 @@ func NewMigakuClient(
 		logger:     logger,
 		session:    session,
 		refreshTTL: ttl,
+		refreshNow: make(chan struct{}, 1),
 	}
 
-	dbDir := filepath.Join(os.TempDir(), "migoku-db")
+	dbDir := localDBDir()
 	if err = os.MkdirAll(dbDir, os.ModePerm); err != nil {
 		c.logger.Error("failed to create temp db dir", "error", err)
-		return nil, err
+		return c, err
 	}
 
 	key := hashProfileDirKey(email)
 	c.key = key
 	c.dbPath = filepath.Join(dbDir, "migaku-"+key+".db")
 	c.logger.Debug("Using local db path", "path", c.dbPath)
-	if err = c.refreshDB(ctx); err != nil {
-		return nil, err
-	}
-
-	if ttl > 0 {
-		refreshCtx, refreshStop := context.WithCancel(context.Background())
-		c.refreshStop = refreshStop
-		c.refreshWg.Go(func() {
-			ticker := time.NewTicker(ttl)
-			defer ticker.Stop()
-			for {
-				select {
-				case <-ticker.C:
-					if err := c.refreshDBIfStale(refreshCtx, ttl); err != nil {
-						c.logger.Error("failed to refresh db", "error", err)
-					}
-				case <-refreshCtx.Done():
-					c.logger.Debug("Stopping refresh loop")
-					return
-				}
-			}
-		})
-	}
-
+	acquireDBPath(c.dbPath)
 	c.cleanUp = func() {
 		c.closeDB()
+		if releaseDBPath(c.dbPath) {
+			c.removeDBFiles()
+		}
 	}
+	if err = c.refreshDB(ctx); err != nil {
+		return c, err
+	}
+
+	// The loop runs even without a ttl so requestRefresh has somewhere to go.
+	refreshCtx, refreshStop := context.WithCancel(context.Background())
+	c.refreshStop = refreshStop
+	c.refreshWg.Go(func() {
+		// A timer rather than a ticker, so each interval gets its own jitter.
+		var timer *time.Timer
+		var tick <-chan time.Time
+		if ttl > 0 {
+			timer = time.NewTimer(jitteredInterval(ttl))
+			defer timer.Stop()
+			tick = timer.C
+		}
+		syncTicker := time.NewTicker(pendingSyncInterval)
+		defer syncTicker.Stop()
+		for {
+			select {
+			case <-syncTicker.C:
+				if len(c.pendingSyncs()) == 0 {
+					continue
+				}
+				tickCtx, cancel := context.WithTimeout(refreshCtx, backgroundRefreshTimeout)
+				_, dropped, err := c.flushPendingSyncs(tickCtx)
+				if err != nil {
+					c.logger.Warn("Queued word status changes still not pushed", "error", err)
+				}
+				if dropped > 0 {
+					c.requestRefresh()
+				}
+				cancel()
+			case <-tick:
+				tickCtx, cancel := context.WithTimeout(refreshCtx, backgroundRefreshTimeout)
+				if err := c.refreshDBIfStale(tickCtx); err != nil {
+					c.logger.Error("failed to refresh db", "error", err)
+				}
+				cancel()
+				timer.Reset(jitteredInterval(ttl))
+			case <-c.refreshNow:
+				tickCtx, cancel := context.WithTimeout(refreshCtx, backgroundRefreshTimeout)
+				if err := c.refreshDBShared(tickCtx); err != nil {
+					c.logger.Error("failed to download requested db", "error", err)
+				}
+				cancel()
+			case <-refreshCtx.Done():
+				c.logger.Debug("Stopping refresh loop")
+				return
+			}
+		}
+	})
 
 	c.logger.Info("Migaku session ready")
 	return c, nil
 }
 
+// staleDBFileAge is how old an unused snapshot must be before the startup
+// sweep deletes it.
+const staleDBFileAge = 24 * time.Hour
+
+var (
+	activeDBPathsMu sync.Mutex
+	activeDBPaths   = make(map[string]int)
+)
+
+func localDBDir() string {
+	return filepath.Join(os.TempDir(), "migoku-db")
+}
+
+// acquireDBPath marks path as used by a live client.
+func acquireDBPath(path string) {
+	activeDBPathsMu.Lock()
+	defer activeDBPathsMu.Unlock()
+	activeDBPaths[path]++
+}
+
+// releaseDBPath drops a client's claim on path and reports whether no other
+// live client still uses it, i.e. whether its files may be deleted.
+func releaseDBPath(path string) bool {
+	activeDBPathsMu.Lock()
+	defer activeDBPathsMu.Unlock()
+	if activeDBPaths[path] <= 1 {
+		delete(activeDBPaths, path)
+		return true
+	}
+	activeDBPaths[path]--
+	return false
+}
+
+func isDBPathActive(path string) bool {
+	activeDBPathsMu.Lock()
+	defer activeDBPathsMu.Unlock()
+	return activeDBPaths[path] > 0
+}
+
+// sweepStaleDBFiles deletes snapshot files left behind by earlier runs that
+// are older than maxAge and not in use by a live client.
+func sweepStaleDBFiles(logger *slog.Logger, maxAge time.Duration) {
+	dir := localDBDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Error("failed to read temp db dir", "error", err)
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "migaku-") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if isDBPathActive(snapshotPath(path)) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Error("failed to remove stale db file", "path", path, "error", err)
+			continue
+		}
+		logger.Debug("Removed stale db file", "path", path)
+	}
+}
+
 func (c *MigakuClient) refreshDB(ctx context.Context) error {
 	start := time.Now()
 	c.logger.Debug("Refreshing local database")
@@ -117,15 +340,25 @@ func (c *MigakuClient) refreshDB(ctx context.Context) error {
 		return errors.New("missing migaku session")
 	}
 
-	data, err := session.ForceDownloadSRSDB(ctx)
+	// Push queued changes first so the snapshot includes them if it can.
+	if _, _, err := c.flushPendingSyncs(ctx); err != nil {
+		c.logger.Warn("Queued word status changes still not pushed", "error", err)
+	}
+
+	release, err := acquireDownloadSlot(ctx)
+	if err != nil {
+		return fmt.Errorf("waiting for a download slot: %w", err)
+	}
+	data, err := c.downloadSnapshot(ctx, session)
+	release()
 	if err != nil {
 		return err
 	}
 	c.logger.Debug("Downloaded database", "bytes", len(data))
 
-	tmpPath := c.dbPath + ".tmp"
-	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
-		return fmt.Errorf("failed to write db temp file: %w", err)
+	tmpPath, err := c.writeTempDB(data)
+	if err != nil {
+		return err
 	}
 
 	// Verify the downloaded database is valid by opening it temporarily
@@ -137,6 +370,19 @@ func (c *MigakuClient) refreshDB(ctx context.Context) error {
 	// Close the test connection - we'll open a fresh one after the rename
 	_ = testDB.Close()
 
+	if err := c.swapDB(tmpPath); err != nil {
+		return err
+	}
+	c.logger.Debug("Local database refreshed", "duration_ms", time.Since(start).Milliseconds())
+
+	if err := c.reapplyPendingSyncs(ctx); err != nil {
+		c.logger.Error("failed to reapply queued word status changes", "error", err)
+	}
+	return nil
+}
+
+// swapDB moves a verified snapshot into place and reopens the handles on it.
+func (c *MigakuClient) swapDB(tmpPath string) error {
 	// Now lock only for the swap operation - minimizes blocking time
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -147,74 +393,76 @@ func (c *MigakuClient) refreshDB(ctx context.Context) error {
 		return fmt.Errorf("failed to swap db file: %w", err)
 	}
 
-	// Close old database connection
-	if c.db != nil {
-		_ = c.db.Close()
-		c.db = nil
-	}
-
-	// Open fresh connection to the new database at the final path
-	newDB, err := sqlx.Open("sqlite", c.dbPath)
-	if err != nil {
+	// Reopen both handles on the new database at the final path
+	if err := c.openDBLocked(); err != nil {
 		return fmt.Errorf("failed to open new sqlite db: %w", err)
 	}
-	newDB.SetMaxOpenConns(1)
-	newDB.SetMaxIdleConns(1)
 
-	c.db = newDB
 	c.lastRefresh = time.Now()
-	c.logger.Debug("Local database refreshed", "duration_ms", time.Since(start).Milliseconds())
 	return nil
 }
 
-func (c *MigakuClient) refreshDBLocked(ctx context.Context) error {
-	start := time.Now()
-	c.logger.Debug("Refreshing local database (locked)")
-
-	if c.session == nil {
-		return errors.New("missing migaku session")
+// downloadSnapshot downloads the SRS database, retrying once with a fresh
+// token if the download is rejected as unauthorized.
+func (c *MigakuClient) downloadSnapshot(ctx context.Context, session *MigakuSession) ([]byte, error) {
+	data, err := session.ForceDownloadSRSDB(ctx)
+	if errors.Is(err, ErrDownloadUnauthorized) {
+		// The token can expire between the presigned URL request and the
+		// download; refresh it and start over once before giving up.
+		c.logger.Warn("Database download unauthorized, refreshing token and retrying", "error", err)
+		if _, refreshErr := session.auth.refresh(ctx); refreshErr != nil {
+			return nil, fmt.Errorf("failed to refresh token: %w", refreshErr)
+		}
+		data, err = session.ForceDownloadSRSDB(ctx)
 	}
+	return data, err
+}
 
-	// We already hold the lock, so we can't optimize this path
-	// But this is only used for initial setup, not periodic refreshes
-	data, err := c.session.ForceDownloadSRSDB(ctx)
+// writeTempDB writes a downloaded snapshot to a temp file of its own next to
+// c.dbPath, so overlapping refreshes never write into each other's file
+// before it is renamed into place.
+func (c *MigakuClient) writeTempDB(data []byte) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(c.dbPath), filepath.Base(c.dbPath)+".*.tmp")
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to create db temp file: %w", err)
 	}
-	c.logger.Debug("Downloaded database", "bytes", len(data))
-
-	tmpPath := c.dbPath + ".tmp"
-	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
-		return fmt.Errorf("failed to write db temp file: %w", err)
+	tmpPath := f.Name()
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to write db temp file: %w", err)
 	}
-	if err := os.Rename(tmpPath, c.dbPath); err != nil {
-		return fmt.Errorf("failed to swap db file: %w", err)
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to write db temp file: %w", err)
 	}
+	return tmpPath, nil
+}
 
-	if c.db != nil {
-		_ = c.db.Close()
-		c.db = nil
+// snapshotPath maps a file in the local db dir to the snapshot it belongs
+// to, turning "migaku-<key>.db.<random>.tmp" back into "migaku-<key>.db".
+func snapshotPath(path string) string {
+	if !strings.HasSuffix(path, ".tmp") {
+		return path
 	}
-
-	db, err := sqlx.Open("sqlite", c.dbPath)
-	if err != nil {
-		return fmt.Errorf("failed to open sqlite db: %w", err)
+	if i := strings.LastIndex(path, ".db."); i >= 0 {
+		return path[:i+len(".db")]
 	}
-	db.SetMaxOpenConns(1)
-	db.SetMaxIdleConns(1)
-	c.db = db
-	c.lastRefresh = time.Now()
-	c.logger.Debug("Local database refreshed", "duration_ms", time.Since(start).Milliseconds())
-	return nil
+	return strings.TrimSuffix(path, ".tmp")
 }
 
-func (c *MigakuClient) refreshDBIfStale(ctx context.Context, ttl time.Duration) error {
+// refreshDBIfStale downloads the db when the last refresh is older than the
+// client's refresh TTL. It deliberately takes no ttl: the cache TTL is often
+// far shorter, and passing it here made every write download the db first.
+func (c *MigakuClient) refreshDBIfStale(ctx context.Context) error {
+	ttl := c.refreshTTL
 	if ttl <= 0 {
 		c.logger.Debug("Skipping db refresh; ttl disabled")
 		return nil
 	}
+	// A jittered tick can come early; don't skip it for being under the ttl.
 	buffer := 2 * time.Second
-	threshold := max(ttl-buffer, 0)
+	threshold := max(time.Duration(float64(ttl)*(1-refreshJitter))-buffer, 0)
 
 	if !c.isRefreshStale(threshold) {
 		c.logger.Debug("Skipping db refresh; not stale", "ttl", ttl.String())
@@ -222,7 +470,88 @@ func (c *MigakuClient) refreshDBIfStale(ctx context.Context, ttl time.Duration)
 	}
 	c.logger.Debug("Db refresh required", "ttl", ttl.String())
 
-	return c.refreshDB(ctx)
+	return c.refreshDBShared(ctx)
+}
+
+// refreshDBShared refreshes the db, coalescing concurrent calls into a single
+// download whose result every caller receives.
+func (c *MigakuClient) refreshDBShared(ctx context.Context) error {
+	c.refreshMu.Lock()
+	if call := c.refreshing; call != nil {
+		c.refreshMu.Unlock()
+		c.logger.Debug("Waiting for in-flight db refresh")
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	c.refreshing = call
+	c.refreshMu.Unlock()
+
+	call.err = c.refreshDB(ctx)
+	c.recordRefreshResult(call.err)
+
+	c.refreshMu.Lock()
+	c.refreshing = nil
+	c.refreshMu.Unlock()
+	close(call.done)
+
+	return call.err
+}
+
+// RefreshStatus describes how fresh a client's local snapshot is.
+type RefreshStatus struct {
+	LastRefresh        time.Time
+	LastRefreshAttempt time.Time
+	LastRefreshError   error
+	RefreshTTL         time.Duration
+}
+
+// Age returns how long ago the snapshot was last refreshed successfully.
+func (s RefreshStatus) Age() time.Duration {
+	return time.Since(s.LastRefresh)
+}
+
+// staleTTLMultiplier is how many refresh TTLs may pass without a successful
+// refresh before a snapshot counts as stale.
+const staleTTLMultiplier = 3
+
+// IsStale reports whether the snapshot has missed several refreshes in a row.
+func (s RefreshStatus) IsStale() bool {
+	if s.RefreshTTL <= 0 || s.LastRefresh.IsZero() {
+		return false
+	}
+	return s.Age() >= staleTTLMultiplier*s.RefreshTTL
+}
+
+func (c *MigakuClient) recordRefreshResult(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastRefreshAttempt = time.Now()
+	c.lastRefreshErr = err
+}
+
+func (c *MigakuClient) refreshStatus() RefreshStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return RefreshStatus{
+		LastRefresh:        c.lastRefresh,
+		LastRefreshAttempt: c.lastRefreshAttempt,
+		LastRefreshError:   c.lastRefreshErr,
+		RefreshTTL:         c.refreshTTL,
+	}
+}
+
+// snapshotVersion identifies the data reads currently see. It changes when the
+// snapshot is refreshed or written to locally.
+func (c *MigakuClient) snapshotVersion() string {
+	c.mu.RLock()
+	last := c.lastRefresh
+	c.mu.RUnlock()
+	return strconv.FormatInt(last.UnixNano(), 10) + ":" + strconv.FormatUint(c.localWrites.Load(), 10)
 }
 
 func (c *MigakuClient) isRefreshStale(threshold time.Duration) bool {
@@ -232,57 +561,186 @@ func (c *MigakuClient) isRefreshStale(threshold time.Duration) bool {
 	return time.Since(last) >= threshold
 }
 
-func (c *MigakuClient) ensureDBLocked(ctx context.Context) (*sqlx.DB, error) {
+// requestRefresh asks the refresh loop to download a fresh snapshot without
+// waiting for it. Requests made while one is pending collapse into it.
+func (c *MigakuClient) requestRefresh() {
+	select {
+	case c.refreshNow <- struct{}{}:
+	default:
+	}
+}
+
+// ensureDBLocked returns the read handle, reopening the snapshot file if it
+// is on disk. It never downloads: when the file is missing it requests a
+// background refresh and returns ErrDBNotReady, so a request can't hang on
+// a download while holding c.mu. The caller must hold c.mu for writing.
+func (c *MigakuClient) ensureDBLocked() (*sqlx.DB, error) {
 	if c.db != nil {
 		return c.db, nil
 	}
 
 	if _, err := os.Stat(c.dbPath); err == nil {
 		c.logger.Debug("Opening existing db file", "path", c.dbPath)
-		db, err := sqlx.Open("sqlite", c.dbPath)
-		if err != nil {
+		if err := c.openDBLocked(); err != nil {
 			return nil, fmt.Errorf("failed to open sqlite db: %w", err)
 		}
-		db.SetMaxOpenConns(1)
-		db.SetMaxIdleConns(1)
-		c.db = db
 		return c.db, nil
 	}
 
-	c.logger.Debug("Db file missing; downloading fresh db")
-	if err := c.refreshDBLocked(ctx); err != nil {
-		return nil, err
-	}
-	return c.db, nil
+	c.logger.Debug("Db file missing; requesting fresh db")
+	c.requestRefresh()
+	return nil, ErrDBNotReady
 }
 
-func (c *MigakuClient) closeDB() {
+// ensureDBReady makes sure the local snapshot is open, see ensureDBLocked.
+func (c *MigakuClient) ensureDBReady() error {
+	c.mu.RLock()
+	ready := c.db != nil
+	c.mu.RUnlock()
+	if ready {
+		return nil
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	_, err := c.ensureDBLocked()
+	return err
+}
+
+// hasDB reports whether the local snapshot is open.
+func (c *MigakuClient) hasDB() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.db != nil
+}
+
+// openDBLocked opens the read and write handles on c.dbPath, closing any
+// that are open. The caller must hold c.mu for writing.
+func (c *MigakuClient) openDBLocked() error {
+	c.closeDBLocked()
+
+	db, err := openSnapshotDB(c.dbPath, false)
+	if err != nil {
+		return err
+	}
+	writeDB, err := openSnapshotDB(c.dbPath, true)
+	if err != nil {
+		_ = db.Close()
+		return err
+	}
+	c.db, c.writeDB = db, writeDB
+	return nil
+}
+
+func (c *MigakuClient) closeDBLocked() {
 	if c.db != nil {
 		_ = c.db.Close()
 		c.db = nil
 	}
+	if c.writeDB != nil {
+		_ = c.writeDB.Close()
+		c.writeDB = nil
+	}
 }
 
-func (c *MigakuClient) Close() {
+func (c *MigakuClient) closeDB() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeDBLocked()
+}
+
+// stopRefresh cancels the background refresh loop, aborting any snapshot
+// download it has in flight. It is safe to call more than once.
+func (c *MigakuClient) stopRefresh() {
 	if c.refreshStop != nil {
 		c.refreshStop()
-		c.refreshStop = nil
 	}
-	c.refreshWg.Wait()
-	if c.cleanUp != nil {
-		c.cleanUp()
+}
+
+// Close stops the refresh loop and releases the local snapshot. It is safe
+// to call more than once.
+func (c *MigakuClient) Close() {
+	c.closeOnce.Do(func() {
+		c.stopRefresh()
+		c.refreshWg.Wait()
+		if len(c.pendingSyncs()) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), pendingSyncFlushTimeout)
+			if _, _, err := c.flushPendingSyncs(ctx); err != nil {
+				c.logger.Error("Dropping queued word status changes that were never pushed",
+					"count", len(c.pendingSyncs()), "error", err)
+			}
+			cancel()
+		}
+		if c.cleanUp != nil {
+			c.cleanUp()
+		}
+	})
+}
+
+// removeDBFiles deletes the local snapshot and any leftover temp files.
+func (c *MigakuClient) removeDBFiles() {
+	if c.dbPath == "" {
+		return
+	}
+	paths, _ := filepath.Glob(c.dbPath + ".*.tmp")
+	paths = append(paths, c.dbPath, c.dbPath+".tmp")
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			c.logger.Error("failed to remove db file", "path", path, "error", err)
+		}
 	}
 }
 
+// hashProfileDirKey derives the per-account key that names the local db
+// file and scopes cache entries. It must be collision-resistant: two emails
+// sharing a key would share a snapshot and see each other's data.
 func hashProfileDirKey(email string) string {
-	key := email
-	hash := 0
-	for _, r := range key {
-		hash = int(r) + ((hash << 5) - hash)
+	sum := sha256.Sum256([]byte(email))
+	return hex.EncodeToString(sum[:])
+}
+
+// logQueryParams adds bound parameters to the debug query log. They can hold
+// word text and other account data, so they are left out unless
+// LOG_QUERY_PARAMS is set. It is set once at startup.
+var logQueryParams bool
+
+// logQuery records a query about to run. Info only counts the parameters;
+// the SQL goes to Debug, along with the parameters when logQueryParams is
+// set.
+func logQuery(ctx context.Context, client *MigakuClient, msg, query string, params []any) {
+	client.logger.Info(msg, slog.Int("params", len(params)))
+	if !client.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	if logQueryParams {
+		client.logger.Debug(msg, slog.String("query", query), slog.Any("params", params))
+		return
 	}
-	return fmt.Sprintf("%x", hash)
+	client.logger.Debug(msg, slog.String("query", query), slog.Int("params", len(params)))
+}
+
+// defaultSlowQueryThreshold is how long a query may take before it is logged
+// as slow, unless SLOW_QUERY_THRESHOLD says otherwise.
+const defaultSlowQueryThreshold = time.Second
+
+// slowQueryThreshold is how long a query may take before finishQuery logs
+// it at Warn; 0 turns the log off. It is set once at startup.
+var slowQueryThreshold = defaultSlowQueryThreshold
+
+// finishQuery records a query that started at start in the request's stats
+// and logs it when it ran past slowQueryThreshold. Parameters are included
+// on the same terms as in logQuery.
+func finishQuery(ctx context.Context, client *MigakuClient, query string, params []any, start time.Time) {
+	trackQuery(ctx, start)
+	elapsed := time.Since(start)
+	if slowQueryThreshold <= 0 || elapsed < slowQueryThreshold {
+		return
+	}
+	attrs := []any{slog.String("query", query), slog.Int64("duration_ms", elapsed.Milliseconds())}
+	if logQueryParams {
+		attrs = append(attrs, slog.Any("params", params))
+	}
+	client.logger.Warn("Slow query", attrs...)
 }
 
 func runQuery[T any](ctx context.Context, client *MigakuClient, query string, params ...any) ([]T, error) {
@@ -297,71 +755,97 @@ func runReadQuery[T any](ctx context.Context, client *MigakuClient, query string
 		return nil, errors.New("missing authenticated session")
 	}
 
-	client.logger.Info("Running read query", "query", query, "params", params)
+	logQuery(ctx, client, "Running read query", query, params)
+	defer finishQuery(ctx, client, query, params, time.Now())
 
-	client.mu.RLock()
-	if client.db != nil {
-		db := client.db
-		defer client.mu.RUnlock()
-		var result []T
-		if err := db.SelectContext(ctx, &result, query, params...); err != nil {
+	return withReadDB(client, func(db *sqlx.DB) ([]T, error) {
+		rows, err := db.QueryxContext(ctx, query, params...)
+		if err != nil {
+			client.logger.Error("Read query failed", "error", err)
+			return nil, fmt.Errorf("failed to execute read query: %w", err)
+		}
+		defer rows.Close()
+
+		result, err := scanRows[T](rows)
+		if err != nil {
 			client.logger.Error("Read query failed", "error", err)
 			return nil, fmt.Errorf("failed to execute read query: %w", err)
 		}
 		client.logger.Info("Read query completed", "rows", len(result))
 		return result, nil
-	}
-	client.mu.RUnlock()
+	})
+}
 
-	client.mu.Lock()
-	defer client.mu.Unlock()
-	db, err := client.ensureDBLocked(ctx)
-	if err != nil {
-		return nil, err
+func runReadRow(ctx context.Context, client *MigakuClient, query string, params ...any) (map[string]any, error) {
+	if client == nil {
+		return nil, errors.New("missing authenticated session")
 	}
 
-	var result []T
-	if err := db.SelectContext(ctx, &result, query, params...); err != nil {
-		client.logger.Error("Read query failed", "error", err)
-		return nil, fmt.Errorf("failed to execute read query: %w", err)
-	}
+	logQuery(ctx, client, "Running read row query", query, params)
+	defer finishQuery(ctx, client, query, params, time.Now())
 
-	client.logger.Info("Read query completed", "rows", len(result))
-	return result, nil
+	return withReadDB(client, func(db *sqlx.DB) (map[string]any, error) {
+		raw := map[string]any{}
+		if err := db.QueryRowxContext(ctx, query, params...).MapScan(raw); err != nil {
+			return nil, err
+		}
+		return raw, nil
+	})
 }
 
-func runReadRow(ctx context.Context, client *MigakuClient, query string, params ...any) (map[string]any, error) {
+// runReadRows is runReadRow for any number of rows, for queries whose
+// columns aren't known up front.
+func runReadRows(ctx context.Context, client *MigakuClient, query string, params ...any) ([]map[string]any, error) {
 	if client == nil {
 		return nil, errors.New("missing authenticated session")
 	}
 
-	client.logger.Info("Running read row query", "query", query, "params", params)
+	logQuery(ctx, client, "Running read rows query", query, params)
+	defer finishQuery(ctx, client, query, params, time.Now())
+
+	return withReadDB(client, func(db *sqlx.DB) ([]map[string]any, error) {
+		return mapScanRows(ctx, db, query, params...)
+	})
+}
 
+// withReadDB runs fn on the read handle under the read lock, so a refresh
+// can't swap the snapshot out mid-query. When the handle is closed it takes
+// the write lock to reopen it first.
+func withReadDB[T any](client *MigakuClient, fn func(db *sqlx.DB) (T, error)) (T, error) {
 	client.mu.RLock()
 	if client.db != nil {
 		db := client.db
 		defer client.mu.RUnlock()
-		row := db.QueryRowxContext(ctx, query, params...)
-		raw := map[string]any{}
-		if err := row.MapScan(raw); err != nil {
-			return nil, err
-		}
-		return raw, nil
+		return fn(db)
 	}
 	client.mu.RUnlock()
 
 	client.mu.Lock()
 	defer client.mu.Unlock()
-	db, err := client.ensureDBLocked(ctx)
+	db, err := client.ensureDBLocked()
 	if err != nil {
-		return nil, err
+		var zero T
+		return zero, err
 	}
-	row := db.QueryRowxContext(ctx, query, params...)
-	raw := map[string]any{}
-	if err := row.MapScan(raw); err != nil {
-		return nil, err
+	return fn(db)
+}
+
+func mapScanRows(ctx context.Context, db *sqlx.DB, query string, params ...any) ([]map[string]any, error) {
+	rows, err := db.QueryxContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute read query: %w", err)
 	}
-	return raw, nil
+	defer rows.Close()
+
+	var result []map[string]any
+	for rows.Next() {
+		raw := map[string]any{}
+		if err := rows.MapScan(raw); err != nil {
+			return nil, err
+		}
+		result = append(result, raw)
+	}
+	return result, rows.Err()
 }
 
 func runWriteQuery(ctx context.Context, client *MigakuClient, query string, params ...any) (sql.Result, error) {
@@ -369,21 +853,34 @@ func runWriteQuery(ctx context.Context, client *MigakuClient, query string, para
 		return nil, errors.New("missing authenticated session")
 	}
 
-	client.mu.Lock()
-	defer client.mu.Unlock()
+	logQuery(ctx, client, "Running write query", query, params)
+	defer finishQuery(ctx, client, query, params, time.Now())
 
-	client.logger.Info("Running write query", "query", query, "params", params)
+	// Writes use their own connection under the read lock, so reads carry
+	// on alongside them while a refresh, which needs the write lock, can't
+	// swap the file out mid-write.
+	client.mu.RLock()
+	if client.writeDB != nil {
+		writeDB := client.writeDB
+		defer client.mu.RUnlock()
+		return execWrite(ctx, client, writeDB, query, params...)
+	}
+	client.mu.RUnlock()
 
-	db, err := client.ensureDBLocked(ctx)
-	if err != nil {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if _, err := client.ensureDBLocked(); err != nil {
 		return nil, err
 	}
+	return execWrite(ctx, client, client.writeDB, query, params...)
+}
 
+func execWrite(ctx context.Context, client *MigakuClient, db *sqlx.DB, query string, params ...any) (sql.Result, error) {
 	result, err := db.ExecContext(ctx, query, params...)
 	if err != nil {
 		client.logger.Error("Write query failed", "error", err)
 		return nil, fmt.Errorf("failed to execute write query: %w", err)
 	}
-
+	client.localWrites.Add(1)
 	return result, nil
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+)
+
+// BenchmarkReadsDuringLocalWrites reads status counts in a loop while 300
+// local status writes run on the same client, and reports the read latency
+// percentiles. Reads use their own connection, so they should only ever wait
+// out a commit, never the whole run of writes.
+func BenchmarkReadsDuringLocalWrites(b *testing.B) {
+	const writes = 300
+	client := newTestClient(b)
+	repo := NewRepository()
+	ctx := context.Background()
+
+	record := wordRecord{
+		DictForm:     sql.NullString{String: "水", Valid: true},
+		Secondary:    sql.NullString{String: "みず", Valid: true},
+		PartOfSpeech: sql.NullString{String: "NOUN", Valid: true},
+		Language:     sql.NullString{String: "ja", Valid: true},
+	}
+	statuses := []string{dbStatusKnown, dbStatusLearning}
+
+	var latencies []time.Duration
+	for b.Loop() {
+		done := make(chan error, 1)
+		go func() {
+			for i := range writes {
+				update := wordStatusUpdate{KnownStatus: &statuses[i%2]}
+				if err := updateLocalWordStatus(ctx, client, []wordRecord{record}, update, time.Now().UnixMilli()); err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+
+	read:
+		for {
+			select {
+			case err := <-done:
+				if err != nil {
+					b.Fatalf("write: %v", err)
+				}
+				break read
+			default:
+			}
+			start := time.Now()
+			if _, err := repo.GetStatusCounts(ctx, client, "ja", ""); err != nil {
+				b.Fatalf("read: %v", err)
+			}
+			latencies = append(latencies, time.Since(start))
+		}
+	}
+
+	slices.Sort(latencies)
+	percentile := func(p int) float64 {
+		return float64(latencies[(len(latencies)-1)*p/100].Microseconds())
+	}
+	b.ReportMetric(percentile(50), "p50-µs")
+	b.ReportMetric(percentile(99), "p99-µs")
+	b.ReportMetric(percentile(100), "max-µs")
+	b.ReportMetric(float64(len(latencies))/float64(b.N), "reads/op")
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// SQLite columns are dynamically typed: one row can hold an integer where
+// the next holds text or NULL, and Migaku's snapshots do. The coerce
+// functions turn whatever the driver returns into the type the code wants,
+// reporting false for NULL or a value with no sensible conversion. Both the
+// map rows (normalizeRow and the getNull helpers) and the struct scans of
+// runReadQuery go through them, so a column is read the same way on either
+// path.
+
+func coerceString(value any) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case time.Time:
+		return v.Format(time.RFC3339Nano), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// coerceInt64 truncates fractional numbers and parses numeric text. Text
+// that isn't a number, including the empty string, doesn't convert.
+func coerceInt64(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		return parseInt64Text(v)
+	case []byte:
+		return parseInt64Text(string(v))
+	default:
+		return 0, false
+	}
+}
+
+func parseInt64Text(s string) (int64, bool) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, true
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return int64(f), true
+	}
+	return 0, false
+}
+
+func coerceFloat64(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	case []byte:
+		f, err := strconv.ParseFloat(strings.TrimSpace(string(v)), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// coerceBool takes any non-zero number as true, and text that is a number
+// or "true"/"false" in any case.
+func coerceBool(value any) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string, []byte:
+		s, _ := coerceString(v)
+		if b, err := strconv.ParseBool(strings.ToLower(strings.TrimSpace(s))); err == nil {
+			return b, true
+		}
+	}
+	if f, ok := coerceFloat64(value); ok {
+		return f != 0, true
+	}
+	return false, false
+}
+
+// isBoolColumn reports whether key is a WordList flag stored as an integer,
+// which normalizeRow hands back as a bool.
+func isBoolColumn(key string) bool {
+	switch key {
+	case "hasCard", "tracked", "isModern", "isPendingEnqueue", "isPendingApply":
+		return true
+	default:
+		return false
+	}
+}
+
+func normalizeRow(raw map[string]any) map[string]any {
+	result := make(map[string]any, len(raw))
+	for key, value := range raw {
+		if value == nil {
+			continue
+		}
+		switch v := value.(type) {
+		case []byte:
+			result[key] = string(v)
+		case int64:
+			result[key] = coerceInt64Value(key, v)
+		case int:
+			result[key] = coerceInt64Value(key, int64(v))
+		case float64:
+			result[key] = coerceInt64Value(key, int64(v))
+		default:
+			result[key] = v
+		}
+	}
+	return result
+}
+
+func coerceInt64Value(key string, value int64) any {
+	if isBoolColumn(key) {
+		return value != 0
+	}
+	return value
+}
+
+func getNullString(row map[string]any, key string) sql.NullString {
+	s, ok := coerceString(row[key])
+	return sql.NullString{String: s, Valid: ok}
+}
+
+func getNullInt64(row map[string]any, key string) sql.NullInt64 {
+	n, ok := coerceInt64(row[key])
+	return sql.NullInt64{Int64: n, Valid: ok}
+}
+
+func getNullBool(row map[string]any, key string) sql.NullBool {
+	b, ok := coerceBool(row[key])
+	return sql.NullBool{Bool: b, Valid: ok}
+}
+
+// scanRows reads rows into T: a struct whose db tags name the columns, or a
+// single-column scalar. Each value goes through the coerce functions for its
+// field's type. NULL leaves a plain field at its zero value; a value that
+// doesn't convert is an error naming the column.
+func scanRows[T any](rows *sqlx.Rows) ([]T, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var zero T
+	typ := reflect.TypeFor[T]()
+	scalar := typ.Kind() != reflect.Struct || isNullType(typ)
+	var fields [][]int
+	if scalar {
+		if len(columns) != 1 {
+			return nil, fmt.Errorf("scannable dest type %s with >1 columns (%d) in result", typ, len(columns))
+		}
+	} else {
+		fields = rows.Mapper.TraversalsByName(typ, columns)
+		for i, field := range fields {
+			if len(field) == 0 {
+				return nil, fmt.Errorf("missing destination name %s in %T", columns[i], &zero)
+			}
+		}
+	}
+
+	values := make([]any, len(columns))
+	dests := make([]any, len(columns))
+	for i := range values {
+		dests[i] = &values[i]
+	}
+
+	var result []T
+	for rows.Next() {
+		if err := rows.Scan(dests...); err != nil {
+			return nil, err
+		}
+		var item T
+		v := reflect.ValueOf(&item).Elem()
+		for i, value := range values {
+			dst := v
+			if !scalar {
+				dst = reflectx.FieldByIndexes(v, fields[i])
+			}
+			if err := assignColumn(dst, value); err != nil {
+				return nil, fmt.Errorf("column %s: %w", columns[i], err)
+			}
+		}
+		result = append(result, item)
+	}
+	return result, rows.Err()
+}
+
+func isNullType(typ reflect.Type) bool {
+	switch typ {
+	case reflect.TypeFor[sql.NullString](), reflect.TypeFor[sql.NullInt64](),
+		reflect.TypeFor[sql.NullFloat64](), reflect.TypeFor[sql.NullBool]():
+		return true
+	default:
+		return false
+	}
+}
+
+// assignColumn stores a driver value in dst, converting it to dst's type.
+func assignColumn(dst reflect.Value, value any) error {
+	switch p := dst.Addr().Interface().(type) {
+	case *sql.NullString:
+		p.String, p.Valid = coerceString(value)
+		return nil
+	case *sql.NullInt64:
+		p.Int64, p.Valid = coerceInt64(value)
+		return checkConverted(p.Valid, value, "integer")
+	case *sql.NullFloat64:
+		p.Float64, p.Valid = coerceFloat64(value)
+		return checkConverted(p.Valid, value, "number")
+	case *sql.NullBool:
+		p.Bool, p.Valid = coerceBool(value)
+		return checkConverted(p.Valid, value, "boolean")
+	}
+
+	if value == nil {
+		dst.SetZero()
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(dst.Type().Elem())
+		if err := assignColumn(elem.Elem(), value); err != nil {
+			return err
+		}
+		dst.Set(elem)
+	case reflect.String:
+		s, _ := coerceString(value)
+		dst.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := coerceInt64(value)
+		if !ok || dst.OverflowInt(n) {
+			return conversionError(value, dst.Type().String())
+		}
+		dst.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, ok := coerceFloat64(value)
+		if !ok {
+			return conversionError(value, dst.Type().String())
+		}
+		dst.SetFloat(f)
+	case reflect.Bool:
+		b, ok := coerceBool(value)
+		if !ok {
+			return conversionError(value, "bool")
+		}
+		dst.SetBool(b)
+	default:
+		scanner, ok := dst.Addr().Interface().(sql.Scanner)
+		if !ok {
+			return fmt.Errorf("unsupported destination type %s", dst.Type())
+		}
+		return scanner.Scan(value)
+	}
+	return nil
+}
+
+// checkConverted fails a Null field left invalid by a value that wasn't
+// NULL, which would otherwise pass for NULL.
+func checkConverted(ok bool, value any, want string) error {
+	if ok || value == nil {
+		return nil
+	}
+	return conversionError(value, want)
+}
+
+func conversionError(value any, want string) error {
+	return fmt.Errorf("cannot convert %T %q to %s", value, fmt.Sprint(value), want)
+}
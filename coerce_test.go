@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mixedColumnSQL fills a column with one value of every SQLite storage class,
+// the way Migaku's snapshots mix them.
+var mixedColumnSQL = []string{
+	`CREATE TABLE mixed (id INTEGER PRIMARY KEY, v)`,
+	`INSERT INTO mixed (id, v) VALUES
+		(1, 42),
+		(2, 2.5),
+		(3, '7'),
+		(4, x'3132'),
+		(5, NULL),
+		(6, 0),
+		(7, 'TRUE')`,
+}
+
+func TestScanRowsMixedTypes(t *testing.T) {
+	client := newTestClient(t, mixedColumnSQL...)
+	ctx := context.Background()
+	const query = `SELECT v FROM mixed WHERE id <= 6 ORDER BY id`
+
+	seven, fortyTwo, two, twelve, zero := 7, 42, 2, 12, 0
+	checkScan(t, ctx, client, query, []string{"42", "2.5", "7", "12", "", "0"})
+	checkScan(t, ctx, client, query, []int{42, 2, 7, 12, 0, 0})
+	checkScan(t, ctx, client, query, []int64{42, 2, 7, 12, 0, 0})
+	checkScan(t, ctx, client, query, []float64{42, 2.5, 7, 12, 0, 0})
+	checkScan(t, ctx, client, query, []bool{true, true, true, true, false, false})
+	checkScan(t, ctx, client, query, []*int{&fortyTwo, &two, &seven, &twelve, nil, &zero})
+	checkScan(t, ctx, client, query, []sql.NullString{
+		{String: "42", Valid: true}, {String: "2.5", Valid: true}, {String: "7", Valid: true},
+		{String: "12", Valid: true}, {}, {String: "0", Valid: true},
+	})
+	checkScan(t, ctx, client, query, []sql.NullInt64{
+		{Int64: 42, Valid: true}, {Int64: 2, Valid: true}, {Int64: 7, Valid: true},
+		{Int64: 12, Valid: true}, {}, {Int64: 0, Valid: true},
+	})
+	checkScan(t, ctx, client, query, []sql.NullFloat64{
+		{Float64: 42, Valid: true}, {Float64: 2.5, Valid: true}, {Float64: 7, Valid: true},
+		{Float64: 12, Valid: true}, {}, {Float64: 0, Valid: true},
+	})
+	checkScan(t, ctx, client, query, []sql.NullBool{
+		{Bool: true, Valid: true}, {Bool: true, Valid: true}, {Bool: true, Valid: true},
+		{Bool: true, Valid: true}, {}, {Bool: false, Valid: true},
+	})
+
+	// Text that reads as a boolean but not a number.
+	checkScan(t, ctx, client, `SELECT v FROM mixed WHERE id = 7`, []bool{true})
+	checkScan(t, ctx, client, `SELECT v FROM mixed WHERE id = 7`, []string{"TRUE"})
+}
+
+// checkScan scans query into a struct with a single field of want's element
+// type, and as that type on its own, and compares both with want.
+func checkScan[T any](t *testing.T, ctx context.Context, client *MigakuClient, query string, want []T) {
+	t.Helper()
+
+	type row struct {
+		V T `db:"v"`
+	}
+	rows, err := runReadQuery[row](ctx, client, query)
+	if err != nil {
+		t.Fatalf("scan into struct{V %T}: %v", *new(T), err)
+	}
+	got := make([]T, len(rows))
+	for i, r := range rows {
+		got[i] = r.V
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("struct{V %T} = %v, want %v", *new(T), deref(got), deref(want))
+	}
+
+	scalars, err := runReadQuery[T](ctx, client, query)
+	if err != nil {
+		t.Fatalf("scan into %T: %v", *new(T), err)
+	}
+	if !reflect.DeepEqual(scalars, want) {
+		t.Errorf("%T = %v, want %v", *new(T), deref(scalars), deref(want))
+	}
+}
+
+// deref formats pointer slices by value for failure messages.
+func deref[T any](values []T) []any {
+	out := make([]any, len(values))
+	for i, v := range values {
+		rv := reflect.ValueOf(&v).Elem()
+		if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+			out[i] = rv.Elem().Interface()
+		} else {
+			out[i] = v
+		}
+	}
+	return out
+}
+
+func TestScanRowsConversionError(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	type intRow struct {
+		V int `db:"v"`
+	}
+	type nullIntRow struct {
+		V sql.NullInt64 `db:"v"`
+	}
+	type floatRow struct {
+		V float64 `db:"v"`
+	}
+	type boolRow struct {
+		V bool `db:"v"`
+	}
+
+	errs := map[string]error{}
+	_, errs["int"] = runReadQuery[intRow](ctx, client, `SELECT 'abc' AS v`)
+	_, errs["sql.NullInt64"] = runReadQuery[nullIntRow](ctx, client, `SELECT 'abc' AS v`)
+	_, errs["float64"] = runReadQuery[floatRow](ctx, client, `SELECT 'abc' AS v`)
+	_, errs["bool"] = runReadQuery[boolRow](ctx, client, `SELECT 'abc' AS v`)
+	_, errs["empty string as int"] = runReadQuery[intRow](ctx, client, `SELECT '' AS v`)
+	_, errs["int8 overflow"] = runReadQuery[int8](ctx, client, `SELECT 300 AS v`)
+	for name, err := range errs {
+		if err == nil {
+			t.Errorf("%s: no error for a value that doesn't convert", name)
+			continue
+		}
+		if !strings.Contains(err.Error(), "column v") || !strings.Contains(err.Error(), "cannot convert") {
+			t.Errorf("%s: error %q doesn't name the column and the conversion", name, err)
+		}
+	}
+}
+
+// TestMapAndStructReadsAgree reads the mixed column through both paths,
+// runReadRows with the getNull helpers and runReadQuery into sql.Null
+// fields, which must see every value the same way.
+func TestMapAndStructReadsAgree(t *testing.T) {
+	client := newTestClient(t, mixedColumnSQL...)
+	ctx := context.Background()
+	const query = `SELECT v FROM mixed ORDER BY id`
+
+	maps, err := runReadRows(ctx, client, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type nullRow struct {
+		S sql.NullString `db:"v"`
+	}
+	strs, err := runReadQuery[nullRow](ctx, client, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(maps) != len(strs) {
+		t.Fatalf("%d map rows, %d struct rows", len(maps), len(strs))
+	}
+	for i, m := range maps {
+		if got := getNullString(m, "v"); got != strs[i].S {
+			t.Errorf("row %d: getNullString = %+v, struct scan = %+v", i+1, got, strs[i].S)
+		}
+	}
+
+	type intRow struct {
+		V sql.NullInt64 `db:"v"`
+	}
+	ints, err := runReadQuery[intRow](ctx, client, query+` LIMIT 6`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range ints {
+		if got := getNullInt64(maps[i], "v"); got != r.V {
+			t.Errorf("row %d: getNullInt64 = %+v, struct scan = %+v", i+1, got, r.V)
+		}
+	}
+}
+
+func TestNormalizeRow(t *testing.T) {
+	got := normalizeRow(map[string]any{
+		"dictForm":    []byte("本"),
+		"mod":         float64(1700000000000),
+		"hasCard":     int64(1),
+		"tracked":     int64(0),
+		"isModern":    float64(1),
+		"knownStatus": "KNOWN",
+		"secondary":   nil,
+	})
+	want := map[string]any{
+		"dictForm":    "本",
+		"mod":         int64(1700000000000),
+		"hasCard":     true,
+		"tracked":     false,
+		"isModern":    true,
+		"knownStatus": "KNOWN",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeRow = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDeckNameRequired = errors.New("deck name is required")
+	ErrDeckNameTaken    = errors.New("deck name is already in use")
+)
+
+// RenameDeck renames a deck in Migaku and in the local snapshot. The pushed
+// row is the deck's full local row with the new name, so fields this server
+// doesn't know about go back unchanged. Another live deck of the same
+// language with the name, ignoring case, makes it ErrDeckNameTaken, which
+// keeps deck names usable wherever a deck can be named.
+func (s *MigakuService) RenameDeck(ctx context.Context, client *MigakuClient, deckID int, name string) (Deck, error) {
+	if client == nil {
+		return Deck{}, ErrClientNotAuth
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Deck{}, ErrDeckNameRequired
+	}
+
+	client.logger.Info("Renaming deck", slog.Int("deckId", deckID))
+
+	if err := client.refreshDBIfStale(ctx); err != nil {
+		return Deck{}, err
+	}
+
+	raw, err := runReadRow(ctx, client, "SELECT * FROM deck WHERE id = ? AND del = 0;", deckID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Deck{}, fmt.Errorf("%w: %d", ErrDeckNotFound, deckID)
+	}
+	if err != nil {
+		return Deck{}, fmt.Errorf("failed to look up deck: %w", err)
+	}
+	payload := normalizeRow(raw)
+
+	clash, err := runReadRow(ctx, client,
+		"SELECT id FROM deck WHERE del = 0 AND lang = ? AND id != ? AND name = ? COLLATE NOCASE LIMIT 1;",
+		getNullString(payload, "lang").String, deckID, name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Deck{}, fmt.Errorf("failed to check deck names: %w", err)
+	}
+	if err == nil {
+		return Deck{}, fmt.Errorf("%w: %s (deck %d)", ErrDeckNameTaken, name, getNullInt64(normalizeRow(clash), "id").Int64)
+	}
+
+	serverMod := int64(-1)
+	if mod := getNullInt64(payload, "serverMod"); mod.Valid {
+		serverMod = mod.Int64
+	}
+	modTimestamp := time.Now().UnixMilli()
+	payload["name"] = name
+	payload["mod"] = modTimestamp
+	payload["serverMod"] = serverMod
+
+	if err := client.session.PushDeckSync(ctx, []map[string]any{payload}); err != nil {
+		return Deck{}, fmt.Errorf("failed to sync: %w", err)
+	}
+
+	// As with word updates, the row mirrors what the server now holds.
+	if _, err := runWriteQuery(ctx, client,
+		"UPDATE deck SET name = ?, mod = ?, serverMod = ? WHERE id = ?;",
+		name, modTimestamp, modTimestamp, deckID,
+	); err != nil {
+		return Deck{}, fmt.Errorf("failed to update local db: %w", err)
+	}
+
+	s.cache.Clear()
+	return Deck{ID: deckID, Name: name}, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fixtureSchema is the part of a Migaku snapshot the queries read.
+const fixtureSchema = `
+CREATE TABLE WordList (dictForm TEXT, secondary TEXT, partOfSpeech TEXT, language TEXT, mod INTEGER, serverMod INTEGER, del INTEGER, knownStatus TEXT, hasCard INTEGER, tracked INTEGER, created INTEGER, isModern INTEGER, serverVersion INTEGER, isPendingEnqueue INTEGER, isPendingApply INTEGER, PRIMARY KEY (dictForm, secondary, partOfSpeech, language));
+CREATE TABLE CardWordRelation (cardId INTEGER, dictForm TEXT, secondary TEXT, partOfSpeech TEXT, language TEXT, occurrences INTEGER, mod INTEGER, serverMod INTEGER, del INTEGER);
+CREATE TABLE card (id INTEGER PRIMARY KEY, deckId INTEGER, cardTypeId INTEGER, created INTEGER, mod INTEGER, serverMod INTEGER, del INTEGER, due INTEGER, interval REAL, factor REAL, lastReview INTEGER, reviewCount INTEGER, failCount INTEGER, lessonId TEXT, primaryField TEXT, secondaryField TEXT, fields TEXT, words TEXT);
+CREATE TABLE card_type (id INTEGER PRIMARY KEY, lang TEXT, name TEXT, config TEXT, mod INTEGER, serverMod INTEGER, del INTEGER);
+CREATE TABLE deck (id INTEGER PRIMARY KEY, lang TEXT, name TEXT, mod INTEGER, serverMod INTEGER, del INTEGER);
+CREATE TABLE review (id INTEGER PRIMARY KEY, cardId INTEGER, day INTEGER, interval REAL, factor REAL, type INTEGER, duration INTEGER, mod INTEGER, serverMod INTEGER, del INTEGER);
+CREATE TABLE keyValue (key TEXT PRIMARY KEY, entry TEXT, mod INTEGER, serverMod INTEGER);
+CREATE TABLE vacation (id INTEGER PRIMARY KEY, start INTEGER, end INTEGER, del INTEGER);
+`
+
+// fixtureWord is a Japanese word in the fixture with one card of its own.
+// Its card has reviews answered reviews, alternating failed and passed and
+// starting with a failure, one a day back from today.
+type fixtureWord struct {
+	dictForm, secondary, partOfSpeech, status string
+	deckID, reviews                           int
+}
+
+// fixtureWords are seeded in order, card ids counting from 1. Cards 1-4 are
+// in deck 1 and 5-6 in deck 2. A deleted word, 消, is seeded after them.
+var fixtureWords = []fixtureWord{
+	{"本", "ほん", "NOUN", "KNOWN", 1, 3},
+	{"水", "みず", "NOUN", "LEARNING", 1, 4},
+	{"食べる", "たべる", "VERB", "UNKNOWN", 1, 5},
+	{"僕", "ぼく", "PRON", "IGNORED", 1, 6},
+	{"猫", "ねこ", "NOUN", "LEARNING", 2, 7},
+	{"行く", "いく", "VERB", "KNOWN", 2, 8},
+}
+
+// newFixtureDB writes a snapshot with fixtureSchema and fixtureWords to a
+// temp file and returns its path. The extra statements run after the seed,
+// to add rows or break the schema for a single test.
+func newFixtureDB(t testing.TB, extra ...string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "migaku-test.db")
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open fixture db: %v", err)
+	}
+	defer db.Close()
+
+	exec := func(query string, args ...any) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatalf("seed fixture db: %v\n%s", err, query)
+		}
+	}
+
+	exec(fixtureSchema)
+	exec(`INSERT INTO card_type VALUES (1, 'ja', 'Sentence', '{"fields":[{"name":"Sentence"},{"name":"Translation"}]}', 0, 0, 0)`)
+	exec(`INSERT INTO deck VALUES (1, 'ja', 'Main', 0, 0, 0), (2, 'ja', 'Other', 0, 0, 0)`)
+
+	now := time.Now().UnixMilli()
+	today := dayNumber(time.Now(), time.UTC)
+	const day = int64(24 * time.Hour / time.Millisecond)
+	reviewID := 1
+	for i, w := range fixtureWords {
+		cardID := i + 1
+		exec(`INSERT INTO WordList VALUES (?, ?, ?, 'ja', ?, ?, 0, ?, 1, 0, ?, 1, 1, 0, 0)`,
+			w.dictForm, w.secondary, w.partOfSpeech, now-int64(i)*day, now-int64(i)*day, w.status, now-int64(i)*3*day)
+		exec(`INSERT INTO card VALUES (?, ?, 1, ?, ?, ?, 0, ?, ?, 2.5, ?, ?, 0, '', ?, ?, '[]', '[]')`,
+			cardID, w.deckID, now-int64(i)*3*day, now, now, today+i, float64(i*7), today-1, w.reviews, w.dictForm, w.secondary)
+		exec(`INSERT INTO CardWordRelation VALUES (?, ?, ?, ?, 'ja', 1, ?, ?, 0)`,
+			cardID, w.dictForm, w.secondary, w.partOfSpeech, now, now)
+		for k := range w.reviews {
+			reviewType := 2
+			if k%2 == 0 {
+				reviewType = 1
+			}
+			exec(`INSERT INTO review VALUES (?, ?, ?, ?, 2.5, ?, ?, ?, ?, 0)`,
+				reviewID, cardID, today-k, float64(k*2), reviewType, 5+k, now, now)
+			reviewID++
+		}
+	}
+	exec(`INSERT INTO WordList VALUES ('消', 'きえ', 'NOUN', 'ja', ?, ?, 1, 'KNOWN', 0, 0, ?, 1, 1, 0, 0)`, now, now, now)
+
+	for _, query := range extra {
+		exec(query)
+	}
+	return path
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// newTestClient returns a client on a fresh fixture snapshot. It has no
+// session and no refresh loop, so it never downloads.
+func newTestClient(t testing.TB, extra ...string) *MigakuClient {
+	t.Helper()
+
+	c := &MigakuClient{
+		logger:      discardLogger(),
+		dbPath:      newFixtureDB(t, extra...),
+		key:         "test",
+		lastRefresh: time.Now(),
+		refreshNow:  make(chan struct{}, 1),
+	}
+	c.mu.Lock()
+	err := c.openDBLocked()
+	c.mu.Unlock()
+	if err != nil {
+		t.Fatalf("open fixture snapshot: %v", err)
+	}
+	t.Cleanup(c.closeDB)
+	return c
+}
+
+// newTestApp returns an Application with a fresh cache and service and no
+// logged-in accounts.
+func newTestApp(t *testing.T) *Application {
+	t.Helper()
+
+	cache := NewCache(time.Minute)
+	return &Application{
+		logger:     discardLogger(),
+		cache:      cache,
+		service:    NewMigakuService(NewRepository(), cache),
+		secretKeys: []string{"test-secret"},
+		location:   time.UTC,
+		accounts:   make(map[string]*MigakuClient),
+	}
+}
+
+// serveAs runs handler on req as if authMiddleware had let client through.
+func serveAs(handler http.HandlerFunc, client *MigakuClient, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, req.WithContext(context.WithValue(req.Context(), requestClientKey, client)))
+	return rec
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	_ "embed"
-	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 //go:embed docs.html
@@ -16,7 +20,22 @@ var docsHTML []byte
 //go:embed openapi.yaml
 var openAPISpec []byte
 
+// respondJSON writes data as a 200 response. Authenticated GET reads carry
+// an ETag and get a 304 when If-None-Match already names it.
 func (app *Application) respondJSON(w http.ResponseWriter, r *http.Request, data any) {
+	if etag, ok := app.responseETag(r); ok {
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	app.respondJSONUncached(w, r, data)
+}
+
+// respondJSONUncached writes data without an ETag, for reads whose result
+// differs between identical requests.
+func (app *Application) respondJSONUncached(w http.ResponseWriter, r *http.Request, data any) {
 	if err := encode(w, r, http.StatusOK, data); err != nil {
 		app.logger.Error("Failed to encode JSON response", "error", err)
 	}
@@ -32,58 +51,191 @@ func (app *Application) requireClient(w http.ResponseWriter, r *http.Request) (*
 	return nil, false
 }
 
+// requestLocation resolves the timezone used to map Migaku day numbers to
+// calendar dates, preferring the tz query parameter over the server default.
+func (app *Application) requestLocation(r *http.Request) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return app.location, nil
+	}
+	return time.LoadLocation(tz)
+}
+
+// requestLocale resolves the locale stats labels are formatted in: the
+// locale query parameter if set, otherwise the best supported match for
+// Accept-Language, otherwise English.
+func (app *Application) requestLocale(r *http.Request) (string, error) {
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		return parseLocale(locale)
+	}
+	return negotiateLocale(r.Header.Get("Accept-Language")), nil
+}
+
 type wordStatusRequest struct {
 	Status    string           `json:"status"`
 	WordText  string           `json:"wordText"`
 	Secondary string           `json:"secondary"`
 	Items     []WordStatusItem `json:"items"`
 	Language  string           `json:"language"`
+	// Partial updates the words that were found and reports the rest,
+	// rather than rejecting the whole batch.
+	Partial bool `json:"partial"`
+	// Verify re-downloads the snapshot after the push to confirm the server
+	// applied the change.
+	Verify bool `json:"verify"`
+	// QueueIfOffline saves the change locally and queues the push when the
+	// sync server can't be reached, answering 202 instead of failing.
+	QueueIfOffline bool `json:"queueIfOffline"`
 }
 
-func (app *Application) handleWords(w http.ResponseWriter, r *http.Request) {
-	client, ok := app.requireClient(w, r)
+func (req wordStatusRequest) Valid(context.Context) map[string]string {
+	problems := make(map[string]string)
+	if strings.TrimSpace(req.Status) == "" {
+		problems["status"] = "is required"
+	} else if _, ok := statusToUpdate(req.Status); !ok {
+		problems["status"] = "must be one of: known, learning, tracked, ignored"
+	}
+	if len(req.Items) == 0 && strings.TrimSpace(req.WordText) == "" {
+		problems["wordText"] = "is required"
+	}
+	for i, item := range req.Items {
+		if strings.TrimSpace(item.WordText) == "" {
+			problems[fmt.Sprintf("items[%d].wordText", i)] = "is required"
+		}
+	}
+	return problems
+}
+
+func (req wordStatusRequest) options() WordStatusOptions {
+	return WordStatusOptions{Partial: req.Partial, Verify: req.Verify, QueueIfOffline: req.QueueIfOffline}
+}
+
+var (
+	errInvalidDeckID = errors.New("deckId must be an integer")
+	errDeckAndDeckID = errors.New("use either deck or deckId, not both")
+	errDeckLookup    = errors.New("failed to look up deck")
+)
+
+// parseDeckID reads the deck filter from either the deckId query parameter,
+// which must be an integer, or deck, a deck name matched case-insensitively.
+// An empty result means all decks. Use deckErrorStatus for the error's status.
+func (app *Application) parseDeckID(r *http.Request) (string, error) {
+	query := r.URL.Query()
+	deckID, name := query.Get("deckId"), strings.TrimSpace(query.Get("deck"))
+	if name == "" {
+		if err := validateDeckID(deckID); err != nil {
+			return "", err
+		}
+		return deckID, nil
+	}
+	if deckID != "" {
+		return "", errDeckAndDeckID
+	}
+
+	client, ok := clientFromContext(r.Context())
 	if !ok {
-		return
+		return "", fmt.Errorf("%w: missing authenticated session", errDeckLookup)
+	}
+	deckID, err := app.service.ResolveDeckName(r.Context(), client, name)
+	if err != nil && !errors.Is(err, ErrDeckNotFound) && !errors.Is(err, ErrAmbiguousDeck) {
+		return "", fmt.Errorf("%w: %w", errDeckLookup, err)
 	}
+	return deckID, err
+}
 
-	lang := r.URL.Query().Get("lang")
-	status := r.URL.Query().Get("status")
-	deckID := r.URL.Query().Get("deckId")
-	form := r.URL.Query().Get("form")
-	formExactStr := r.URL.Query().Get("formExact")
-	formExact := false
-	if formExactStr != "" {
+// deckErrorStatus maps a parseDeckID error to a response status: 404 for an
+// unknown deck name, 500 if the lookup itself failed and 400 otherwise.
+func deckErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrDeckNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errDeckLookup):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func validateDeckID(deckID string) error {
+	if deckID == "" {
+		return nil
+	}
+	if _, err := strconv.ParseInt(deckID, 10, 64); err != nil {
+		return errInvalidDeckID
+	}
+	return nil
+}
+
+// parseWordFilter reads the word filters shared by /words and /words/count.
+// The returned error message is safe to show to the client, with the status
+// given by deckErrorStatus.
+func (app *Application) parseWordFilter(r *http.Request) (WordFilter, error) {
+	deckID, err := app.parseDeckID(r)
+	if err != nil {
+		return WordFilter{}, err
+	}
+	filter := WordFilter{
+		Lang:   r.URL.Query().Get("lang"),
+		Status: r.URL.Query().Get("status"),
+		DeckID: deckID,
+		Form:   r.URL.Query().Get("form"),
+	}
+	if formExactStr := r.URL.Query().Get("formExact"); formExactStr != "" {
 		parsedExact, err := strconv.ParseBool(formExactStr)
 		if err != nil {
-			app.writeJSONError(w, r, http.StatusBadRequest, "formExact must be a boolean")
-			return
+			return filter, errors.New("formExact must be a boolean")
+		}
+		filter.FormExact = parsedExact
+	}
+	if includeStr := r.URL.Query().Get("includeIgnored"); includeStr != "" {
+		parsedInclude, err := strconv.ParseBool(includeStr)
+		if err != nil {
+			return filter, errors.New("includeIgnored must be a boolean")
+		}
+		filter.IncludeIgnored = parsedInclude
+	}
+	if sinceStr := r.URL.Query().Get("sinceCreated"); sinceStr != "" {
+		parsedSince, err := strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil || parsedSince < 0 {
+			return filter, errors.New("sinceCreated must be a non-negative epoch milliseconds timestamp")
 		}
-		formExact = parsedExact
+		filter.SinceCreated = parsedSince
+	}
+	return filter, nil
+}
+
+func (app *Application) handleWords(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := app.parseWordFilter(r)
+	if err != nil {
+		app.writeError(w, r, deckErrorStatus(err), err)
+		return
 	}
 
 	pagination := parsePaginationParams(r)
 
-	total, err := app.service.CountWords(r.Context(), client, lang, status, deckID, form, formExact)
+	total, err := app.service.CountWords(r.Context(), client, filter)
 	if err != nil {
-		if err.Error() == "invalid status: must be one of: known, learning, unknown, ignored" {
+		if errors.Is(err, ErrInvalidWordStatus) {
 			app.writeJSONError(w, r, http.StatusBadRequest, "Status must be one of: known, learning, unknown, ignored")
 			return
 		}
-		app.logger.Error("Failed to count words", "error", err, "status", status)
+		app.logger.Error("Failed to count words", "error", err, "status", filter.Status)
 		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	words, err := app.service.GetWords(
-		r.Context(), client, lang, status, deckID, form, formExact,
-		pagination.PageSize, pagination.Offset,
-	)
+	words, err := app.service.GetWords(r.Context(), client, filter, pagination.PageSize, pagination.Offset)
 	if err != nil {
-		if err.Error() == "invalid status: must be one of: known, learning, unknown, ignored" {
+		if errors.Is(err, ErrInvalidWordStatus) {
 			app.writeJSONError(w, r, http.StatusBadRequest, "Status must be one of: known, learning, unknown, ignored")
 			return
 		}
-		app.logger.Error("Failed to get words", "error", err, "status", status)
+		app.logger.Error("Failed to get words", "error", err, "status", filter.Status)
 		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -91,103 +243,158 @@ func (app *Application) handleWords(w http.ResponseWriter, r *http.Request) {
 	app.respondPaginated(w, r, words, pagination, total)
 }
 
-func (app *Application) handleSetWordStatus(w http.ResponseWriter, r *http.Request) {
+func (app *Application) handleWordsCount(w http.ResponseWriter, r *http.Request) {
 	client, ok := app.requireClient(w, r)
 	if !ok {
 		return
 	}
 
-	var req wordStatusRequest
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields()
-	if err := decoder.Decode(&req); err != nil {
-		app.writeJSONError(w, r, http.StatusBadRequest, "Request body must be valid JSON")
+	filter, err := app.parseWordFilter(r)
+	if err != nil {
+		app.writeError(w, r, deckErrorStatus(err), err)
 		return
 	}
 
-	req.Status = strings.ToLower(strings.TrimSpace(req.Status))
-	req.WordText = strings.TrimSpace(req.WordText)
-	req.Secondary = strings.TrimSpace(req.Secondary)
+	count, err := app.service.CountWords(r.Context(), client, filter)
+	if err != nil {
+		if errors.Is(err, ErrInvalidWordStatus) {
+			app.writeJSONError(w, r, http.StatusBadRequest, "Status must be one of: known, learning, unknown, ignored")
+			return
+		}
+		app.logger.Error("Failed to count words", "error", err, "status", filter.Status)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-	if req.Status == "" {
-		app.writeJSONError(w, r, http.StatusBadRequest, "Status is required")
+	app.respondJSON(w, r, map[string]int{
+		"count": count,
+	})
+}
+
+func (app *Application) handleRandomWords(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
 		return
 	}
 
-	if _, ok := statusToUpdate(req.Status); !ok {
-		app.writeJSONError(w, r, http.StatusBadRequest, "Status must be one of: known, learning, tracked, ignored")
+	filter, err := app.parseWordFilter(r)
+	if err != nil {
+		app.writeError(w, r, deckErrorStatus(err), err)
 		return
 	}
 
-	if len(req.Items) == 0 {
-		if req.WordText == "" {
-			app.writeJSONError(w, r, http.StatusBadRequest, "WordText is required")
+	count := defaultRandomWordsCount
+	if countStr := r.URL.Query().Get("count"); countStr != "" {
+		parsed, err := strconv.Atoi(countStr)
+		if err != nil || parsed <= 0 || parsed > maxRandomWordsCount {
+			app.writeJSONError(w, r, http.StatusBadRequest,
+				fmt.Sprintf("count must be an integer between 1 and %d", maxRandomWordsCount))
+			return
+		}
+		count = parsed
+	}
+
+	words, err := app.service.GetRandomWords(r.Context(), client, filter, count)
+	if err != nil {
+		if errors.Is(err, ErrInvalidWordStatus) {
+			app.writeJSONError(w, r, http.StatusBadRequest, "Status must be one of: known, learning, unknown, ignored")
 			return
 		}
+		app.logger.Error("Failed to get random words", "error", err, "status", filter.Status)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	app.respondJSONUncached(w, r, words)
+}
+
+func (app *Application) handleWordChanges(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	sinceStr := r.URL.Query().Get("since")
+	if sinceStr == "" {
+		app.writeJSONError(w, r, http.StatusBadRequest, "since is required")
+		return
 	}
+	since, err := strconv.ParseInt(sinceStr, 10, 64)
+	if err != nil || since < 0 {
+		app.writeJSONError(w, r, http.StatusBadRequest, "since must be a non-negative epoch milliseconds timestamp")
+		return
+	}
+
+	lang := r.URL.Query().Get("lang")
+
+	changes, err := app.service.GetWordChanges(r.Context(), client, lang, since)
+	if err != nil {
+		app.logger.Error("Failed to get word changes", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	app.respondJSON(w, r, changes)
+}
+
+func (app *Application) handleSetWordStatus(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	req, problems, err := decodeValid[wordStatusRequest](r)
+	if len(problems) > 0 {
+		app.writeValidationError(w, r, problems)
+		return
+	}
+	if err != nil {
+		app.writeError(w, r, decodeErrorStatus(err), err)
+		return
+	}
+
+	req.Status = strings.ToLower(strings.TrimSpace(req.Status))
+	req.WordText = strings.TrimSpace(req.WordText)
+	req.Secondary = strings.TrimSpace(req.Secondary)
 
 	if len(req.Items) > 0 {
 		items := make([]WordStatusItem, 0, len(req.Items))
 		for _, item := range req.Items {
-			wordText := strings.TrimSpace(item.WordText)
-			secondary := strings.TrimSpace(item.Secondary)
-			if wordText == "" {
-				app.writeJSONError(w, r, http.StatusBadRequest, "WordText is required for each item")
-				return
-			}
 			items = append(items, WordStatusItem{
-				WordText:  wordText,
-				Secondary: secondary,
+				WordText:  strings.TrimSpace(item.WordText),
+				Secondary: strings.TrimSpace(item.Secondary),
 			})
 		}
 
-		err := app.service.SetWordStatusBatch(r.Context(), client, items, req.Status, req.Language)
+		failures, err := app.service.SetWordStatusBatch(r.Context(), client, items, req.Status, req.Language, req.options())
+		resp := wordStatusBatchResponse("Word status updated successfully", len(items), failures, req.Partial)
+		if errors.Is(err, ErrSyncQueued) {
+			app.respondWordStatusQueued(w, r, resp)
+			return
+		}
 		if err != nil {
-			status := http.StatusInternalServerError
-			message := msgInternalServerError
-
-			switch {
-			case errors.Is(err, ErrWordNotFound):
-				status = http.StatusNotFound
-				message = err.Error()
-			case errors.Is(err, ErrInvalidStatus), errors.Is(err, ErrWordTextRequired):
-				status = http.StatusBadRequest
-				message = err.Error()
-			case errors.Is(err, ErrClientNotAuth):
-				status = http.StatusUnauthorized
-				message = err.Error()
-			default:
+			status := wordStatusErrorCode(err)
+			if status == http.StatusInternalServerError {
 				app.logger.Error("Failed to update word status batch", "error", err, "status", req.Status, "count", len(items))
 			}
-
-			app.writeJSONError(w, r, status, message)
+			app.writeError(w, r, status, err)
 			return
 		}
 
-		app.respondJSON(w, r, map[string]any{
-			"message": "Word status updated successfully",
-			"count":   len(items),
-		})
+		app.respondJSON(w, r, resp)
 		return
 	}
 
-	err := app.service.SetWordStatus(r.Context(), client, req.WordText, req.Secondary, req.Status, req.Language)
+	err = app.service.SetWordStatus(r.Context(), client, req.WordText, req.Secondary, req.Status, req.Language,
+		WordStatusOptions{Verify: req.Verify, QueueIfOffline: req.QueueIfOffline})
+	if errors.Is(err, ErrSyncQueued) {
+		app.respondWordStatusQueued(w, r, map[string]any{})
+		return
+	}
 	if err != nil {
-		status := http.StatusInternalServerError
-		message := msgInternalServerError
-
-		// Determine appropriate status code based on error type
-		switch {
-		case errors.Is(err, ErrWordNotFound):
-			status = http.StatusNotFound
-			message = err.Error()
-		case errors.Is(err, ErrInvalidStatus), errors.Is(err, ErrWordTextRequired):
-			status = http.StatusBadRequest
-			message = err.Error()
-		case errors.Is(err, ErrClientNotAuth):
-			status = http.StatusUnauthorized
-			message = err.Error()
-		default:
+		status := wordStatusErrorCode(err)
+		if status == http.StatusInternalServerError {
 			app.logger.Error(
 				"Failed to update word status",
 				"error",
@@ -200,8 +407,7 @@ func (app *Application) handleSetWordStatus(w http.ResponseWriter, r *http.Reque
 				req.Secondary,
 			)
 		}
-
-		app.writeJSONError(w, r, status, message)
+		app.writeError(w, r, status, err)
 		return
 	}
 
@@ -210,151 +416,843 @@ func (app *Application) handleSetWordStatus(w http.ResponseWriter, r *http.Reque
 	})
 }
 
-func (app *Application) handleDecks(w http.ResponseWriter, r *http.Request) {
+type wordStatusPatchRequest struct {
+	KnownStatus    *string          `json:"knownStatus"`
+	Tracked        *bool            `json:"tracked"`
+	WordText       string           `json:"wordText"`
+	Secondary      string           `json:"secondary"`
+	Items          []WordStatusItem `json:"items"`
+	Language       string           `json:"language"`
+	Partial        bool             `json:"partial"`
+	Verify         bool             `json:"verify"`
+	QueueIfOffline bool             `json:"queueIfOffline"`
+}
+
+func (req wordStatusPatchRequest) Valid(context.Context) map[string]string {
+	problems := make(map[string]string)
+	if req.KnownStatus == nil && req.Tracked == nil {
+		problems["knownStatus"] = "or tracked is required"
+	}
+	if req.KnownStatus != nil {
+		if _, ok := dbKnownStatus(*req.KnownStatus); !ok {
+			problems["knownStatus"] = "must be one of: known, learning, unknown, ignored"
+		}
+	}
+	if len(req.Items) == 0 && strings.TrimSpace(req.WordText) == "" {
+		problems["wordText"] = "is required"
+	}
+	for i, item := range req.Items {
+		if strings.TrimSpace(item.WordText) == "" {
+			problems[fmt.Sprintf("items[%d].wordText", i)] = "is required"
+		}
+	}
+	return problems
+}
+
+// handlePatchWordStatus changes only the fields the request sets, unlike
+// handleSetWordStatus whose status always writes both knownStatus and
+// tracked.
+func (app *Application) handlePatchWordStatus(w http.ResponseWriter, r *http.Request) {
 	client, ok := app.requireClient(w, r)
 	if !ok {
 		return
 	}
 
-	decks, err := app.service.GetDecks(r.Context(), client)
+	req, problems, err := decodeValid[wordStatusPatchRequest](r)
+	if len(problems) > 0 {
+		app.writeValidationError(w, r, problems)
+		return
+	}
 	if err != nil {
-		app.logger.Error("Failed to get decks", "error", err)
-		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		app.writeError(w, r, decodeErrorStatus(err), err)
 		return
 	}
 
-	app.respondJSON(w, r, decks)
-}
+	items := req.Items
+	if len(items) == 0 {
+		items = []WordStatusItem{{WordText: req.WordText, Secondary: req.Secondary}}
+	}
+	for i, item := range items {
+		items[i].WordText = strings.TrimSpace(item.WordText)
+		items[i].Secondary = strings.TrimSpace(item.Secondary)
+	}
 
-func (app *Application) handleStatusCounts(w http.ResponseWriter, r *http.Request) {
-	client, ok := app.requireClient(w, r)
-	if !ok {
+	failures, err := app.service.PatchWordStatus(r.Context(), client, items, WordStatusPatch{
+		KnownStatus: req.KnownStatus,
+		Tracked:     req.Tracked,
+	}, req.Language, WordStatusOptions{
+		Partial:        req.Partial,
+		Verify:         req.Verify,
+		QueueIfOffline: req.QueueIfOffline,
+	})
+	resp := wordStatusBatchResponse("Word status updated successfully", len(items), failures, req.Partial)
+	if errors.Is(err, ErrSyncQueued) {
+		app.respondWordStatusQueued(w, r, resp)
 		return
 	}
-
-	lang := r.URL.Query().Get("lang")
-	deckID := r.URL.Query().Get("deckId")
-
-	counts, err := app.service.GetStatusCounts(r.Context(), client, lang, deckID)
 	if err != nil {
-		app.logger.Error("Failed to get status counts", "error", err)
-		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		status := wordStatusErrorCode(err)
+		if status == http.StatusInternalServerError {
+			app.logger.Error("Failed to patch word status", "error", err, "count", len(items))
+		}
+		app.writeError(w, r, status, err)
 		return
 	}
 
-	// Return as array for backward compatibility with frontend
-	app.respondJSON(w, r, []StatusCounts{*counts})
+	app.respondJSON(w, r, resp)
 }
 
-func (app *Application) handleTables(w http.ResponseWriter, r *http.Request) {
+type wordStatusResetRequest struct {
+	WordText       string           `json:"wordText"`
+	Secondary      string           `json:"secondary"`
+	Items          []WordStatusItem `json:"items"`
+	Language       string           `json:"language"`
+	Partial        bool             `json:"partial"`
+	Verify         bool             `json:"verify"`
+	QueueIfOffline bool             `json:"queueIfOffline"`
+}
+
+func (req wordStatusResetRequest) Valid(context.Context) map[string]string {
+	problems := make(map[string]string)
+	if len(req.Items) == 0 && strings.TrimSpace(req.WordText) == "" {
+		problems["wordText"] = "is required"
+	}
+	for i, item := range req.Items {
+		if strings.TrimSpace(item.WordText) == "" {
+			problems[fmt.Sprintf("items[%d].wordText", i)] = "is required"
+		}
+	}
+	return problems
+}
+
+func (app *Application) handleResetWordStatus(w http.ResponseWriter, r *http.Request) {
 	client, ok := app.requireClient(w, r)
 	if !ok {
 		return
 	}
 
-	tables, err := app.service.GetTables(r.Context(), client)
+	req, problems, err := decodeValid[wordStatusResetRequest](r)
+	if len(problems) > 0 {
+		app.writeValidationError(w, r, problems)
+		return
+	}
 	if err != nil {
-		app.logger.Error("Failed to get tables", "error", err)
-		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		app.writeError(w, r, decodeErrorStatus(err), err)
 		return
 	}
 
-	app.respondJSON(w, r, tables)
-}
+	items := req.Items
+	if len(items) == 0 {
+		items = []WordStatusItem{{WordText: req.WordText, Secondary: req.Secondary}}
+	}
+	for i, item := range items {
+		items[i].WordText = strings.TrimSpace(item.WordText)
+		items[i].Secondary = strings.TrimSpace(item.Secondary)
+	}
 
-func (app *Application) handleDatabaseSchema(w http.ResponseWriter, r *http.Request) {
-	client, ok := app.requireClient(w, r)
-	if !ok {
+	failures, err := app.service.ResetWordStatus(r.Context(), client, items, req.Language, WordStatusOptions{
+		Partial:        req.Partial,
+		Verify:         req.Verify,
+		QueueIfOffline: req.QueueIfOffline,
+	})
+	resp := wordStatusBatchResponse("Word status reset successfully", len(items), failures, req.Partial)
+	if errors.Is(err, ErrSyncQueued) {
+		app.respondWordStatusQueued(w, r, resp)
 		return
 	}
-
-	schema, err := app.service.GetDatabaseSchema(r.Context(), client)
 	if err != nil {
-		app.logger.Error("Failed to get database schema", "error", err)
-		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		status := wordStatusErrorCode(err)
+		if status == http.StatusInternalServerError {
+			app.logger.Error("Failed to reset word status", "error", err, "count", len(items))
+		}
+		app.writeError(w, r, status, err)
 		return
 	}
 
-	app.respondJSON(w, r, schema)
+	app.respondJSON(w, r, resp)
 }
 
-func (app *Application) handleDifficultWords(w http.ResponseWriter, r *http.Request) {
+type deckRenameRequest struct {
+	Name string `json:"name"`
+}
+
+func (req deckRenameRequest) Valid(context.Context) map[string]string {
+	problems := make(map[string]string)
+	if strings.TrimSpace(req.Name) == "" {
+		problems["name"] = "is required"
+	}
+	return problems
+}
+
+func (app *Application) handleRenameDeck(w http.ResponseWriter, r *http.Request) {
 	client, ok := app.requireClient(w, r)
 	if !ok {
 		return
 	}
 
-	lang := r.URL.Query().Get("lang")
-	limit := 50
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
-			limit = parsedLimit
-		}
+	deckID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		app.writeError(w, r, http.StatusBadRequest, errInvalidDeckID)
+		return
 	}
 
-	if lang == "" {
-		app.writeJSONError(w, r, http.StatusBadRequest, "lang is required")
+	req, problems, err := decodeValid[deckRenameRequest](r)
+	if len(problems) > 0 {
+		app.writeValidationError(w, r, problems)
+		return
+	}
+	if err != nil {
+		app.writeError(w, r, decodeErrorStatus(err), err)
 		return
 	}
 
-	deckID := r.URL.Query().Get("deckId")
-
-	words, err := app.service.GetDifficultWords(r.Context(), client, lang, limit, deckID)
+	deck, err := app.service.RenameDeck(r.Context(), client, deckID, req.Name)
 	if err != nil {
-		app.logger.Error("Failed to get difficult words", "error", err)
-		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		status := deckWriteErrorCode(err)
+		if status == http.StatusInternalServerError {
+			app.logger.Error("Failed to rename deck", "error", err, "deckId", deckID)
+		}
+		app.writeError(w, r, status, err)
 		return
 	}
-	app.respondJSON(w, r, words)
+
+	app.respondJSON(w, r, deck)
 }
 
-func (app *Application) handleWordStats(w http.ResponseWriter, r *http.Request) {
+// deckWriteErrorCode maps a deck change error to its HTTP status.
+func deckWriteErrorCode(err error) int {
+	switch {
+	case errors.Is(err, ErrDeckNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrDeckNameTaken):
+		return http.StatusConflict
+	case errors.Is(err, ErrDeckNameRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrClientNotAuth):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// wordStatusErrorCode maps a word status update error to its HTTP status.
+// Anything unrecognised is a 500, whose message writeJSONError masks.
+func wordStatusErrorCode(err error) int {
+	switch {
+	case errors.Is(err, ErrWordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrAmbiguousWord), errors.Is(err, ErrSyncNotConfirmed):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidStatus), errors.Is(err, ErrInvalidWordStatus),
+		errors.Is(err, ErrWordTextRequired), errors.Is(err, ErrEmptyPatch):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrClientNotAuth):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// handlePendingWordStatus lists the word status changes saved locally whose
+// push is still queued.
+func (app *Application) handlePendingWordStatus(w http.ResponseWriter, r *http.Request) {
 	client, ok := app.requireClient(w, r)
 	if !ok {
 		return
 	}
 
-	lang := r.URL.Query().Get("lang")
-	if lang == "" {
-		app.writeJSONError(w, r, http.StatusBadRequest, "lang is required")
+	app.respondJSONUncached(w, r, app.service.PendingSyncs(client))
+}
+
+// handleFlushWordStatus pushes the queued word status changes now. Changes
+// the sync server still can't receive stay queued and are listed in the
+// response.
+func (app *Application) handleFlushWordStatus(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
 		return
 	}
 
-	deckID := r.URL.Query().Get("deckId")
-
-	stats, err := app.service.GetWordStats(r.Context(), client, lang, deckID)
+	result, err := app.service.FlushPendingSyncs(r.Context(), client)
 	if err != nil {
-		app.logger.Error("Failed to get word stats", "error", err)
+		app.logger.Error("Failed to flush queued word status changes", "error", err)
 		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
-	app.respondJSON(w, r, stats)
+
+	app.respondJSONUncached(w, r, result)
 }
 
-func (app *Application) handleDueStats(w http.ResponseWriter, r *http.Request) {
+// respondWordStatusQueued answers 202 Accepted for a change saved locally
+// whose push is waiting for the sync server.
+func (app *Application) respondWordStatusQueued(w http.ResponseWriter, r *http.Request, resp map[string]any) {
+	resp["message"] = "Word status saved locally; sync queued until the sync server is reachable"
+	resp["queued"] = true
+	if err := encode(w, r, http.StatusAccepted, resp); err != nil {
+		app.logger.Error("Failed to encode JSON response", "error", err)
+	}
+}
+
+func wordStatusBatchResponse(message string, requested int, failures []WordStatusFailure, partial bool) map[string]any {
+	resp := map[string]any{
+		"message": message,
+		"count":   requested - len(failures),
+	}
+	if partial {
+		if failures == nil {
+			failures = []WordStatusFailure{}
+		}
+		resp["notFound"] = failures
+	}
+	return resp
+}
+
+func (app *Application) handleDecks(w http.ResponseWriter, r *http.Request) {
 	client, ok := app.requireClient(w, r)
 	if !ok {
 		return
 	}
 
-	lang := r.URL.Query().Get("lang")
-	if lang == "" {
-		app.writeJSONError(w, r, http.StatusBadRequest, "lang is required")
+	query := r.URL.Query()
+	filter := DeckFilter{
+		Lang:   query.Get("lang"),
+		Search: strings.TrimSpace(query.Get("search")),
+	}
+	if withCountsStr := query.Get("withCounts"); withCountsStr != "" {
+		withCounts, err := strconv.ParseBool(withCountsStr)
+		if err != nil {
+			app.writeJSONError(w, r, http.StatusBadRequest, "withCounts must be a boolean")
+			return
+		}
+		filter.WithCounts = withCounts
+	}
+
+	// Without page or page_size the response stays a plain array.
+	if !query.Has("page") && !query.Has("page_size") {
+		decks, err := app.service.GetDecks(r.Context(), client, filter, 0, 0)
+		if err != nil {
+			app.logger.Error("Failed to get decks", "error", err)
+			app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		app.respondJSON(w, r, decks)
 		return
 	}
 
-	deckID := r.URL.Query().Get("deckId")
-	periodID := r.URL.Query().Get("periodId")
+	pagination := parsePaginationParams(r)
 
-	stats, err := app.service.GetDueStats(r.Context(), client, lang, deckID, periodID)
+	total, err := app.service.CountDecks(r.Context(), client, filter)
 	if err != nil {
-		app.logger.Error("Failed to get due stats", slog.String("error", err.Error()))
+		app.logger.Error("Failed to count decks", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	decks, err := app.service.GetDecks(r.Context(), client, filter, pagination.PageSize, pagination.Offset)
+	if err != nil {
+		app.logger.Error("Failed to get decks", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	app.respondPaginated(w, r, decks, pagination, total)
+}
+
+func (app *Application) handleDueCards(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	deckID, err := app.parseDeckID(r)
+	if err != nil {
+		app.writeError(w, r, deckErrorStatus(err), err)
+		return
+	}
+	loc, err := app.requestLocation(r)
+	if err != nil {
+		app.writeJSONError(w, r, http.StatusBadRequest, "tz must be a valid IANA timezone name")
+		return
+	}
+
+	filter := app.service.DueCardFilter(r.Context(), client, r.URL.Query().Get("lang"), deckID, loc)
+	pagination := parsePaginationParams(r)
+
+	total, err := app.service.CountCards(r.Context(), client, filter)
+	if err != nil {
+		app.logger.Error("Failed to count due cards", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	cards, err := app.service.GetDueCards(r.Context(), client, filter, pagination.PageSize, pagination.Offset)
+	if err != nil {
+		app.logger.Error("Failed to get due cards", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	app.respondPaginated(w, r, cards, pagination, total)
+}
+
+func (app *Application) handleCardFields(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	lang := r.URL.Query().Get("lang")
+
+	fields, err := app.service.GetCardFields(r.Context(), client, lang)
+	if err != nil {
+		app.logger.Error("Failed to get card fields", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	app.respondJSON(w, r, fields)
+}
+
+func (app *Application) handleStatusCounts(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	lang := r.URL.Query().Get("lang")
+	deckID, err := app.parseDeckID(r)
+	if err != nil {
+		app.writeError(w, r, deckErrorStatus(err), err)
+		return
+	}
+
+	counts, err := app.service.GetStatusCounts(r.Context(), client, lang, deckID)
+	if err != nil {
+		app.logger.Error("Failed to get status counts", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Return as array for backward compatibility with frontend
+	app.respondJSON(w, r, []StatusCounts{*counts})
+}
+
+func (app *Application) handleTables(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	tables, err := app.service.GetTables(r.Context(), client)
+	if err != nil {
+		app.logger.Error("Failed to get tables", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	app.respondJSON(w, r, tables)
+}
+
+func (app *Application) handleKeyValue(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	entries, err := app.service.GetKeyValues(r.Context(), client, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		app.writeError(w, r, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		app.logger.Error("Failed to get key values", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if key != "" {
+		app.respondJSON(w, r, entries[0])
+		return
+	}
+	app.respondJSON(w, r, entries)
+}
+
+func (app *Application) handleAudit(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			app.writeJSONError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = parsed
+	}
+
+	app.respondJSON(w, r, app.service.RecentAudit(client, limit))
+}
+
+func (app *Application) handleDatabaseSchema(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	schema, err := app.service.GetDatabaseSchema(r.Context(), client)
+	if err != nil {
+		app.logger.Error("Failed to get database schema", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	app.respondJSON(w, r, schema)
+}
+
+func (app *Application) handleDatabaseSchemaSQL(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	ddl, err := app.service.GetDatabaseSchemaSQL(r.Context(), client)
+	if err != nil {
+		app.logger.Error("Failed to get database schema", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/sql; charset=utf-8")
+	if _, err := io.WriteString(w, ddl); err != nil {
+		app.logger.Error("Failed to write schema SQL", slog.String("error", err.Error()))
+	}
+}
+
+func (app *Application) handleDifficultWords(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	lang := r.URL.Query().Get("lang")
+	pagination := parsePaginationParams(r)
+	// limit predates page_size and is still honoured as its alias.
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit <= 0 {
+			app.writeValidationError(w, r, map[string]string{"limit": "must be a positive integer"})
+			return
+		}
+		if r.URL.Query().Get("page_size") == "" {
+			pagination.PageSize = min(parsedLimit, maxPageSize)
+			pagination.Offset = (pagination.Page - 1) * pagination.PageSize
+		}
+	}
+
+	minReviews := defaultDifficultMinReviews
+	if minReviewsStr := r.URL.Query().Get("minReviews"); minReviewsStr != "" {
+		parsed, err := strconv.Atoi(minReviewsStr)
+		if err != nil || parsed <= 0 {
+			app.writeValidationError(w, r, map[string]string{"minReviews": "must be a positive integer"})
+			return
+		}
+		minReviews = parsed
+	}
+
+	if lang == "" {
+		app.writeJSONError(w, r, http.StatusBadRequest, "lang is required")
+		return
+	}
+
+	deckID, err := app.parseDeckID(r)
+	if err != nil {
+		app.writeError(w, r, deckErrorStatus(err), err)
+		return
+	}
+
+	fromDay := 0
+	if sinceDaysStr := r.URL.Query().Get("sinceDays"); sinceDaysStr != "" {
+		sinceDays, err := strconv.Atoi(sinceDaysStr)
+		if err != nil || sinceDays <= 0 {
+			app.writeValidationError(w, r, map[string]string{"sinceDays": "must be a positive integer"})
+			return
+		}
+		loc, err := app.requestLocation(r)
+		if err != nil {
+			app.writeJSONError(w, r, http.StatusBadRequest, "tz must be a valid IANA timezone name")
+			return
+		}
+		fromDay = daysAgo(sinceDays, loc)
+	}
+
+	sort := r.URL.Query().Get("sort")
+	if sort != "" {
+		if _, ok := difficultWordsOrder[sort]; !ok {
+			app.writeJSONError(w, r, http.StatusBadRequest, ErrInvalidDifficultSort.Error())
+			return
+		}
+	}
+
+	// Without page or page_size the response stays a plain array of the
+	// top limit words.
+	if !r.URL.Query().Has("page") && !r.URL.Query().Has("page_size") {
+		words, err := app.service.GetDifficultWords(
+			r.Context(), client, lang, pagination.PageSize, 0, deckID, minReviews, fromDay, sort,
+		)
+		if err != nil {
+			app.logger.Error("Failed to get difficult words", "error", err)
+			app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		app.respondJSON(w, r, words)
+		return
+	}
+
+	total, err := app.service.CountDifficultWords(r.Context(), client, lang, deckID, minReviews, fromDay)
+	if err != nil {
+		app.logger.Error("Failed to count difficult words", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	words, err := app.service.GetDifficultWords(
+		r.Context(), client, lang, pagination.PageSize, pagination.Offset, deckID, minReviews, fromDay, sort,
+	)
+	if err != nil {
+		app.logger.Error("Failed to get difficult words", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.respondPaginated(w, r, words, pagination, total)
+}
+
+// parseDayParam reads an optional positive day-number query parameter;
+// 0 means the parameter was not given.
+func parseDayParam(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	day, err := strconv.Atoi(value)
+	if err != nil || day <= 0 {
+		return 0, fmt.Errorf("%s must be a positive day number", name)
+	}
+	return day, nil
+}
+
+func (app *Application) handleReviews(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	deckID, err := app.parseDeckID(r)
+	if err != nil {
+		app.writeError(w, r, deckErrorStatus(err), err)
+		return
+	}
+	fromDay, err := parseDayParam(r, "fromDay")
+	if err != nil {
+		app.writeJSONError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	toDay, err := parseDayParam(r, "toDay")
+	if err != nil {
+		app.writeJSONError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if fromDay > 0 && toDay > 0 && fromDay > toDay {
+		app.writeJSONError(w, r, http.StatusBadRequest, "fromDay must not be after toDay")
+		return
+	}
+
+	filter := ReviewFilter{
+		Lang:    r.URL.Query().Get("lang"),
+		DeckID:  deckID,
+		FromDay: fromDay,
+		ToDay:   toDay,
+	}
+	pagination := parsePaginationParams(r)
+
+	total, err := app.service.CountReviews(r.Context(), client, filter)
+	if err != nil {
+		app.logger.Error("Failed to count reviews", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	reviews, err := app.service.GetReviews(r.Context(), client, filter, pagination.PageSize, pagination.Offset)
+	if err != nil {
+		app.logger.Error("Failed to get reviews", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	app.respondPaginated(w, r, reviews, pagination, total)
+}
+
+func (app *Application) handleCards(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	deckID, err := app.parseDeckID(r)
+	if err != nil {
+		app.writeError(w, r, deckErrorStatus(err), err)
+		return
+	}
+	dueBefore, err := parseDayParam(r, "dueBefore")
+	if err != nil {
+		app.writeJSONError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := CardFilter{
+		Lang:      r.URL.Query().Get("lang"),
+		DeckID:    deckID,
+		DueBefore: dueBefore,
+	}
+	pagination := parsePaginationParams(r)
+
+	total, err := app.service.CountCards(r.Context(), client, filter)
+	if err != nil {
+		app.logger.Error("Failed to count cards", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	cards, err := app.service.GetCards(r.Context(), client, filter, pagination.PageSize, pagination.Offset)
+	if err != nil {
+		app.logger.Error("Failed to get cards", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	app.respondPaginated(w, r, cards, pagination, total)
+}
+
+func (app *Application) handleWordStats(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	lang := r.URL.Query().Get("lang")
+	if lang == "" {
+		app.writeJSONError(w, r, http.StatusBadRequest, "lang is required")
+		return
+	}
+
+	deckID, err := app.parseDeckID(r)
+	if err != nil {
+		app.writeError(w, r, deckErrorStatus(err), err)
+		return
+	}
+
+	stats, err := app.service.GetWordStats(r.Context(), client, lang, deckID)
+	if err != nil {
+		app.logger.Error("Failed to get word stats", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.respondJSON(w, r, stats)
+}
+
+func (app *Application) handlePartOfSpeechStats(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	lang := r.URL.Query().Get("lang")
+	if lang == "" {
+		app.writeJSONError(w, r, http.StatusBadRequest, "lang is required")
+		return
+	}
+
+	deckID, err := app.parseDeckID(r)
+	if err != nil {
+		app.writeError(w, r, deckErrorStatus(err), err)
+		return
+	}
+
+	stats, err := app.service.GetPartOfSpeechStats(r.Context(), client, lang, deckID)
+	if err != nil {
+		app.logger.Error("Failed to get part of speech stats", "error", err)
 		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 	app.respondJSON(w, r, stats)
 }
 
+func (app *Application) handleDueStats(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	lang := r.URL.Query().Get("lang")
+	if lang == "" {
+		app.writeJSONError(w, r, http.StatusBadRequest, "lang is required")
+		return
+	}
+
+	deckID, err := app.parseDeckID(r)
+	if err != nil {
+		app.writeError(w, r, deckErrorStatus(err), err)
+		return
+	}
+	periodID := r.URL.Query().Get("periodId")
+	if periodID != "" {
+		if _, _, err := parsePeriod(periodID); err != nil {
+			app.writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	dates, err := parseDateRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		app.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	today, err := parseToday(r.URL.Query().Get("today"))
+	if err != nil {
+		app.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	granularity, err := parseGranularity(r.URL.Query().Get("granularity"))
+	if err != nil {
+		app.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	locale, err := app.requestLocale(r)
+	if err != nil {
+		app.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	loc, err := app.requestLocation(r)
+	if err != nil {
+		app.writeJSONError(w, r, http.StatusBadRequest, "tz must be a valid IANA timezone name")
+		return
+	}
+
+	stats, err := app.service.GetDueStats(r.Context(), client, lang, deckID, periodID, dates, today, loc)
+	if err != nil {
+		app.logger.Error("Failed to get due stats", slog.String("error", err.Error()))
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// Labels follow Accept-Language unless locale is given.
+	w.Header().Add("Vary", "Accept-Language")
+	app.respondJSON(w, r, stats.Rebucket(granularity, locale, loc))
+}
+
 func (app *Application) handleIntervalStats(w http.ResponseWriter, r *http.Request) {
 	client, ok := app.requireClient(w, r)
 	if !ok {
@@ -367,8 +1265,22 @@ func (app *Application) handleIntervalStats(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	deckID := r.URL.Query().Get("deckId")
-	percentileID := r.URL.Query().Get("percentileId")
+	deckID, err := app.parseDeckID(r)
+	if err != nil {
+		app.writeError(w, r, deckErrorStatus(err), err)
+		return
+	}
+	// percentile (1-100) supersedes the older "75th"-style percentileId.
+	percentileID := r.URL.Query().Get("percentile")
+	if percentileID == "" {
+		percentileID = r.URL.Query().Get("percentileId")
+	}
+	if percentileID != "" {
+		if _, err := parsePercentile(percentileID); err != nil {
+			app.writeJSONError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
 
 	stats, err := app.service.GetIntervalStats(r.Context(), client, lang, deckID, percentileID)
 	if err != nil {
@@ -391,10 +1303,61 @@ func (app *Application) handleStudyStats(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	deckID := r.URL.Query().Get("deckId")
+	deckID, err := app.parseDeckID(r)
+	if err != nil {
+		app.writeError(w, r, deckErrorStatus(err), err)
+		return
+	}
 	periodID := r.URL.Query().Get("periodId")
+	if periodID != "" {
+		if _, _, err := parsePeriod(periodID); err != nil {
+			app.writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	dates, err := parseDateRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		app.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	today, err := parseToday(r.URL.Query().Get("today"))
+	if err != nil {
+		app.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	loc, err := app.requestLocation(r)
+	if err != nil {
+		app.writeJSONError(w, r, http.StatusBadRequest, "tz must be a valid IANA timezone name")
+		return
+	}
 
-	stats, err := app.service.GetStudyStats(r.Context(), client, lang, deckID, periodID)
+	var opts StudyStatsOptions
+	if includeStr := r.URL.Query().Get("includeLessonCards"); includeStr != "" {
+		parsed, err := strconv.ParseBool(includeStr)
+		if err != nil {
+			app.writeJSONError(w, r, http.StatusBadRequest, "includeLessonCards must be a boolean")
+			return
+		}
+		opts.IncludeLessonCards = parsed
+	}
+	if excludeStr := r.URL.Query().Get("excludeVacations"); excludeStr != "" {
+		parsed, err := strconv.ParseBool(excludeStr)
+		if err != nil {
+			app.writeJSONError(w, r, http.StatusBadRequest, "excludeVacations must be a boolean")
+			return
+		}
+		opts.ExcludeVacations = parsed
+	}
+	if seriesStr := r.URL.Query().Get("includeSeries"); seriesStr != "" {
+		parsed, err := strconv.ParseBool(seriesStr)
+		if err != nil {
+			app.writeJSONError(w, r, http.StatusBadRequest, "includeSeries must be a boolean")
+			return
+		}
+		opts.IncludeSeries = parsed
+	}
+
+	stats, err := app.service.GetStudyStats(r.Context(), client, lang, deckID, periodID, dates, today, loc, opts)
 	if err != nil {
 		app.logger.Error("Failed to get study stats", slog.String("error", err.Error()))
 		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
@@ -403,10 +1366,198 @@ func (app *Application) handleStudyStats(w http.ResponseWriter, r *http.Request)
 	app.respondJSON(w, r, stats)
 }
 
+type statsBatchRequest struct {
+	Lang       string   `json:"lang"`
+	DeckID     string   `json:"deckId"`
+	Period     string   `json:"period"`
+	Percentile string   `json:"percentile"`
+	TZ         string   `json:"tz"`
+	Want       []string `json:"want"`
+
+	IncludeLessonCards bool `json:"includeLessonCards"`
+}
+
+func (req statsBatchRequest) Valid(context.Context) map[string]string {
+	problems := make(map[string]string)
+	if req.Lang == "" {
+		problems["lang"] = "is required"
+	}
+	if validateDeckID(req.DeckID) != nil {
+		problems["deckId"] = "must be an integer"
+	}
+	if req.Period != "" {
+		if _, _, err := parsePeriod(req.Period); err != nil {
+			problems["period"] = "must be " + periodFormats
+		}
+	}
+	if req.Percentile != "" {
+		if _, err := parsePercentile(req.Percentile); err != nil {
+			problems["percentile"] = "must be an integer between 1 and 100"
+		}
+	}
+	if req.TZ != "" {
+		if _, err := time.LoadLocation(req.TZ); err != nil {
+			problems["tz"] = "must be a valid IANA timezone name"
+		}
+	}
+	for i, section := range req.Want {
+		if !slices.Contains(allStatsSections, section) {
+			problems[fmt.Sprintf("want[%d]", i)] = "must be one of: " + strings.Join(allStatsSections, ", ")
+		}
+	}
+	return problems
+}
+
+type statsBatchResponse struct {
+	*StatsBatch
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+func (app *Application) handleStatsBatch(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	req, problems, err := decodeValid[statsBatchRequest](r)
+	if len(problems) > 0 {
+		app.writeValidationError(w, r, problems)
+		return
+	}
+	if err != nil {
+		app.writeError(w, r, decodeErrorStatus(err), err)
+		return
+	}
+
+	loc := app.location
+	if req.TZ != "" {
+		// Valid has already checked the name loads.
+		loc, _ = time.LoadLocation(req.TZ)
+	}
+
+	sections := allStatsSections
+	if len(req.Want) > 0 {
+		sections = make([]string, 0, len(req.Want))
+		for _, section := range req.Want {
+			if !slices.Contains(sections, section) {
+				sections = append(sections, section)
+			}
+		}
+	}
+
+	batch, errs := app.service.GetStatsBatch(r.Context(), client, StatsBatchQuery{
+		Lang:         req.Lang,
+		DeckID:       req.DeckID,
+		PeriodID:     req.Period,
+		PercentileID: req.Percentile,
+		Location:     loc,
+		Sections:     sections,
+
+		IncludeLessonCards: req.IncludeLessonCards,
+	})
+
+	response := statsBatchResponse{StatsBatch: batch}
+	if len(errs) > 0 {
+		response.Errors = make(map[string]string, len(errs))
+		for section, err := range errs {
+			app.logger.Error("Failed to get batched stats", "section", section, "error", err)
+			response.Errors[section] = "failed to load " + section + " stats"
+		}
+	}
+
+	app.respondJSON(w, r, response)
+}
+
 func (app *Application) handleStatus(w http.ResponseWriter, r *http.Request) {
 	app.respondJSON(w, r, map[string]any{
-		"status":    "running",
-		"cache_ttl": app.cache.ttl.String(),
+		"status":      "running",
+		"cache_ttl":   app.cache.ttl.String(),
+		"refresh_ttl": app.refreshTTL.String(),
+	})
+}
+
+func (app *Application) handleValidateSchema(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	validation, err := app.service.ValidateSchema(r.Context(), client)
+	if err != nil {
+		app.logger.Error("Failed to validate database schema", "error", err)
+		app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	app.respondJSON(w, r, validation)
+}
+
+// DatabaseInfo reports the state of the caller's local snapshot
+type DatabaseInfo struct {
+	LastRefresh        *time.Time `json:"last_refresh,omitempty"`
+	LastRefreshAttempt *time.Time `json:"last_refresh_attempt,omitempty"`
+	LastRefreshError   string     `json:"last_refresh_error,omitempty"`
+	RefreshTTL         string     `json:"refresh_ttl"`
+	AgeSeconds         int        `json:"age_seconds"`
+	Stale              bool       `json:"stale"`
+}
+
+func (app *Application) handleDatabaseInfo(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	status := client.refreshStatus()
+	info := DatabaseInfo{
+		RefreshTTL: status.RefreshTTL.String(),
+		Stale:      status.IsStale(),
+	}
+	if !status.LastRefresh.IsZero() {
+		info.LastRefresh = &status.LastRefresh
+		info.AgeSeconds = int(status.Age().Seconds())
+	}
+	if !status.LastRefreshAttempt.IsZero() {
+		info.LastRefreshAttempt = &status.LastRefreshAttempt
+	}
+	if status.LastRefreshError != nil {
+		info.LastRefreshError = status.LastRefreshError.Error()
+	}
+
+	app.respondJSON(w, r, info)
+}
+
+// handleHealthz reports that the process is up; it never touches accounts.
+func (app *Application) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	app.respondJSON(w, r, map[string]string{
+		"status": "ok",
+	})
+}
+
+// handleReadyz reports whether the server can serve reads: it is ready when no
+// account is logged in, or when at least one account has a fresh snapshot.
+func (app *Application) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	app.accountsMu.RLock()
+	ready := len(app.accounts) == 0
+	for _, client := range app.accounts {
+		if client != nil && client.hasDB() && !client.refreshStatus().IsStale() {
+			ready = true
+			break
+		}
+	}
+	app.accountsMu.RUnlock()
+
+	if !ready {
+		if err := encode(w, r, http.StatusServiceUnavailable, map[string]string{
+			"status": "not ready",
+		}); err != nil {
+			app.logger.Error("Failed to encode JSON response", "error", err)
+		}
+		return
+	}
+
+	app.respondJSON(w, r, map[string]string{
+		"status": "ready",
 	})
 }
 
@@ -416,7 +1567,7 @@ func (app *Application) handleRoot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.Redirect(w, r, "/docs", http.StatusFound)
+	http.Redirect(w, r, app.basePath+"/docs", http.StatusFound)
 }
 
 func (app *Application) handleDocs(w http.ResponseWriter, r *http.Request) {
@@ -425,8 +1576,7 @@ func (app *Application) handleDocs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if _, err := w.Write(docsHTML); err != nil {
+	if err := app.docsAsset.serve(w, r); err != nil {
 		app.logger.Error("Failed to write docs response", slog.String("error", err.Error()))
 	}
 }
@@ -437,8 +1587,7 @@ func (app *Application) handleOpenAPISpec(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
-	if _, err := w.Write(openAPISpec); err != nil {
+	if err := app.specAsset.serve(w, r); err != nil {
 		app.logger.Error("Failed to write OpenAPI spec", slog.String("error", err.Error()))
 	}
 }
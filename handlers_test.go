@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleDifficultWordsPlainArray(t *testing.T) {
+	app := newTestApp(t)
+	client := newTestClient(t)
+
+	rec := serveAs(app.handleDifficultWords, client, httptest.NewRequest(http.MethodGet, "/api/v1/words/difficult?lang=ja&limit=3", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	var words []DifficultWord
+	if err := json.Unmarshal(rec.Body.Bytes(), &words); err != nil {
+		t.Fatalf("response is not a plain array: %v\n%s", err, rec.Body)
+	}
+	if len(words) != 3 {
+		t.Fatalf("got %d words, want 3 (the limit)", len(words))
+	}
+	for _, w := range words {
+		if w.TotalReviews < defaultDifficultMinReviews {
+			t.Errorf("%s has %d reviews, below the default minimum of %d", w.DictForm, w.TotalReviews, defaultDifficultMinReviews)
+		}
+	}
+}
+
+func TestHandleDifficultWordsPaginated(t *testing.T) {
+	// Four fixture words have at least 5 answered reviews, two of them in
+	// deck 1; the count runs over the grouped query with its HAVING filter.
+	tests := []struct {
+		name      string
+		query     string
+		wantTotal int
+		wantPage  int
+		wantPages int
+		wantNext  bool
+	}{
+		{"first page", "lang=ja&page=1&page_size=3", 4, 3, 2, true},
+		{"last page", "lang=ja&page=2&page_size=3", 4, 1, 2, false},
+		{"page_size only", "lang=ja&page_size=10", 4, 4, 1, false},
+		{"deck filter", "lang=ja&page=1&deckId=1", 2, 2, 1, false},
+		{"higher minReviews", "lang=ja&page=1&minReviews=7", 2, 2, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			client := newTestClient(t)
+
+			rec := serveAs(app.handleDifficultWords, client, httptest.NewRequest(http.MethodGet, "/api/v1/words/difficult?"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+
+			var resp struct {
+				Data       []DifficultWord `json:"data"`
+				Pagination PaginationMeta  `json:"pagination"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v\n%s", err, rec.Body)
+			}
+			if resp.Pagination.Total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", resp.Pagination.Total, tt.wantTotal)
+			}
+			if len(resp.Data) != tt.wantPage {
+				t.Errorf("got %d words on the page, want %d", len(resp.Data), tt.wantPage)
+			}
+			if resp.Pagination.TotalPages != tt.wantPages {
+				t.Errorf("total_pages = %d, want %d", resp.Pagination.TotalPages, tt.wantPages)
+			}
+			if resp.Pagination.HasNext != tt.wantNext {
+				t.Errorf("has_next = %v, want %v", resp.Pagination.HasNext, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestHandleDifficultWordsLimit(t *testing.T) {
+	tests := []struct {
+		limit      string
+		wantStatus int
+	}{
+		{"abc", http.StatusBadRequest},
+		{"0", http.StatusBadRequest},
+		{"-5", http.StatusBadRequest},
+		{"2.5", http.StatusBadRequest},
+		{"1", http.StatusOK},
+		{"10000000", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.limit, func(t *testing.T) {
+			app := newTestApp(t)
+			client := newTestClient(t)
+
+			rec := serveAs(app.handleDifficultWords, client, httptest.NewRequest(http.MethodGet, "/api/v1/words/difficult?lang=ja&limit="+tt.limit, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code != http.StatusBadRequest {
+				return
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.Code != "validation_failed" || resp.Fields["limit"] == "" {
+				t.Errorf("got code %q fields %v, want validation_failed on limit", resp.Code, resp.Fields)
+			}
+		})
+	}
+}
+
+func TestHandleDifficultWordsLimitClamped(t *testing.T) {
+	app := newTestApp(t)
+	client := newTestClient(t)
+
+	rec := serveAs(app.handleDifficultWords, client, httptest.NewRequest(http.MethodGet, "/api/v1/words/difficult?lang=ja&page=1&limit=10000000", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Pagination PaginationMeta `json:"pagination"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Pagination.PageSize != maxPageSize {
+		t.Errorf("page_size = %d, want the limit clamped to %d", resp.Pagination.PageSize, maxPageSize)
+	}
+}
+
+// TestWordStatsMatchStatusCounts checks /stats/words and /status/counts give
+// the same numbers for each deck and language. 本 also appears on a second
+// card in each deck, and an English word sits on a Japanese deck's card.
+func TestWordStatsMatchStatusCounts(t *testing.T) {
+	client := newTestClient(t,
+		`INSERT INTO card (id, deckId, cardTypeId, del, due, interval) VALUES (7, 1, 1, 0, 0, 0), (8, 2, 1, 0, 0, 0), (9, 1, 1, 0, 0, 0)`,
+		`INSERT INTO CardWordRelation VALUES (7, '本', 'ほん', 'NOUN', 'ja', 1, 0, 0, 0), (8, '本', 'ほん', 'NOUN', 'ja', 1, 0, 0, 0)`,
+		`INSERT INTO WordList VALUES ('book', '', 'NOUN', 'en', 0, 0, 0, 'KNOWN', 1, 0, 0, 1, 1, 0, 0)`,
+		`INSERT INTO CardWordRelation VALUES (9, 'book', '', 'NOUN', 'en', 1, 0, 0, 0)`,
+	)
+
+	tests := []struct {
+		query string
+		want  StatusCounts
+	}{
+		{"lang=ja", StatusCounts{KnownCount: 2, LearningCount: 2, UnknownCount: 1, IgnoredCount: 1}},
+		{"lang=ja&deckId=1", StatusCounts{KnownCount: 1, LearningCount: 1, UnknownCount: 1, IgnoredCount: 1}},
+		{"lang=ja&deckId=2", StatusCounts{KnownCount: 2, LearningCount: 1}},
+		{"lang=en&deckId=1", StatusCounts{KnownCount: 1}},
+		{"lang=en&deckId=2", StatusCounts{}},
+		{"lang=all&deckId=1", StatusCounts{KnownCount: 2, LearningCount: 1, UnknownCount: 1, IgnoredCount: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			app := newTestApp(t)
+
+			rec := serveAs(app.handleStatusCounts, client, httptest.NewRequest(http.MethodGet, "/api/v1/status/counts?"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status counts: status %d, body %s", rec.Code, rec.Body)
+			}
+			var counts []StatusCounts
+			if err := json.Unmarshal(rec.Body.Bytes(), &counts); err != nil || len(counts) != 1 {
+				t.Fatalf("status counts: decode %s: %v", rec.Body, err)
+			}
+
+			rec = serveAs(app.handleWordStats, client, httptest.NewRequest(http.MethodGet, "/api/v1/stats/words?"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("word stats: status %d, body %s", rec.Code, rec.Body)
+			}
+			var stats WordStats
+			if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+				t.Fatalf("word stats: decode %s: %v", rec.Body, err)
+			}
+
+			if StatusCounts(stats) != counts[0] {
+				t.Errorf("/stats/words = %+v, /status/counts = %+v", stats, counts[0])
+			}
+			if counts[0] != tt.want {
+				t.Errorf("counts = %+v, want %+v", counts[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlePatchWordStatus(t *testing.T) {
+	// 水 starts LEARNING and, for this test, tracked.
+	const tracked = `UPDATE WordList SET tracked = 1 WHERE dictForm = '水'`
+
+	tests := []struct {
+		name        string
+		body        string
+		wantStatus  string
+		wantTracked bool
+	}{
+		{"knownStatus only", `{"wordText":"水","language":"ja","knownStatus":"known"}`, dbStatusKnown, true},
+		{"tracked only", `{"wordText":"水","language":"ja","tracked":false}`, dbStatusLearning, false},
+		{"both", `{"wordText":"水","language":"ja","knownStatus":"ignored","tracked":false}`, dbStatusIgnored, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			fake := newFakeMigaku(t)
+			client, _ := newSyncingClient(t, fake, tracked)
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/words/status", strings.NewReader(tt.body))
+			rec := serveAs(app.handlePatchWordStatus, client, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+
+			words := pushedWords(t, fake)
+			if len(words) != 1 {
+				t.Fatalf("%d words pushed, want 1", len(words))
+			}
+			if words[0]["knownStatus"] != tt.wantStatus || words[0]["tracked"] != tt.wantTracked {
+				t.Errorf("pushed knownStatus %v, tracked %v; want %s, %v",
+					words[0]["knownStatus"], words[0]["tracked"], tt.wantStatus, tt.wantTracked)
+			}
+			if got := readLocalWord(t, client, "水"); got.KnownStatus != tt.wantStatus || got.Tracked != tt.wantTracked {
+				t.Errorf("local knownStatus %s, tracked %v; want %s, %v", got.KnownStatus, got.Tracked, tt.wantStatus, tt.wantTracked)
+			}
+		})
+	}
+}
+
+func TestHandlePatchWordStatusEmpty(t *testing.T) {
+	app := newTestApp(t)
+	fake := newFakeMigaku(t)
+	client, svc := newSyncingClient(t, fake)
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/words/status", strings.NewReader(`{"wordText":"水","language":"ja"}`))
+	rec := serveAs(app.handlePatchWordStatus, client, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400; body %s", rec.Code, rec.Body)
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Code != "validation_failed" || resp.Fields["knownStatus"] == "" {
+		t.Errorf("got code %q fields %v, want validation_failed on knownStatus", resp.Code, resp.Fields)
+	}
+
+	_, err := svc.PatchWordStatus(context.Background(), client, []WordStatusItem{{WordText: "水"}}, WordStatusPatch{}, "ja", WordStatusOptions{})
+	if !errors.Is(err, ErrEmptyPatch) {
+		t.Errorf("PatchWordStatus with an empty patch: err = %v, want ErrEmptyPatch", err)
+	}
+	if pushes := fake.recordedPushes(); len(pushes) != 0 {
+		t.Errorf("%d pushes sent for an empty patch", len(pushes))
+	}
+	if got := readLocalWord(t, client, "水"); got.KnownStatus != dbStatusLearning || got.Tracked {
+		t.Errorf("empty patch changed the local row: %+v", got)
+	}
+}
+
+func TestHandleResetWordStatusValidation(t *testing.T) {
+	tests := []struct {
+		body, field string
+	}{
+		{`{"language":"ja"}`, "wordText"},
+		{`{"wordText":"  ","language":"ja"}`, "wordText"},
+		{`{"items":[{"wordText":"水"},{"wordText":""}],"language":"ja"}`, "items[1].wordText"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			app := newTestApp(t)
+			fake := newFakeMigaku(t)
+			client, _ := newSyncingClient(t, fake)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/words/status/reset", strings.NewReader(tt.body))
+			rec := serveAs(app.handleResetWordStatus, client, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400; body %s", rec.Code, rec.Body)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.Code != "validation_failed" || resp.Fields[tt.field] == "" {
+				t.Errorf("got code %q fields %v, want validation_failed on %s", resp.Code, resp.Fields, tt.field)
+			}
+			if pushes := fake.recordedPushes(); len(pushes) != 0 {
+				t.Errorf("%d pushes sent for an invalid reset", len(pushes))
+			}
+		})
+	}
+}
+
+func TestHandleIntervalStatsPercentile(t *testing.T) {
+	tests := []struct {
+		query      string
+		wantStatus int
+	}{
+		{"", http.StatusOK},
+		{"&percentile=1", http.StatusOK},
+		{"&percentile=100", http.StatusOK},
+		{"&percentileId=75th", http.StatusOK},
+		{"&percentile=0", http.StatusBadRequest},
+		{"&percentile=101", http.StatusBadRequest},
+		{"&percentile=-1", http.StatusBadRequest},
+		{"&percentile=p90", http.StatusBadRequest},
+		{"&percentileId=0th", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		app := newTestApp(t)
+		client := newTestClient(t)
+		rec := serveAs(app.handleIntervalStats, client, httptest.NewRequest(http.MethodGet, "/api/v1/stats/intervals?lang=ja"+tt.query, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%q: status = %d, want %d; body %s", tt.query, rec.Code, tt.wantStatus, rec.Body)
+		}
+	}
+}
+
+// TestHandleDifficultWordsFieldErrors checks every malformed query parameter
+// is reported as a validation_failed field error, like limit.
+func TestHandleDifficultWordsFieldErrors(t *testing.T) {
+	tests := []struct {
+		query, field string
+	}{
+		{"minReviews=abc", "minReviews"},
+		{"minReviews=0", "minReviews"},
+		{"minReviews=-3", "minReviews"},
+		{"sinceDays=abc", "sinceDays"},
+		{"sinceDays=0", "sinceDays"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			app := newTestApp(t)
+			client := newTestClient(t)
+
+			rec := serveAs(app.handleDifficultWords, client, httptest.NewRequest(http.MethodGet, "/api/v1/words/difficult?lang=ja&"+tt.query, nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400; body %s", rec.Code, rec.Body)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.Code != "validation_failed" || resp.Fields[tt.field] == "" {
+				t.Errorf("got code %q fields %v, want validation_failed on %s", resp.Code, resp.Fields, tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultLabelLocale is used when a request asks for no supported locale.
+const defaultLabelLocale = "en"
+
+// labelLocale formats the dates that label a stats series. The day and
+// month patterns take, by index, the day of month, the abbreviated month
+// name, the year and the month number.
+type labelLocale struct {
+	months [12]string
+	day    string
+	month  string
+}
+
+// labelLocales covers English and the languages Migaku teaches, keyed by
+// primary language subtag.
+var labelLocales = map[string]labelLocale{
+	"en": {
+		months: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		day:    "%[2]s %[1]d, %[3]d",
+		month:  "%[2]s %[3]d",
+	},
+	"ja": {day: "%[3]d年%[4]d月%[1]d日", month: "%[3]d年%[4]d月"},
+	"zh": {day: "%[3]d年%[4]d月%[1]d日", month: "%[3]d年%[4]d月"},
+	"ko": {day: "%[3]d년 %[4]d월 %[1]d일", month: "%[3]d년 %[4]d월"},
+	"es": {
+		months: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		day:    "%[1]d %[2]s %[3]d",
+		month:  "%[2]s %[3]d",
+	},
+	"fr": {
+		months: [12]string{
+			"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc.",
+		},
+		day:   "%[1]d %[2]s %[3]d",
+		month: "%[2]s %[3]d",
+	},
+	"de": {
+		months: [12]string{
+			"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez.",
+		},
+		day:   "%[1]d. %[2]s %[3]d",
+		month: "%[2]s %[3]d",
+	},
+	"pt": {
+		months: [12]string{
+			"jan.", "fev.", "mar.", "abr.", "mai.", "jun.", "jul.", "ago.", "set.", "out.", "nov.", "dez.",
+		},
+		day:   "%[1]d de %[2]s de %[3]d",
+		month: "%[2]s de %[3]d",
+	},
+	"it": {
+		months: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		day:    "%[1]d %[2]s %[3]d",
+		month:  "%[2]s %[3]d",
+	},
+	"vi": {day: "%[1]d thg %[4]d, %[3]d", month: "thg %[4]d %[3]d"},
+}
+
+// ErrUnsupportedLocale is returned for a locale param with no label table.
+var ErrUnsupportedLocale = errors.New("unsupported locale")
+
+func (l labelLocale) format(pattern string, t time.Time) string {
+	return fmt.Sprintf(pattern, t.Day(), l.months[t.Month()-1], t.Year(), int(t.Month()))
+}
+
+// formatDay labels a single day, e.g. "Jan 2, 2006".
+func (l labelLocale) formatDay(t time.Time) string {
+	return l.format(l.day, t)
+}
+
+// formatMonth labels a whole month, e.g. "Jan 2006".
+func (l labelLocale) formatMonth(t time.Time) string {
+	return l.format(l.month, t)
+}
+
+// primaryLanguage returns the lower-cased primary subtag of a language tag,
+// e.g. "pt" for "pt-BR".
+func primaryLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
+
+// parseLocale resolves an explicit locale param such as "fr" or "pt-BR".
+func parseLocale(locale string) (string, error) {
+	lang := primaryLanguage(locale)
+	if _, ok := labelLocales[lang]; !ok {
+		return "", fmt.Errorf("%w: %q; use one of: %s", ErrUnsupportedLocale, locale,
+			strings.Join(slices.Sorted(maps.Keys(labelLocales)), ", "))
+	}
+	return lang, nil
+}
+
+// negotiateLocale picks the supported language an Accept-Language header
+// ranks highest, falling back to defaultLabelLocale. Ties go to the
+// earlier entry and malformed entries are skipped.
+func negotiateLocale(acceptLanguage string) string {
+	best, bestQ := defaultLabelLocale, 0.0
+	for entry := range strings.SplitSeq(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(entry, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		lang := primaryLanguage(tag)
+		if _, ok := labelLocales[lang]; ok && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
@@ -4,28 +4,86 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
+	_ "time/tzdata" // the runtime image ships without a zoneinfo database
 )
 
 type Application struct {
-	logger    *slog.Logger
-	cache     *Cache
-	service   *MigakuService
-	port      int
-	cors      []string
-	secretKey string
-
-	accounts map[string]*MigakuClient
+	logger  *slog.Logger
+	cache   *Cache
+	service *MigakuService
+	port    int
+	cors    []string
+	// corsMethods and corsHeaders are the comma-joined preflight allow lists.
+	corsMethods string
+	corsHeaders string
+	// secretKeys holds the API secrets; the first derives new API keys
+	// and the rest are still accepted while a rotation is in progress.
+	secretKeys []string
+	location   *time.Location
+
+	stalePolicy string
+
+	// basePath is the sub-path every route is mounted under, e.g. "/migoku";
+	// empty means the root.
+	basePath string
+
+	loginTimeout time.Duration
+
+	// warmCacheOnLogin precomputes an account's common queries right after
+	// it logs in.
+	warmCacheOnLogin bool
+
+	// refreshTTL is how often each account's database is downloaded again,
+	// separate from the cache TTL; zero disables background refreshes.
+	refreshTTL time.Duration
+
+	// maxBodyBytes caps POST and PATCH request bodies; zero means unlimited.
+	maxBodyBytes int64
+
+	// accountsMu guards accounts, which logins and logouts change while
+	// other requests look keys up.
+	accountsMu sync.RWMutex
+	accounts   map[string]*MigakuClient
+
+	// docsAsset and specAsset serve the embedded docs page and OpenAPI spec.
+	docsAsset *staticAsset
+	specAsset *staticAsset
+}
+
+var shortVersion, longVersion, _ = FromBuildInfo()
+
+// stopRefreshLoops cancels every account's background db refresh.
+func (app *Application) stopRefreshLoops() {
+	app.accountsMu.RLock()
+	defer app.accountsMu.RUnlock()
+	for _, client := range app.accounts {
+		if client != nil {
+			client.stopRefresh()
+		}
+	}
 }
 
-var _, longVersion, _ = FromBuildInfo()
+// closeAccounts closes every logged-in client, which deletes its local snapshot.
+func (app *Application) closeAccounts() {
+	app.accountsMu.Lock()
+	defer app.accountsMu.Unlock()
+	for apiKey, client := range app.accounts {
+		if client != nil {
+			client.Close()
+		}
+		delete(app.accounts, apiKey)
+	}
+}
 
 func main() {
 	logLevel := os.Getenv("LOG_LEVEL")
@@ -61,6 +119,25 @@ func realMain(logger *slog.Logger) error {
 		cors = strings.Split(corsOrigins, ",")
 		for i, origin := range cors {
 			cors[i] = strings.TrimSpace(origin)
+			if !validOriginPattern(cors[i]) {
+				logger.Error("Invalid CORS_ORIGINS value", "value", corsOrigins)
+				return fmt.Errorf("invalid CORS_ORIGINS value %q: %q must be *, an origin or a *.domain wildcard",
+					corsOrigins, cors[i])
+			}
+		}
+	}
+	corsMethods := defaultCORSMethods
+	if v := os.Getenv("CORS_METHODS"); v != "" {
+		if corsMethods, err = parseHeaderList(v, true); err != nil {
+			logger.Error("Invalid CORS_METHODS value", "value", v)
+			return fmt.Errorf("invalid CORS_METHODS value %q: %w", v, err)
+		}
+	}
+	corsHeaders := defaultCORSHeaders
+	if v := os.Getenv("CORS_HEADERS"); v != "" {
+		if corsHeaders, err = parseHeaderList(v, false); err != nil {
+			logger.Error("Invalid CORS_HEADERS value", "value", v)
+			return fmt.Errorf("invalid CORS_HEADERS value %q: %w", v, err)
 		}
 	}
 	cacheTTL := os.Getenv("CACHE_TTL")
@@ -75,69 +152,250 @@ func realMain(logger *slog.Logger) error {
 		}
 	}
 
+	location := time.Local
+	// Without REFRESH_TTL the database follows CACHE_TTL as it used to, but
+	// never more often than minRefreshTTL.
+	refreshTTL := cacheTTLDuration
+	if refreshTTL > 0 && refreshTTL < minRefreshTTL {
+		refreshTTL = minRefreshTTL
+	}
+	if v := strings.TrimSpace(os.Getenv("REFRESH_TTL")); v != "" {
+		refreshTTL, err = time.ParseDuration(v)
+		if err != nil || refreshTTL < 0 || (refreshTTL > 0 && refreshTTL < minRefreshTTL) {
+			logger.Error("Invalid REFRESH_TTL value", "value", v)
+			return fmt.Errorf("invalid REFRESH_TTL value %q: must be 0 or at least %s", v, minRefreshTTL)
+		}
+	}
+
+	if tz := os.Getenv("TIMEZONE"); tz != "" {
+		location, err = time.LoadLocation(tz)
+		if err != nil {
+			logger.Error("Invalid TIMEZONE value", "value", tz)
+			return fmt.Errorf("invalid TIMEZONE value: %w", err)
+		}
+	}
+
+	var loginTimeout time.Duration
+	if v := os.Getenv("LOGIN_TIMEOUT"); v != "" {
+		loginTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			logger.Error("Invalid LOGIN_TIMEOUT value", "value", v)
+			return fmt.Errorf("invalid LOGIN_TIMEOUT value: %w", err)
+		}
+	}
+
+	stalePolicy := strings.ToLower(strings.TrimSpace(os.Getenv("STALE_POLICY")))
+	switch stalePolicy {
+	case "":
+		stalePolicy = stalePolicyWarn
+	case stalePolicyWarn, stalePolicyFail, stalePolicyIgnore:
+	default:
+		logger.Error("Invalid STALE_POLICY value", "value", stalePolicy)
+		return fmt.Errorf("invalid STALE_POLICY value %q: must be one of warn, fail, ignore", stalePolicy)
+	}
+
+	defaultPeriodID, defaultPercentileNum, err := parseStatsDefaults(os.Getenv("DEFAULT_PERIOD"), os.Getenv("DEFAULT_PERCENTILE"))
+	if err != nil {
+		logger.Error("Invalid stats default", "error", err)
+		return err
+	}
+
+	if err := configureSQLitePragmas(os.Getenv("SQLITE_PRAGMAS")); err != nil {
+		logger.Error("Invalid SQLITE_PRAGMAS value", "error", err)
+		return fmt.Errorf("invalid SQLITE_PRAGMAS value: %w", err)
+	}
+
+	basePath, err := normalizeBasePath(os.Getenv("BASE_PATH"))
+	if err != nil {
+		logger.Error("Invalid BASE_PATH value", "value", os.Getenv("BASE_PATH"))
+		return fmt.Errorf("invalid BASE_PATH value: %w", err)
+	}
+
+	if v := strings.TrimSpace(os.Getenv("MAX_CONCURRENT_DOWNLOADS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			logger.Error("Invalid MAX_CONCURRENT_DOWNLOADS value", "value", v)
+			return fmt.Errorf("invalid MAX_CONCURRENT_DOWNLOADS value %q: must be a non-negative integer", v)
+		}
+		configureDownloadConcurrency(n)
+	}
+
+	if v := strings.TrimSpace(os.Getenv("REFRESH_JITTER")); v != "" {
+		fraction, err := strconv.ParseFloat(v, 64)
+		if err == nil {
+			err = configureRefreshJitter(fraction)
+		}
+		if err != nil {
+			logger.Error("Invalid REFRESH_JITTER value", "value", v)
+			return fmt.Errorf("invalid REFRESH_JITTER value %q: %w", v, err)
+		}
+	}
+
+	if v := strings.TrimSpace(os.Getenv("MAX_DOWNLOAD_SIZE_MB")); v != "" {
+		mb, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || mb < 0 || mb > 1<<30 {
+			logger.Error("Invalid MAX_DOWNLOAD_SIZE_MB value", "value", v)
+			return fmt.Errorf("invalid MAX_DOWNLOAD_SIZE_MB value %q: must be a non-negative integer", v)
+		}
+		configureMaxDownloadSize(mb)
+	}
+
+	maxBodyKB := int64(defaultMaxBodyKB)
+	if v := strings.TrimSpace(os.Getenv("MAX_REQUEST_BODY_KB")); v != "" {
+		maxBodyKB, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || maxBodyKB < 0 || maxBodyKB > 1<<40 {
+			logger.Error("Invalid MAX_REQUEST_BODY_KB value", "value", v)
+			return fmt.Errorf("invalid MAX_REQUEST_BODY_KB value %q: must be a non-negative integer", v)
+		}
+	}
+
+	auditLogSize := defaultAuditLogSize
+	if v := strings.TrimSpace(os.Getenv("AUDIT_LOG_SIZE")); v != "" {
+		auditLogSize, err = strconv.Atoi(v)
+		if err != nil || auditLogSize < 0 {
+			logger.Error("Invalid AUDIT_LOG_SIZE value", "value", v)
+			return fmt.Errorf("invalid AUDIT_LOG_SIZE value %q: must be a non-negative integer", v)
+		}
+	}
+	var auditLogOut io.Writer
+	if path := strings.TrimSpace(os.Getenv("AUDIT_LOG_FILE")); path != "" {
+		//nolint:gosec // The path comes from the operator's configuration.
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			logger.Error("Failed to open AUDIT_LOG_FILE", "path", path, "error", err)
+			return fmt.Errorf("failed to open AUDIT_LOG_FILE %q: %w", path, err)
+		}
+		defer func() { _ = f.Close() }()
+		auditLogOut = f
+	}
+
+	var warmCacheOnLogin bool
+	if v := strings.TrimSpace(os.Getenv("WARM_CACHE_ON_LOGIN")); v != "" {
+		warmCacheOnLogin, err = strconv.ParseBool(v)
+		if err != nil {
+			logger.Error("Invalid WARM_CACHE_ON_LOGIN value", "value", v)
+			return fmt.Errorf("invalid WARM_CACHE_ON_LOGIN value %q: must be a boolean", v)
+		}
+	}
+
+	if v := strings.TrimSpace(os.Getenv("LOG_QUERY_PARAMS")); v != "" {
+		logQueryParams, err = strconv.ParseBool(v)
+		if err != nil {
+			logger.Error("Invalid LOG_QUERY_PARAMS value", "value", v)
+			return fmt.Errorf("invalid LOG_QUERY_PARAMS value %q: must be a boolean", v)
+		}
+	}
+
+	if v := os.Getenv("DEV_TABLES_ALLOW"); v != "" {
+		if exposedTables.allow, err = parseTablePatterns(v); err != nil {
+			logger.Error("Invalid DEV_TABLES_ALLOW value", "value", v)
+			return fmt.Errorf("invalid DEV_TABLES_ALLOW value %q: %w", v, err)
+		}
+	}
+	// Unlike most settings an empty DEV_TABLES_DENY counts, so the default
+	// can be cleared to list SQLite's own tables too.
+	if v, ok := os.LookupEnv("DEV_TABLES_DENY"); ok {
+		if exposedTables.deny, err = parseTablePatterns(v); err != nil {
+			logger.Error("Invalid DEV_TABLES_DENY value", "value", v)
+			return fmt.Errorf("invalid DEV_TABLES_DENY value %q: %w", v, err)
+		}
+	}
+
+	if v := strings.TrimSpace(os.Getenv("SLOW_QUERY_THRESHOLD")); v != "" {
+		slowQueryThreshold, err = time.ParseDuration(v)
+		if err != nil || slowQueryThreshold < 0 {
+			logger.Error("Invalid SLOW_QUERY_THRESHOLD value", "value", v)
+			return fmt.Errorf("invalid SLOW_QUERY_THRESHOLD value %q: must be a non-negative duration", v)
+		}
+	}
+
+	if err := configureOutboundIdentity(
+		strings.TrimSpace(os.Getenv("OUTBOUND_USER_AGENT")),
+		strings.TrimSpace(os.Getenv("OUTBOUND_CLIENT_ID")),
+	); err != nil {
+		logger.Error("Invalid OUTBOUND_USER_AGENT or OUTBOUND_CLIENT_ID value", "error", err)
+		return fmt.Errorf("invalid outbound identity: %w", err)
+	}
+
+	if err := configureOutboundProxy(os.Getenv("OUTBOUND_PROXY")); err != nil {
+		logger.Error("Invalid OUTBOUND_PROXY value", "error", err)
+		return fmt.Errorf("invalid OUTBOUND_PROXY value: %w", err)
+	}
+
 	cache := NewCache(cacheTTLDuration)
 
-	secretKey := os.Getenv("API_SECRET")
-	if secretKey == "" {
+	var secretKeys []string
+	for secret := range strings.SplitSeq(os.Getenv("API_SECRET"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secretKeys = append(secretKeys, secret)
+		}
+	}
+	if len(secretKeys) == 0 {
 		return errors.New("API_SECRET environment variable is required")
 	}
 
 	logger.Info("Initializing client session...")
 
 	app := &Application{
-		port:      portInt,
-		cors:      cors,
-		cache:     cache,
-		logger:    logger,
-		secretKey: secretKey,
-		accounts:  make(map[string]*MigakuClient),
+		port:       portInt,
+		cors:       cors,
+		cache:      cache,
+		logger:     logger,
+		secretKeys: secretKeys,
+		location:   location,
+		accounts:   make(map[string]*MigakuClient),
+
+		corsMethods: corsMethods,
+		corsHeaders: corsHeaders,
+
+		stalePolicy:  stalePolicy,
+		loginTimeout: loginTimeout,
+		refreshTTL:   refreshTTL,
+		basePath:     basePath,
+		maxBodyBytes: maxBodyKB << 10,
+
+		warmCacheOnLogin: warmCacheOnLogin,
 	}
 
+	if app.docsAsset, err = newStaticAsset("text/html; charset=utf-8", docsHTML); err != nil {
+		return fmt.Errorf("failed to prepare docs page: %w", err)
+	}
+	spec := openAPISpec
+	if basePath != "" {
+		spec = withServerURL(spec, basePath)
+	}
+	if app.specAsset, err = newStaticAsset("application/yaml; charset=utf-8", spec); err != nil {
+		return fmt.Errorf("failed to prepare OpenAPI spec: %w", err)
+	}
+
+	sweepStaleDBFiles(logger, staleDBFileAge)
+
 	repo := NewRepository()
 	app.service = NewMigakuService(repo, cache)
+	app.service.defaultPeriod = defaultPeriodID
+	app.service.defaultPercentile = defaultPercentileNum
+	app.service.audit = newAuditLog(auditLogSize, auditLogOut)
 
 	logger.Info("Login complete, client ready for queries")
 
 	//--- Start HTTP server ---
-	chainMiddlewares := func(handler http.HandlerFunc, middlewares ...func(http.HandlerFunc) http.HandlerFunc) http.HandlerFunc {
-		for i := len(middlewares) - 1; i >= 0; i-- {
-			handler = middlewares[i](handler)
-		}
-		return handler
-	}
-
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", app.handleRoot)
-	mux.HandleFunc("GET /docs", app.handleDocs)
-	mux.HandleFunc("GET /openapi.yaml", app.handleOpenAPISpec)
-	mux.HandleFunc("POST /auth/login", app.handleLogin)
-	mux.HandleFunc("POST /auth/logout", chainMiddlewares(app.handleLogout, app.authMiddleware))
-
-	v1 := http.NewServeMux()
-	v1.HandleFunc("GET /words", chainMiddlewares(app.handleWords, app.authMiddleware))
-	v1.HandleFunc("POST /words/status", chainMiddlewares(app.handleSetWordStatus, app.authMiddleware))
-	v1.HandleFunc("GET /decks", chainMiddlewares(app.handleDecks, app.authMiddleware))
-	v1.HandleFunc("GET /status/counts", chainMiddlewares(app.handleStatusCounts, app.authMiddleware))
-	v1.HandleFunc("GET /words/difficult", chainMiddlewares(app.handleDifficultWords, app.authMiddleware))
-	v1.HandleFunc("GET /stats/words", chainMiddlewares(app.handleWordStats, app.authMiddleware))
-	v1.HandleFunc("GET /stats/due", chainMiddlewares(app.handleDueStats, app.authMiddleware))
-	v1.HandleFunc("GET /stats/intervals", chainMiddlewares(app.handleIntervalStats, app.authMiddleware))
-	v1.HandleFunc("GET /stats/study", chainMiddlewares(app.handleStudyStats, app.authMiddleware))
-	mux.Handle("/api/v1/", http.StripPrefix("/api/v1", v1))
-
-	dev := http.NewServeMux()
-	dev.HandleFunc("GET /status", app.handleStatus)
-	dev.HandleFunc("POST /cache/clear", app.handleClearCache)
-	dev.HandleFunc("GET /database/schema", chainMiddlewares(app.handleDatabaseSchema, app.authMiddleware))
-	dev.HandleFunc("GET /database/tables", chainMiddlewares(app.handleTables, app.authMiddleware))
-	mux.Handle("/dev/", http.StripPrefix("/dev", dev))
-
-	logger.Info("Server starting", "url", "http://localhost:"+port)
+	logger.Info("Server starting", "url", "http://localhost:"+port+basePath)
 	logger.Info("Cache TTL", "ttl", cache.ttl.String())
+	logger.Info("Refresh TTL", "ttl", refreshTTL.String())
+	logger.Info("Timezone", "location", location.String())
+
+	root, probes, routes := app.routes()
+	undocumented, unserved := routes.diffSpec(openAPISpec)
+	for _, route := range undocumented {
+		logger.Warn("Route missing from openapi.yaml", "route", route)
+	}
+	for _, operation := range unserved {
+		logger.Warn("openapi.yaml documents a route that isn't served", "route", operation)
+	}
 
 	server := &http.Server{
 		Addr:              ":" + port,
-		Handler:           app.corsHandler(mux),
+		Handler:           mountBasePath(basePath, root, probes),
 		ReadHeaderTimeout: 30 * time.Second,
 		ReadTimeout:       60 * time.Second,
 		WriteTimeout:      60 * time.Second,
@@ -160,17 +418,39 @@ func realMain(logger *slog.Logger) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	for _, client := range app.accounts {
-		if client != nil {
-			client.Close()
-		}
-	}
+	// Background refreshes are cancelled as soon as shutdown begins, while
+	// in-flight requests drain; the snapshots are closed once they're done.
+	server.RegisterOnShutdown(app.stopRefreshLoops)
+
+	shutdownErr := server.Shutdown(ctx)
+	app.closeAccounts()
 
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Error("Server forced to shutdown", "error", err)
-		return fmt.Errorf("server forced to shutdown: %w", err)
+	if shutdownErr != nil {
+		logger.Error("Server forced to shutdown", "error", shutdownErr)
+		return fmt.Errorf("server forced to shutdown: %w", shutdownErr)
 	}
 
 	logger.Info("Server exited")
 	return nil
 }
+
+// parseStatsDefaults validates DEFAULT_PERIOD and DEFAULT_PERCENTILE, either
+// of which may be empty to keep the built-in default.
+func parseStatsDefaults(period, percentile string) (string, int, error) {
+	periodID := strings.TrimSpace(period)
+	if periodID == "" {
+		periodID = defaultPeriod
+	} else if _, _, err := parsePeriod(periodID); err != nil {
+		return "", 0, fmt.Errorf("invalid DEFAULT_PERIOD value %q: %w", periodID, err)
+	}
+
+	percentileNum := defaultPercentile
+	if v := strings.TrimSpace(percentile); v != "" {
+		n, err := parsePercentile(v)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid DEFAULT_PERCENTILE value %q: %w", v, err)
+		}
+		percentileNum = n
+	}
+	return periodID, percentileNum, nil
+}
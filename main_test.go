@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseStatsDefaults(t *testing.T) {
+	tests := []struct {
+		period, percentile string
+		wantPeriod         string
+		wantPercentile     int
+		wantErr            error
+	}{
+		{"", "", defaultPeriod, defaultPercentile, nil},
+		{"   ", " ", defaultPeriod, defaultPercentile, nil},
+		{"3 Months", "", "3 Months", defaultPercentile, nil},
+		{" All time ", "90", "All time", 90, nil},
+		{"", "1", defaultPeriod, 1, nil},
+		{"", "100", defaultPeriod, 100, nil},
+		{"", "80th", defaultPeriod, 80, nil},
+		{"1 week", "", "", 0, ErrInvalidPeriod},
+		{"0 Months", "", "", 0, ErrInvalidPeriod},
+		{"", "0", "", 0, ErrInvalidPercentile},
+		{"", "101", "", 0, ErrInvalidPercentile},
+		{"", "p90", "", 0, ErrInvalidPercentile},
+	}
+	for _, tt := range tests {
+		period, percentile, err := parseStatsDefaults(tt.period, tt.percentile)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("parseStatsDefaults(%q, %q) error = %v, want %v", tt.period, tt.percentile, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || period != tt.wantPeriod || percentile != tt.wantPercentile {
+			t.Errorf("parseStatsDefaults(%q, %q) = %q, %d, %v; want %q, %d",
+				tt.period, tt.percentile, period, percentile, err, tt.wantPeriod, tt.wantPercentile)
+		}
+	}
+}
+
+func TestStatsDefaultPeriod(t *testing.T) {
+	client := newTestClient(t)
+	svc := NewMigakuService(NewRepository(), NewCache(time.Minute))
+	svc.defaultPeriod = "3 Months"
+	ctx := context.Background()
+	today := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	days := func(periodID string) int {
+		t.Helper()
+		stats, err := svc.GetStudyStats(ctx, client, "ja", "", periodID, nil, today, time.UTC, StudyStatsOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stats.PeriodDays
+	}
+	// Periods run from the same date months back through today.
+	if got := days(""); got != 93 {
+		t.Errorf("unset period covers %d days, want the default 3 Months (Mar 30 to Jun 30, 93)", got)
+	}
+	if got := days("1 Month"); got != 32 {
+		t.Errorf("periodId 1 Month covers %d days, want May 30 to Jun 30 (32)", got)
+	}
+}
@@ -1,8 +1,28 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// stalePolicyWarn serves stale snapshots with a Warning header.
+	stalePolicyWarn = "warn"
+	// stalePolicyFail rejects reads from stale snapshots with 503.
+	stalePolicyFail = "fail"
+	// stalePolicyIgnore serves stale snapshots as if they were fresh.
+	stalePolicyIgnore = "ignore"
+)
+
+// Default CORS_METHODS and CORS_HEADERS.
+const (
+	defaultCORSMethods = "GET, HEAD, POST, PATCH, OPTIONS"
+	defaultCORSHeaders = "Content-Type, X-Api-Key, Authorization, X-Debug"
 )
 
 // corsHandler wraps the top-level mux so that OPTIONS preflight requests
@@ -13,13 +33,18 @@ func (app *Application) corsHandler(next http.Handler) http.Handler {
 		if len(app.cors) == 0 || (len(app.cors) == 1 && app.cors[0] == "*") {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 		} else {
+			// The allowed origin depends on the request's, so caches must
+			// key on it.
+			w.Header().Add("Vary", "Origin")
 			origin := r.Header.Get("Origin")
-			if slices.Contains(app.cors, origin) {
+			if origin != "" && slices.ContainsFunc(app.cors, func(pattern string) bool {
+				return matchOrigin(pattern, origin)
+			}) {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 			}
 		}
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Api-Key, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", app.corsMethods)
+		w.Header().Set("Access-Control-Allow-Headers", app.corsHeaders)
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
@@ -27,3 +52,165 @@ func (app *Application) corsHandler(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// matchOrigin reports whether origin, e.g. "https://app.example.com", is
+// allowed by a CORS_ORIGINS entry. An entry is "*", an exact origin, or a
+// wildcard such as "*.example.com" or "https://*.example.com" that matches
+// any subdomain at any depth but not example.com itself. A wildcard without
+// a scheme allows any scheme; neither kind matches an origin with a port
+// unless the entry names it.
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" || strings.EqualFold(pattern, origin) {
+		return true
+	}
+	patternScheme, patternHost, hasScheme := strings.Cut(pattern, "://")
+	if !hasScheme {
+		patternScheme, patternHost = "", pattern
+	}
+	suffix, ok := strings.CutPrefix(patternHost, "*.")
+	if !ok {
+		return false
+	}
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok || (patternScheme != "" && !strings.EqualFold(scheme, patternScheme)) {
+		return false
+	}
+	host = strings.ToLower(host)
+	suffix = "." + strings.ToLower(suffix)
+	return len(host) > len(suffix) && strings.HasSuffix(host, suffix)
+}
+
+// validOriginPattern reports whether a CORS_ORIGINS entry is "*", an origin
+// without wildcards, or a wildcard that only replaces the leading labels of
+// the host.
+func validOriginPattern(pattern string) bool {
+	if pattern == "" {
+		return false
+	}
+	if pattern == "*" {
+		return true
+	}
+	host := pattern
+	if _, h, ok := strings.Cut(pattern, "://"); ok {
+		host = h
+	}
+	host = strings.TrimPrefix(host, "*.")
+	return host != "" && !strings.Contains(host, "*")
+}
+
+// parseHeaderList splits a comma-separated CORS_METHODS or CORS_HEADERS
+// value and joins it back in the form the response headers use. Entries
+// must be HTTP tokens; methods are upper-cased.
+func parseHeaderList(value string, methods bool) (string, error) {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !isHTTPToken(item) {
+			return "", fmt.Errorf("%q is not a valid name", item)
+		}
+		if methods {
+			item = strings.ToUpper(item)
+		}
+		if !slices.Contains(items, item) {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return "", errors.New("list is empty")
+	}
+	return strings.Join(items, ", "), nil
+}
+
+// isHTTPToken reports whether s is an RFC 9110 token, the syntax of both
+// method and header names.
+func isHTTPToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && !strings.ContainsRune("!#$%&'*+-.^_`|~", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// freshnessMiddleware flags reads served from a snapshot that has not been
+// refreshed for several TTLs, so a silently frozen db doesn't look healthy.
+// It must run after authMiddleware.
+func (app *Application) freshnessMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, ok := clientFromContext(r.Context())
+		if !ok || app.stalePolicy == stalePolicyIgnore {
+			next(w, r)
+			return
+		}
+
+		status := client.refreshStatus()
+		if !status.IsStale() {
+			next(w, r)
+			return
+		}
+
+		age := status.Age().Truncate(time.Second)
+		if app.stalePolicy == stalePolicyFail {
+			app.writeJSONError(w, r, http.StatusServiceUnavailable, "Local database is stale")
+			return
+		}
+
+		w.Header().Set("Warning", `110 migoku "Response is Stale"`)
+		w.Header().Set("X-Snapshot-Age", strconv.Itoa(int(age.Seconds())))
+		next(w, r)
+	}
+}
+
+// defaultMaxBodyKB caps POST bodies unless MAX_REQUEST_BODY_KB says
+// otherwise.
+const defaultMaxBodyKB = 1024
+
+// bodyLimitMiddleware caps the request body at app.maxBodyBytes. A declared
+// Content-Length over the cap is refused with 413 straight away; a body that
+// only turns out too large while being read makes decode fail with
+// ErrBodyTooLarge, which handlers also answer with 413.
+func (app *Application) bodyLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.maxBodyBytes <= 0 {
+			next(w, r)
+			return
+		}
+		if r.ContentLength > app.maxBodyBytes {
+			app.writeJSONError(w, r, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("%s: limit is %d bytes", ErrBodyTooLarge, app.maxBodyBytes))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, app.maxBodyBytes)
+		next(w, r)
+	}
+}
+
+// readinessMiddleware answers 503 with Retry-After while an account's local
+// snapshot isn't open yet, rather than letting the request wait on the
+// download. It must run after authMiddleware.
+func (app *Application) readinessMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, ok := clientFromContext(r.Context())
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		if err := client.ensureDBReady(); err != nil {
+			if errors.Is(err, ErrDBNotReady) {
+				app.writeNotReady(w, r)
+				return
+			}
+			app.writeJSONError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern, origin string
+		want            bool
+	}{
+		{"*", "https://anything.test", true},
+
+		{"https://app.example.com", "https://app.example.com", true},
+		{"https://app.example.com", "https://APP.Example.com", true},
+		{"https://app.example.com", "http://app.example.com", false},
+		{"https://app.example.com", "https://other.example.com", false},
+		{"https://app.example.com", "https://app.example.com:8443", false},
+		{"https://app.example.com:8443", "https://app.example.com:8443", true},
+
+		{"*.example.com", "https://a.example.com", true},
+		{"*.example.com", "http://a.example.com", true},
+		{"*.example.com", "https://a.b.example.com", true},
+		{"*.example.com", "https://A.Example.COM", true},
+		{"*.EXAMPLE.com", "https://a.example.com", true},
+		{"*.example.com", "https://example.com", false},
+		{"*.example.com", "https://evilexample.com", false},
+		{"*.example.com", "https://a.example.com.evil.test", false},
+		{"*.example.com", "https://a.example.com:8443", false},
+		{"*.example.com", "a.example.com", false},
+		{"*.example.com", "", false},
+
+		{"https://*.example.com", "https://a.example.com", true},
+		{"HTTPS://*.example.com", "https://a.example.com", true},
+		{"https://*.example.com", "http://a.example.com", false},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com:8443", "https://a.example.com:8443", true},
+		{"https://*.example.com:8443", "https://a.example.com", false},
+		{"https://*.example.com:8443", "https://a.example.com:9443", false},
+	}
+	for _, tt := range tests {
+		if got := matchOrigin(tt.pattern, tt.origin); got != tt.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestValidOriginPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"*", true},
+		{"https://app.example.com", true},
+		{"https://app.example.com:8443", true},
+		{"*.example.com", true},
+		{"https://*.example.com", true},
+		{"https://*.example.com:8443", true},
+		{"", false},
+		{"*.", false},
+		{"https://*.", false},
+		{"app.*.example.com", false},
+		{"https://*.*.example.com", false},
+		{"https://app.example.*", false},
+		{"**.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := validOriginPattern(tt.pattern); got != tt.want {
+			t.Errorf("validOriginPattern(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestCORSHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		cors      []string
+		origin    string
+		wantAllow string
+		wantVary  bool
+	}{
+		{"any origin", nil, "https://a.example.com", "*", false},
+		{"star", []string{"*"}, "https://a.example.com", "*", false},
+		{"wildcard match", []string{"*.example.com"}, "https://a.example.com", "https://a.example.com", true},
+		{"wildcard match keeps the origin's case", []string{"*.example.com"}, "https://A.Example.com", "https://A.Example.com", true},
+		{"bare domain", []string{"*.example.com"}, "https://example.com", "", true},
+		{"lookalike domain", []string{"*.example.com"}, "https://evilexample.com", "", true},
+		{"port not listed", []string{"*.example.com"}, "https://a.example.com:8443", "", true},
+		{"port listed", []string{"https://a.example.com:8443"}, "https://a.example.com:8443", "https://a.example.com:8443", true},
+		{"second entry", []string{"https://one.test", "*.example.com"}, "https://a.example.com", "https://a.example.com", true},
+		{"no origin", []string{"*.example.com"}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.cors = tt.cors
+			app.corsMethods = "GET, POST"
+			app.corsHeaders = "Content-Type"
+			handler := app.corsHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			for _, method := range []string{http.MethodGet, http.MethodOptions} {
+				req := httptest.NewRequest(method, "/api/v1/words", nil)
+				if tt.origin != "" {
+					req.Header.Set("Origin", tt.origin)
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllow {
+					t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", method, got, tt.wantAllow)
+				}
+				if got := slices.Contains(rec.Header().Values("Vary"), "Origin"); got != tt.wantVary {
+					t.Errorf("%s: Vary: Origin set = %v, want %v", method, got, tt.wantVary)
+				}
+				if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+					t.Errorf("%s: Access-Control-Allow-Methods = %q", method, got)
+				}
+			}
+		})
+	}
+}
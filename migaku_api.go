@@ -10,6 +10,7 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,11 +24,116 @@ const (
 	migakuPresignedURLService = "https://srs-db-presigned-url-service-api.migaku.com/db-force-sync-download-url"
 )
 
+// ErrInvalidCredentials is returned when Firebase rejects the email/password
+// pair, as opposed to the sign-in request itself failing.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// ErrDownloadUnauthorized is returned when Migaku refuses the download URL
+// request even after a token refresh.
+var ErrDownloadUnauthorized = errors.New("database download unauthorized")
+
+// ErrDownloadTooLarge is returned when the database download, compressed or
+// decompressed, exceeds maxDownloadBytes.
+var ErrDownloadTooLarge = errors.New("database download too large")
+
+// ErrSyncUnavailable is returned when a push couldn't reach the sync server,
+// or the server answered that it is down, as opposed to rejecting the push.
+var ErrSyncUnavailable = errors.New("sync server unavailable")
+
+// defaultMaxDownloadMB caps the database download unless MAX_DOWNLOAD_SIZE_MB
+// says otherwise.
+const defaultMaxDownloadMB = 1024
+
+// maxDownloadBytes bounds both the downloaded body and its decompressed
+// size, so a broken or hostile download URL can't exhaust memory. Zero means
+// unlimited. It is set once at startup.
+var maxDownloadBytes int64 = defaultMaxDownloadMB << 20
+
+// configureMaxDownloadSize caps database downloads at mb mebibytes; zero
+// lifts the cap.
+func configureMaxDownloadSize(mb int64) {
+	maxDownloadBytes = mb << 20
+}
+
+// readLimited reads r to the end, failing with ErrDownloadTooLarge once more
+// than maxDownloadBytes have been read.
+func readLimited(r io.Reader, what string) ([]byte, error) {
+	if maxDownloadBytes <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxDownloadBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxDownloadBytes {
+		return nil, fmt.Errorf("%w: %s exceeds %d bytes", ErrDownloadTooLarge, what, maxDownloadBytes)
+	}
+	return data, nil
+}
+
 var (
-	defaultHTTPClient  = &http.Client{Timeout: 30 * time.Second}
-	downloadHTTPClient = &http.Client{} // no timeout; rely on context for cancellation
+	defaultHTTPClient  = &http.Client{Timeout: 30 * time.Second, Transport: newOutboundTransport(nil)}
+	downloadHTTPClient = &http.Client{Transport: newOutboundTransport(nil)} // no timeout; rely on context for cancellation
 )
 
+// outboundUserAgent and outboundClientID identify this server on requests to
+// Google and Migaku. They are set once at startup.
+var (
+	outboundUserAgent = "migoku/" + shortVersion
+	outboundClientID  string
+)
+
+// configureOutboundIdentity overrides the User-Agent sent to Google and
+// Migaku and sets an X-Client-Id header; empty values keep the defaults.
+func configureOutboundIdentity(userAgent, clientID string) error {
+	if strings.ContainsAny(userAgent, "\r\n") || strings.ContainsAny(clientID, "\r\n") {
+		return errors.New("header values must not contain line breaks")
+	}
+	if userAgent != "" {
+		outboundUserAgent = userAgent
+	}
+	outboundClientID = clientID
+	return nil
+}
+
+// setOutboundHeaders adds the identifying headers to an outbound request.
+func setOutboundHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", outboundUserAgent)
+	if outboundClientID != "" {
+		req.Header.Set("X-Client-Id", outboundClientID)
+	}
+}
+
+// newOutboundTransport returns a transport for requests to Google and Migaku.
+// An explicit proxyURL takes precedence; otherwise HTTPS_PROXY, HTTP_PROXY
+// and NO_PROXY from the environment apply.
+func newOutboundTransport(proxyURL *url.URL) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return transport
+}
+
+// configureOutboundProxy routes the auth/sync and database download clients
+// through proxy. An empty proxy keeps the environment-based defaults.
+func configureOutboundProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return fmt.Errorf("invalid proxy url: %w", err)
+	}
+	if proxyURL.Scheme == "" || proxyURL.Host == "" {
+		return fmt.Errorf("invalid proxy url %q: scheme and host are required", proxy)
+	}
+	defaultHTTPClient.Transport = newOutboundTransport(proxyURL)
+	downloadHTTPClient.Transport = newOutboundTransport(proxyURL)
+	return nil
+}
+
 type FirebaseAuthToken struct {
 	mu           sync.Mutex
 	refreshToken string
@@ -58,7 +164,7 @@ type MigakuWord struct {
 }
 
 type migakuSyncPayload struct {
-	Decks             []any            `json:"decks"`
+	Decks             []map[string]any `json:"decks"`
 	CardTypes         []any            `json:"cardTypes"`
 	Cards             []any            `json:"cards"`
 	CardWordRelations []any            `json:"cardWordRelations"`
@@ -95,6 +201,9 @@ func TryFromEmailPassword(ctx context.Context, email, password string) (*Firebas
 		return nil, err
 	}
 	if status != http.StatusOK {
+		if status == http.StatusBadRequest && isCredentialsError(respBody) {
+			return nil, ErrInvalidCredentials
+		}
 		return nil, fmt.Errorf("login failed (%d): %s", status, string(respBody))
 	}
 
@@ -119,6 +228,27 @@ func TryFromEmailPassword(ctx context.Context, email, password string) (*Firebas
 	}, nil
 }
 
+// isCredentialsError reports whether a Firebase sign-in error body blames the
+// supplied email or password.
+func isCredentialsError(respBody []byte) bool {
+	var res struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(respBody, &res); err != nil {
+		return false
+	}
+	// Messages may carry a suffix, e.g. "INVALID_PASSWORD : ...".
+	code, _, _ := strings.Cut(res.Error.Message, " ")
+	switch code {
+	case "INVALID_LOGIN_CREDENTIALS", "INVALID_PASSWORD", "EMAIL_NOT_FOUND", "INVALID_EMAIL", "USER_DISABLED":
+		return true
+	default:
+		return false
+	}
+}
+
 func (t *FirebaseAuthToken) get(ctx context.Context) (string, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -180,6 +310,9 @@ func (s *MigakuSession) ForceDownloadSRSDB(ctx context.Context) ([]byte, error)
 	if err != nil {
 		return nil, err
 	}
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		return nil, fmt.Errorf("%w (%d): %s", ErrDownloadUnauthorized, status, string(respBody))
+	}
 	if status != http.StatusOK {
 		return nil, fmt.Errorf("failed to fetch download url (%d): %s", status, string(respBody))
 	}
@@ -195,34 +328,68 @@ func (s *MigakuSession) ForceDownloadSRSDB(ctx context.Context) ([]byte, error)
 	if err != nil {
 		return nil, err
 	}
+	setOutboundHeaders(req)
 	resp, err := downloadHTTPClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
 		return nil, fmt.Errorf("failed to download database (%d): %s", resp.StatusCode, string(bodyBytes))
 	}
+	if maxDownloadBytes > 0 && resp.ContentLength > maxDownloadBytes {
+		return nil, fmt.Errorf("%w: download is %d bytes, limit is %d", ErrDownloadTooLarge, resp.ContentLength, maxDownloadBytes)
+	}
 
-	compressed, err := io.ReadAll(resp.Body)
+	raw, err := readLimited(resp.Body, "download")
 	if err != nil {
 		return nil, err
 	}
-	slog.Default().Debug("Downloaded compressed database", "bytes", len(compressed))
+	slog.Default().Info("Downloaded database", "bytes", len(raw))
+
+	return maybeGunzip(raw)
+}
+
+// maybeGunzip decompresses data if it starts with the gzip magic bytes and
+// returns it unchanged otherwise, so an uncompressed snapshot still loads.
+func maybeGunzip(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		slog.Default().Debug("Database is not gzipped; using it as-is")
+		return data, nil
+	}
 
-	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	zr, err := gzip.NewReader(bytes.NewReader(data))
 	if err != nil {
 		return nil, err
 	}
 	defer zr.Close()
 
-	data, err := io.ReadAll(zr)
+	decompressed, err := readLimited(zr, "decompressed database")
 	if err != nil {
 		return nil, err
 	}
-	slog.Default().Debug("Decompressed database", "bytes", len(data))
-	return data, nil
+	slog.Default().Info("Decompressed database", "compressed_bytes", len(data), "bytes", len(decompressed))
+	return decompressed, nil
+}
+
+// newSyncPayload returns a sync payload with every section empty, for the
+// caller to fill in the sections it changes.
+func newSyncPayload() migakuSyncPayload {
+	return migakuSyncPayload{
+		Decks:             []map[string]any{},
+		CardTypes:         []any{},
+		Cards:             []any{},
+		CardWordRelations: []any{},
+		Vacations:         []any{},
+		Reviews:           []any{},
+		Words:             []map[string]any{},
+		Config:            nil,
+		KeyValue:          []any{},
+		LearningMaterials: []any{},
+		Lessons:           []any{},
+		ReviewHistory:     []any{},
+	}
 }
 
 func (s *MigakuSession) PushSync(ctx context.Context, words []map[string]any) error {
@@ -236,28 +403,52 @@ func (s *MigakuSession) PushSync(ctx context.Context, words []map[string]any) er
 
 	slog.Default().Debug("Pushing word status updates", "count", len(words))
 
-	payload := migakuSyncPayload{
-		Decks:             []any{},
-		CardTypes:         []any{},
-		Cards:             []any{},
-		CardWordRelations: []any{},
-		Vacations:         []any{},
-		Reviews:           []any{},
-		Words:             words,
-		Config:            nil,
-		KeyValue:          []any{},
-		LearningMaterials: []any{},
-		Lessons:           []any{},
-		ReviewHistory:     []any{},
+	payload := newSyncPayload()
+	payload.Words = words
+	return s.PushSyncPayload(ctx, payload)
+}
+
+// PushDeckSync pushes changed deck rows, each the full local row with the
+// edited fields, in the decks section of the sync payload.
+func (s *MigakuSession) PushDeckSync(ctx context.Context, decks []map[string]any) error {
+	if s.auth == nil {
+		return errors.New("missing auth token")
 	}
 
-	url := fmt.Sprintf("%s/sync?clientSessionId=%d", migakuSyncServerURL, time.Now().UnixMilli())
+	if len(decks) == 0 {
+		return errors.New("no decks to sync")
+	}
+
+	slog.Default().Debug("Pushing deck updates", "count", len(decks))
+
+	payload := newSyncPayload()
+	payload.Decks = append(payload.Decks, decks...)
+	return s.PushSyncPayload(ctx, payload)
+}
 
-	respBody, status, err := s.doAuthorizedJSONRequest(ctx, http.MethodPut, url, payload)
+// PushSyncPayload sends payload to the sync server. Start from
+// newSyncPayload so untouched sections go as empty arrays, which the server
+// expects, rather than null.
+func (s *MigakuSession) PushSyncPayload(ctx context.Context, payload migakuSyncPayload) error {
+	if s.auth == nil {
+		return errors.New("missing auth token")
+	}
+
+	syncURL := fmt.Sprintf("%s/sync?clientSessionId=%d", migakuSyncServerURL, time.Now().UnixMilli())
+
+	respBody, status, err := s.doAuthorizedJSONRequest(ctx, http.MethodPut, syncURL, payload)
 	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) && ctx.Err() == nil {
+			return fmt.Errorf("%w: %w", ErrSyncUnavailable, err)
+		}
 		return err
 	}
-	if status != http.StatusOK {
+	switch status {
+	case http.StatusOK:
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return fmt.Errorf("%w: push failed (%d): %s", ErrSyncUnavailable, status, string(respBody))
+	default:
 		return fmt.Errorf("push failed (%d): %s", status, string(respBody))
 	}
 
@@ -314,6 +505,7 @@ func doJSONRequest(
 	if err != nil {
 		return nil, 0, err
 	}
+	setOutboundHeaders(req)
 	if payload != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
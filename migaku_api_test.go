@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMigaku stands in for Google's token endpoint, the presigned URL
+// service, the snapshot download and the sync server. While a test runs,
+// every outbound request is routed to it whatever host it was meant for.
+type fakeMigaku struct {
+	server *httptest.Server
+
+	mu sync.Mutex
+	// snapshot is the body the download serves.
+	snapshot []byte
+	// urlStatuses are the statuses of successive presigned URL requests;
+	// once they run out the request succeeds.
+	urlStatuses []int
+	// pushStatus is the status the sync server answers; zero means 200.
+	pushStatus int
+
+	tokenRefreshes int
+	urlFetches     int
+	downloads      int
+	pushes         []recordedPush
+}
+
+// recordedPush is a request the fake sync server received.
+type recordedPush struct {
+	url    *url.URL
+	header http.Header
+	body   []byte
+}
+
+func newFakeMigaku(t *testing.T) *fakeMigaku {
+	t.Helper()
+
+	f := &fakeMigaku{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/token", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.tokenRefreshes++
+		f.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "refreshed-token", "expires_in": "3600"})
+	})
+	mux.HandleFunc("GET /db-force-sync-download-url", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.urlFetches++
+		status := http.StatusOK
+		if len(f.urlStatuses) > 0 {
+			status, f.urlStatuses = f.urlStatuses[0], f.urlStatuses[1:]
+		}
+		f.mu.Unlock()
+		if status != http.StatusOK {
+			http.Error(w, "token expired", status)
+			return
+		}
+		_, _ = io.WriteString(w, f.server.URL+"/snapshot.db.gz\n")
+	})
+	mux.HandleFunc("GET /snapshot.db.gz", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.downloads++
+		body := f.snapshot
+		f.mu.Unlock()
+		_, _ = w.Write(body)
+	})
+	mux.HandleFunc("PUT /sync", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		f.pushes = append(f.pushes, recordedPush{url: r.URL, header: r.Header.Clone(), body: body})
+		status := f.pushStatus
+		f.mu.Unlock()
+		if status != 0 && status != http.StatusOK {
+			http.Error(w, "push failed", status)
+			return
+		}
+		_, _ = io.WriteString(w, "{}")
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+
+	target, _ := url.Parse(f.server.URL)
+	reroute := rerouteTransport{target: target, base: f.server.Client().Transport}
+	defaultTransport, downloadTransport := defaultHTTPClient.Transport, downloadHTTPClient.Transport
+	defaultHTTPClient.Transport, downloadHTTPClient.Transport = reroute, reroute
+	t.Cleanup(func() {
+		defaultHTTPClient.Transport, downloadHTTPClient.Transport = defaultTransport, downloadTransport
+	})
+	return f
+}
+
+// session returns a session whose token is valid for another hour.
+func (f *fakeMigaku) session() *MigakuSession {
+	return NewMigakuSession(&FirebaseAuthToken{
+		refreshToken: "refresh-token",
+		authToken:    "auth-token",
+		expiresAt:    time.Now().Add(time.Hour),
+	})
+}
+
+func (f *fakeMigaku) counts() (urlFetches, downloads, tokenRefreshes int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.urlFetches, f.downloads, f.tokenRefreshes
+}
+
+func (f *fakeMigaku) recordedPushes() []recordedPush {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]recordedPush(nil), f.pushes...)
+}
+
+// rerouteTransport sends every request to target, keeping its path and
+// query.
+type rerouteTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t rerouteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host, r.Host = t.target.Scheme, t.target.Host, t.target.Host
+	return t.base.RoundTrip(r)
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newDownloadingClient returns a client on session that downloads into a
+// fresh temp dir, without a snapshot yet.
+func newDownloadingClient(t *testing.T, session *MigakuSession) *MigakuClient {
+	t.Helper()
+	c := &MigakuClient{
+		logger:     discardLogger(),
+		session:    session,
+		dbPath:     filepath.Join(t.TempDir(), "migaku-test.db"),
+		key:        "test",
+		refreshNow: make(chan struct{}, 1),
+	}
+	t.Cleanup(c.closeDB)
+	return c
+}
+
+func TestRefreshDBDecodesSnapshot(t *testing.T) {
+	snapshot, err := os.ReadFile(newFixtureDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"gzipped", gzipBytes(t, snapshot)},
+		{"plain", snapshot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeMigaku(t)
+			fake.snapshot = tt.body
+			client := newDownloadingClient(t, fake.session())
+
+			if err := client.refreshDB(context.Background()); err != nil {
+				t.Fatalf("refreshDB: %v", err)
+			}
+
+			got, err := os.ReadFile(client.dbPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, snapshot) {
+				t.Fatalf("local snapshot is %d bytes, want the %d-byte fixture", len(got), len(snapshot))
+			}
+			counts, err := NewMigakuService(NewRepository(), NewCache(time.Minute)).GetStatusCounts(context.Background(), client, "ja", "")
+			if err != nil {
+				t.Fatalf("query the downloaded snapshot: %v", err)
+			}
+			if counts.KnownCount != 2 || counts.LearningCount != 2 {
+				t.Errorf("status counts = %+v, want 2 known and 2 learning", counts)
+			}
+		})
+	}
+}
+
+func TestMaybeGunzip(t *testing.T) {
+	plain := []byte("SQLite format 3\x00rest of the file")
+	for _, tt := range []struct {
+		name string
+		in   []byte
+	}{
+		{"gzipped", gzipBytes(t, plain)},
+		{"plain", plain},
+	} {
+		got, err := maybeGunzip(tt.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, plain)
+		}
+	}
+
+	// Too short to carry the magic bytes, so passed through.
+	for _, in := range [][]byte{nil, {0x1f}} {
+		if got, err := maybeGunzip(in); err != nil || !bytes.Equal(got, in) {
+			t.Errorf("maybeGunzip(%x) = %x, %v; want the input back", in, got, err)
+		}
+	}
+	// The magic bytes followed by something that isn't gzip.
+	for _, in := range [][]byte{{0x1f, 0x8b}, append([]byte{0x1f, 0x8b}, "not gzip"...)} {
+		if _, err := maybeGunzip(in); err == nil {
+			t.Errorf("maybeGunzip(%x) accepted a corrupt gzip stream", in)
+		}
+	}
+}
+
+func TestRefreshDBRejectsOversizedDownload(t *testing.T) {
+	defer func(limit int64) { maxDownloadBytes = limit }(maxDownloadBytes)
+	configureMaxDownloadSize(1) // MAX_DOWNLOAD_SIZE_MB=1
+
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"plain body over the cap", bytes.Repeat([]byte{'x'}, 1<<20+1)},
+		{"gzip that decompresses past the cap", gzipBytes(t, make([]byte, 2<<20))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeMigaku(t)
+			fake.snapshot = tt.body
+			client := newDownloadingClient(t, fake.session())
+
+			err := client.refreshDB(context.Background())
+			if !errors.Is(err, ErrDownloadTooLarge) {
+				t.Fatalf("refreshDB error = %v, want ErrDownloadTooLarge", err)
+			}
+			entries, err := os.ReadDir(filepath.Dir(client.dbPath))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				t.Errorf("%s left behind after a rejected download", entry.Name())
+			}
+			if client.hasDB() {
+				t.Error("client opened a snapshot from a rejected download")
+			}
+		})
+	}
+}
+
+func TestReadLimited(t *testing.T) {
+	defer func(limit int64) { maxDownloadBytes = limit }(maxDownloadBytes)
+	maxDownloadBytes = 8
+
+	if data, err := readLimited(bytes.NewReader(make([]byte, 8)), "body"); err != nil || len(data) != 8 {
+		t.Errorf("body at the cap: %d bytes, %v; want all 8", len(data), err)
+	}
+	if _, err := readLimited(bytes.NewReader(make([]byte, 9)), "body"); !errors.Is(err, ErrDownloadTooLarge) {
+		t.Errorf("body over the cap: err = %v, want ErrDownloadTooLarge", err)
+	}
+
+	maxDownloadBytes = 0
+	if data, err := readLimited(bytes.NewReader(make([]byte, 1<<16)), "body"); err != nil || len(data) != 1<<16 {
+		t.Errorf("no cap: %d bytes, %v; want all of it", len(data), err)
+	}
+}
+
+func TestRefreshDBRetriesUnauthorizedOnce(t *testing.T) {
+	snapshot, err := os.ReadFile(newFixtureDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeMigaku(t)
+	fake.snapshot = gzipBytes(t, snapshot)
+	fake.urlStatuses = []int{http.StatusUnauthorized}
+	client := newDownloadingClient(t, fake.session())
+
+	if err := client.refreshDB(context.Background()); err != nil {
+		t.Fatalf("refreshDB after one 401: %v", err)
+	}
+	urlFetches, downloads, tokenRefreshes := fake.counts()
+	if urlFetches != 2 || downloads != 1 || tokenRefreshes != 1 {
+		t.Errorf("got %d URL fetches, %d downloads and %d token refreshes; want 2, 1 and 1",
+			urlFetches, downloads, tokenRefreshes)
+	}
+	if !client.hasDB() {
+		t.Error("no snapshot opened after the retried download")
+	}
+}
+
+func TestRefreshDBSurfacesPersistentUnauthorized(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			fake := newFakeMigaku(t)
+			fake.urlStatuses = slices.Repeat([]int{status}, 10)
+			client := newDownloadingClient(t, fake.session())
+
+			err := client.refreshDB(context.Background())
+			if !errors.Is(err, ErrDownloadUnauthorized) {
+				t.Fatalf("refreshDB error = %v, want ErrDownloadUnauthorized", err)
+			}
+			// Each ForceDownloadSRSDB tries the URL twice around a token
+			// refresh, and downloadSnapshot runs it twice around another.
+			urlFetches, downloads, tokenRefreshes := fake.counts()
+			if urlFetches != 4 || downloads != 0 || tokenRefreshes != 3 {
+				t.Errorf("got %d URL fetches, %d downloads and %d token refreshes; want 4, 0 and 3",
+					urlFetches, downloads, tokenRefreshes)
+			}
+			if client.hasDB() {
+				t.Error("client opened a snapshot after the download was refused")
+			}
+		})
+	}
+}
+
+func TestPushSyncPayloadShape(t *testing.T) {
+	word := map[string]any{"dictForm": "水", "knownStatus": "KNOWN", "mod": float64(1700000000000)}
+	deck := map[string]any{"id": float64(1), "name": "Core"}
+	review := map[string]any{"cardId": float64(1), "type": float64(2)}
+
+	reviewsPayload := newSyncPayload()
+	reviewsPayload.Reviews = append(reviewsPayload.Reviews, review)
+
+	tests := []struct {
+		name string
+		push func(ctx context.Context, s *MigakuSession) error
+		// want holds the sections expected to be non-empty.
+		want map[string][]any
+	}{
+		{"PushSync", func(ctx context.Context, s *MigakuSession) error {
+			return s.PushSync(ctx, []map[string]any{word})
+		}, map[string][]any{"words": {word}}},
+		{"PushDeckSync", func(ctx context.Context, s *MigakuSession) error {
+			return s.PushDeckSync(ctx, []map[string]any{deck})
+		}, map[string][]any{"decks": {deck}}},
+		{"PushSyncPayload", func(ctx context.Context, s *MigakuSession) error {
+			return s.PushSyncPayload(ctx, reviewsPayload)
+		}, map[string][]any{"reviews": {review}}},
+	}
+	sections := []string{
+		"decks", "cardTypes", "cards", "cardWordRelations", "vacations", "reviews",
+		"words", "keyValue", "learningMaterials", "lessons", "reviewHistory",
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeMigaku(t)
+			if err := tt.push(context.Background(), fake.session()); err != nil {
+				t.Fatalf("push: %v", err)
+			}
+			pushes := fake.recordedPushes()
+			if len(pushes) != 1 {
+				t.Fatalf("%d pushes, want 1", len(pushes))
+			}
+			push := pushes[0]
+
+			if _, err := strconv.ParseInt(push.url.Query().Get("clientSessionId"), 10, 64); err != nil {
+				t.Errorf("clientSessionId = %q, want a millisecond timestamp", push.url.Query().Get("clientSessionId"))
+			}
+			if got := push.header.Get("Authorization"); got != "Bearer auth-token" {
+				t.Errorf("Authorization = %q", got)
+			}
+			if got := push.header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q", got)
+			}
+
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(push.body, &body); err != nil {
+				t.Fatalf("decode body %s: %v", push.body, err)
+			}
+			if len(body) != len(sections)+1 {
+				t.Errorf("body has %d keys, want %d: %s", len(body), len(sections)+1, push.body)
+			}
+			if got := string(body["config"]); got != "null" {
+				t.Errorf("config = %s, want null", got)
+			}
+			for _, section := range sections {
+				raw, ok := body[section]
+				if !ok {
+					t.Errorf("section %s missing", section)
+					continue
+				}
+				var got []any
+				if err := json.Unmarshal(raw, &got); err != nil || got == nil {
+					t.Errorf("section %s = %s, want a JSON array", section, raw)
+					continue
+				}
+				want := tt.want[section]
+				if want == nil {
+					want = []any{}
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("section %s = %v, want %v", section, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPushSyncRejectsEmpty(t *testing.T) {
+	fake := newFakeMigaku(t)
+	session := fake.session()
+	if err := session.PushSync(context.Background(), nil); err == nil {
+		t.Error("PushSync accepted no words")
+	}
+	if err := session.PushDeckSync(context.Background(), nil); err == nil {
+		t.Error("PushDeckSync accepted no decks")
+	}
+	if pushes := fake.recordedPushes(); len(pushes) != 0 {
+		t.Errorf("%d pushes sent for empty updates", len(pushes))
+	}
+}
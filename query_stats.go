@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Debug mode: a request sent with "X-Debug: true" gets the number of db
+// queries it ran and the time spent in them back as response headers.
+const (
+	debugHeader      = "X-Debug"
+	queryCountHeader = "X-Query-Count"
+	dbTimeHeader     = "X-DB-Time-Ms"
+)
+
+type queryStatsContextKey struct{}
+
+// queryStats counts the db queries run for one request. Batch requests run
+// their queries concurrently, hence the atomics.
+type queryStats struct {
+	count atomic.Int64
+	nanos atomic.Int64
+}
+
+func queryStatsFromContext(ctx context.Context) *queryStats {
+	stats, _ := ctx.Value(queryStatsContextKey{}).(*queryStats)
+	return stats
+}
+
+// trackQuery adds a query that started at start to the request's stats,
+// when the request collects them. Time waiting for the db lock counts, as
+// it is part of what the request spent on the query.
+func trackQuery(ctx context.Context, start time.Time) {
+	stats := queryStatsFromContext(ctx)
+	if stats == nil {
+		return
+	}
+	stats.count.Add(1)
+	stats.nanos.Add(int64(time.Since(start)))
+}
+
+// queryStatsWriter sets the stats headers just before the response headers
+// are written, once the handler's queries have all run.
+type queryStatsWriter struct {
+	http.ResponseWriter
+	stats       *queryStats
+	wroteHeader bool
+}
+
+func (w *queryStatsWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		h.Set(queryCountHeader, strconv.FormatInt(w.stats.count.Load(), 10))
+		ms := float64(w.stats.nanos.Load()) / float64(time.Millisecond)
+		h.Set(dbTimeHeader, strconv.FormatFloat(ms, 'f', 2, 64))
+		h.Add("Access-Control-Expose-Headers", queryCountHeader+", "+dbTimeHeader)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *queryStatsWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *queryStatsWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// queryStatsHandler collects query stats for requests in debug mode and
+// leaves every other request untouched.
+func (app *Application) queryStatsHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if debug, _ := strconv.ParseBool(r.Header.Get(debugHeader)); !debug {
+			next.ServeHTTP(w, r)
+			return
+		}
+		stats := &queryStats{}
+		ctx := context.WithValue(r.Context(), queryStatsContextKey{}, stats)
+		next.ServeHTTP(&queryStatsWriter{ResponseWriter: w, stats: stats}, r.WithContext(ctx))
+	})
+}
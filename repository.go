@@ -3,6 +3,9 @@ package main
 import (
 	"context"
 	"fmt"
+	"path"
+	"slices"
+	"strings"
 )
 
 // wordRow represents a word row from the WordList table
@@ -10,12 +13,28 @@ type wordRow struct {
 	DictForm    string `db:"dictForm"    json:"dictForm"`
 	Secondary   string `db:"secondary"   json:"secondary"`
 	KnownStatus string `db:"knownStatus" json:"knownStatus,omitempty"`
+	Created     int64  `db:"created"     json:"created,omitempty"`
+	Mod         int64  `db:"mod"         json:"mod,omitempty"`
+}
+
+// wordChangeRow represents a WordList row modified after a point in time,
+// including soft-deleted words
+type wordChangeRow struct {
+	DictForm     string `db:"dictForm"     json:"dictForm"`
+	Secondary    string `db:"secondary"    json:"secondary"`
+	PartOfSpeech string `db:"partOfSpeech" json:"partOfSpeech"`
+	Language     string `db:"language"     json:"language"`
+	KnownStatus  string `db:"knownStatus"  json:"knownStatus"`
+	Mod          int64  `db:"mod"          json:"mod"`
+	Del          bool   `db:"del"          json:"del"`
 }
 
 // deckRow represents a deck row from the deck table
 type deckRow struct {
-	ID   int    `db:"id"   json:"id"`
-	Name string `db:"name" json:"name"`
+	ID        int    `db:"id"        json:"id"`
+	Name      string `db:"name"      json:"name"`
+	CardCount *int   `db:"cardCount" json:"cardCount,omitempty"`
+	WordCount *int   `db:"wordCount" json:"wordCount,omitempty"`
 }
 
 // tableRow represents a table name from sqlite_master
@@ -23,14 +42,42 @@ type tableRow struct {
 	Name string `db:"name" json:"name"`
 }
 
+// keyValueRow represents a row of the keyValue settings table
+type keyValueRow struct {
+	Key   string `db:"key"   json:"key"`
+	Entry string `db:"entry" json:"entry"`
+}
+
 // statusCountRow represents a single row from the GROUP BY query
 type statusCountRow struct {
 	Status string `db:"status" json:"status"`
 	Count  int    `db:"count"  json:"count"`
 }
 
+type partOfSpeechCountRow struct {
+	PartOfSpeech string `db:"partOfSpeech" json:"partOfSpeech"`
+	Status       string `db:"status"       json:"status"`
+	Count        int    `db:"count"        json:"count"`
+}
+
 const deckIDClause = " AND c.deckId = ?"
 
+// wordInDeckClause limits WordList w to words linked to a live card in the
+// deck bound to its placeholder. It matches the full word key, like
+// wordFilterQuery, and counts a word once however many of its cards are in
+// the deck.
+const wordInDeckClause = `
+  AND EXISTS (
+    SELECT 1
+    FROM CardWordRelation cwr
+    JOIN card c ON cwr.cardId = c.id
+    WHERE cwr.dictForm = w.dictForm
+      AND cwr.secondary = w.secondary
+      AND cwr.partOfSpeech = w.partOfSpeech
+      AND cwr.language = w.language
+      AND c.del = 0` + deckIDClause + `
+  )`
+
 // Repository handles database operations
 type Repository struct{}
 
@@ -39,24 +86,15 @@ func NewRepository() *Repository {
 	return &Repository{}
 }
 
-// GetWords retrieves words from WordList with optional filters
-// status can be empty for all words, or "KNOWN", "LEARNING", etc.
-// limit can be 0 for no limit
-func (r *Repository) GetWords(
-	ctx context.Context,
-	client *MigakuClient,
-	lang, status string,
-	limit int,
-	deckID string,
-	form string,
-	formExact bool,
-	offset int,
-) ([]wordRow, error) {
+// wordFilterQuery builds the FROM/WHERE fragment shared by GetWords and
+// CountWords so the two can never disagree on which rows match.
+// filter.Status must already be a database status ("KNOWN", "LEARNING", ...).
+func wordFilterQuery(filter WordFilter) (string, []any) {
 	var query string
 	var params []any
 
-	if deckID != "" {
-		query = `SELECT DISTINCT w.dictForm, w.secondary, w.knownStatus
+	if filter.DeckID != "" {
+		query = `
 			FROM WordList w
 			JOIN CardWordRelation cwr
 				ON w.dictForm = cwr.dictForm
@@ -65,46 +103,62 @@ func (r *Repository) GetWords(
 				AND w.language = cwr.language
 			JOIN card c ON cwr.cardId = c.id
 			WHERE w.del = 0 AND c.del = 0 AND c.deckId = ?`
-		params = append(params, deckID)
+		params = append(params, filter.DeckID)
 	} else {
-		query = "SELECT dictForm, secondary, knownStatus FROM WordList WHERE del = 0"
+		query = " FROM WordList w WHERE w.del = 0"
 	}
 
-	if lang != "" {
-		if deckID != "" {
-			query += " AND w.language = ?"
-		} else {
-			query += languageFilterClause
-		}
-		params = append(params, lang)
+	if filter.Lang != "" {
+		query += " AND w.language = ?"
+		params = append(params, filter.Lang)
 	}
 
-	if status != "" {
-		if deckID != "" {
-			query += " AND w.knownStatus = ?"
-		} else {
-			query += " AND knownStatus = ?"
-		}
-		params = append(params, status)
+	if filter.Status != "" {
+		query += " AND w.knownStatus = ?"
+		params = append(params, filter.Status)
+	} else if !filter.IncludeIgnored {
+		query += " AND w.knownStatus IS NOT 'IGNORED'"
 	}
 
-	if form != "" {
-		match := form
+	if filter.Form != "" {
+		match := filter.Form
 		operator := "LIKE"
-		if formExact {
+		if filter.FormExact {
 			operator = "="
 		} else {
-			match = "%" + form + "%"
+			match = "%" + filter.Form + "%"
 		}
 
-		if deckID != "" {
-			query += " AND (w.dictForm " + operator + " ? OR w.secondary " + operator + " ?)"
-		} else {
-			query += " AND (dictForm " + operator + " ? OR secondary " + operator + " ?)"
-		}
+		query += " AND (w.dictForm " + operator + " ? OR w.secondary " + operator + " ?)"
 		params = append(params, match, match)
 	}
 
+	if filter.SinceCreated > 0 {
+		query += " AND w.created > ?"
+		params = append(params, filter.SinceCreated)
+	}
+
+	return query, params
+}
+
+// GetWords retrieves words from WordList with optional filters
+// filter.Status can be empty for all words, or "KNOWN", "LEARNING", etc.
+// limit can be 0 for no limit
+func (r *Repository) GetWords(
+	ctx context.Context,
+	client *MigakuClient,
+	filter WordFilter,
+	limit, offset int,
+) ([]wordRow, error) {
+	from, params := wordFilterQuery(filter)
+
+	query := "SELECT"
+	if filter.DeckID != "" {
+		query += " DISTINCT"
+	}
+	query += ` w.dictForm, w.secondary, w.knownStatus,
+				COALESCE(w.created, 0) AS created, COALESCE(w.mod, 0) AS mod` + from
+
 	if limit > 0 {
 		query += " LIMIT ? OFFSET ?"
 		params = append(params, limit, offset)
@@ -120,69 +174,46 @@ func (r *Repository) GetWords(
 	return words, nil
 }
 
-// CountWords counts total words matching the filters
-func (r *Repository) CountWords(
+// GetRandomWords samples up to count words matching the filters
+func (r *Repository) GetRandomWords(
 	ctx context.Context,
 	client *MigakuClient,
-	lang, status string,
-	deckID string,
-	form string,
-	formExact bool,
-) (int, error) {
-	var query string
-	var params []any
+	filter WordFilter,
+	count int,
+) ([]wordRow, error) {
+	from, params := wordFilterQuery(filter)
 
-	if deckID != "" {
-		query = `SELECT COUNT(DISTINCT w.dictForm || w.secondary || w.partOfSpeech || w.language)
-			FROM WordList w
-			JOIN CardWordRelation cwr
-				ON w.dictForm = cwr.dictForm
-				AND w.secondary = cwr.secondary
-				AND w.partOfSpeech = cwr.partOfSpeech
-				AND w.language = cwr.language
-			JOIN card c ON cwr.cardId = c.id
-			WHERE w.del = 0 AND c.del = 0 AND c.deckId = ?`
-		params = append(params, deckID)
-	} else {
-		query = "SELECT COUNT(*) FROM WordList WHERE del = 0"
+	query := "SELECT"
+	if filter.DeckID != "" {
+		query += " DISTINCT"
 	}
+	query += ` w.dictForm, w.secondary, w.knownStatus,
+				COALESCE(w.created, 0) AS created, COALESCE(w.mod, 0) AS mod` + from + `
+			ORDER BY RANDOM() LIMIT ?;`
+	params = append(params, count)
 
-	if lang != "" {
-		if deckID != "" {
-			query += " AND w.language = ?"
-		} else {
-			query += languageFilterClause
-		}
-		params = append(params, lang)
+	words, err := runQuery[wordRow](ctx, client, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get random words: %w", err)
 	}
 
-	if status != "" {
-		if deckID != "" {
-			query += " AND w.knownStatus = ?"
-		} else {
-			query += " AND knownStatus = ?"
-		}
-		params = append(params, status)
-	}
+	return words, nil
+}
 
-	if form != "" {
-		match := form
-		operator := "LIKE"
-		if formExact {
-			operator = "="
-		} else {
-			match = "%" + form + "%"
-		}
+// CountWords counts total words matching the filters
+func (r *Repository) CountWords(
+	ctx context.Context,
+	client *MigakuClient,
+	filter WordFilter,
+) (int, error) {
+	from, params := wordFilterQuery(filter)
 
-		if deckID != "" {
-			query += " AND (w.dictForm " + operator + " ? OR w.secondary " + operator + " ?)"
-		} else {
-			query += " AND (dictForm " + operator + " ? OR secondary " + operator + " ?)"
-		}
-		params = append(params, match, match)
+	query := "SELECT COUNT(*)"
+	if filter.DeckID != "" {
+		// A word linked to several cards in the deck joins once per card.
+		query = "SELECT COUNT(DISTINCT w.dictForm || w.secondary || w.partOfSpeech || w.language)"
 	}
-
-	query += ";"
+	query += from + ";"
 
 	row, err := runReadRow(ctx, client, query, params...)
 	if err != nil {
@@ -201,10 +232,94 @@ func (r *Repository) CountWords(
 	return 0, nil
 }
 
-// GetDecks retrieves all active decks
-func (r *Repository) GetDecks(ctx context.Context, client *MigakuClient) ([]deckRow, error) {
-	query := "SELECT id, name FROM deck WHERE del = 0 ORDER BY name;"
-	decks, err := runQuery[deckRow](ctx, client, query)
+// GetWordChanges retrieves words modified after since (epoch millis).
+// Unlike GetWords it keeps deleted rows so mirrors can drop them.
+func (r *Repository) GetWordChanges(
+	ctx context.Context,
+	client *MigakuClient,
+	lang string,
+	since int64,
+) ([]wordChangeRow, error) {
+	query := `SELECT dictForm, secondary, partOfSpeech, language, knownStatus,
+			COALESCE(mod, 0) AS mod, del != 0 AS del
+		FROM WordList WHERE mod > ?`
+	params := []any{since}
+
+	if lang != "" {
+		query += languageFilterClause
+		params = append(params, lang)
+	}
+
+	query += " ORDER BY mod;"
+
+	words, err := runQuery[wordChangeRow](ctx, client, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get word changes: %w", err)
+	}
+
+	return words, nil
+}
+
+// deckFilterQuery builds the WHERE fragment shared by GetDecks and
+// CountDecks.
+func deckFilterQuery(filter DeckFilter) (string, []any) {
+	query := " WHERE d.del = 0"
+	var params []any
+
+	if filter.Lang != "" {
+		query += " AND d.lang = ?"
+		params = append(params, filter.Lang)
+	}
+
+	if filter.Search != "" {
+		query += " AND d.name LIKE ?"
+		params = append(params, "%"+filter.Search+"%")
+	}
+
+	return query, params
+}
+
+// GetDecks retrieves active decks matching the filter, ordered by name. A
+// non-positive limit returns every match.
+func (r *Repository) GetDecks(
+	ctx context.Context,
+	client *MigakuClient,
+	filter DeckFilter,
+	limit, offset int,
+) ([]deckRow, error) {
+	where, params := deckFilterQuery(filter)
+
+	query := "SELECT d.id, d.name FROM deck d"
+	if filter.WithCounts {
+		// Both counts are aggregated per deck before joining so neither
+		// multiplies the other; a word on several cards counts once.
+		query = `SELECT d.id, d.name,
+				COALESCE(cc.count, 0) AS cardCount, COALESCE(wc.count, 0) AS wordCount
+			FROM deck d
+			LEFT JOIN (
+				SELECT deckId, COUNT(*) AS count FROM card WHERE del = 0 GROUP BY deckId
+			) cc ON cc.deckId = d.id
+			LEFT JOIN (
+				SELECT c.deckId,
+					COUNT(DISTINCT w.dictForm || w.secondary || w.partOfSpeech || w.language) AS count
+				FROM card c
+				JOIN CardWordRelation cwr ON cwr.cardId = c.id
+				JOIN WordList w
+					ON w.dictForm = cwr.dictForm
+					AND w.secondary = cwr.secondary
+					AND w.partOfSpeech = cwr.partOfSpeech
+					AND w.language = cwr.language
+				WHERE c.del = 0 AND w.del = 0
+				GROUP BY c.deckId
+			) wc ON wc.deckId = d.id`
+	}
+	query += where + " ORDER BY d.name"
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		params = append(params, limit, offset)
+	}
+
+	decks, err := runQuery[deckRow](ctx, client, query+";", params...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get decks: %w", err)
 	}
@@ -212,23 +327,51 @@ func (r *Repository) GetDecks(ctx context.Context, client *MigakuClient) ([]deck
 	return decks, nil
 }
 
+// CountDecks counts active decks matching the filter
+func (r *Repository) CountDecks(ctx context.Context, client *MigakuClient, filter DeckFilter) (int, error) {
+	where, params := deckFilterQuery(filter)
+
+	type countRow struct {
+		Count int `db:"count"`
+	}
+
+	rows, err := runQuery[countRow](ctx, client, "SELECT COUNT(*) AS count FROM deck d"+where+";", params...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count decks: %w", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return rows[0].Count, nil
+}
+
+// GetLanguages lists the languages the account has words in
+func (r *Repository) GetLanguages(ctx context.Context, client *MigakuClient) ([]string, error) {
+	languages, err := runQuery[string](ctx, client,
+		"SELECT DISTINCT language FROM WordList WHERE del = 0 AND language IS NOT NULL ORDER BY language;")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get languages: %w", err)
+	}
+	return languages, nil
+}
+
 // GetStatusCounts retrieves status counts with optional filters
 func (r *Repository) GetStatusCounts(ctx context.Context, client *MigakuClient, lang, deckID string) ([]statusCountRow, error) {
 	var params []any
 
-	query := "SELECT knownStatus as status, count(1) as count FROM WordList WHERE del = 0"
+	query := "SELECT w.knownStatus as status, count(1) as count FROM WordList w WHERE w.del = 0"
 
-	if deckID != "" {
-		query += " AND deckId = ?"
+	if deckID != "" && deckID != cacheAllKey {
+		query += wordInDeckClause
 		params = append(params, deckID)
 	}
 
 	if lang != "" {
-		query += " AND language = ?"
-		params = append(params, lang)
+		query += " AND w.language = COALESCE(?, w.language)"
+		params = append(params, langArg(lang))
 	}
 
-	query += " GROUP BY knownStatus;"
+	query += " GROUP BY w.knownStatus;"
 
 	rows, err := runQuery[statusCountRow](ctx, client, query, params...)
 	if err != nil {
@@ -238,7 +381,82 @@ func (r *Repository) GetStatusCounts(ctx context.Context, client *MigakuClient,
 	return rows, nil
 }
 
-// GetTables retrieves all database tables
+// GetPartOfSpeechCounts counts words per part of speech and status. With a
+// deck, only words that appear on one of the deck's cards are counted.
+func (r *Repository) GetPartOfSpeechCounts(
+	ctx context.Context,
+	client *MigakuClient,
+	lang, deckID string,
+) ([]partOfSpeechCountRow, error) {
+	query := `
+SELECT COALESCE(w.partOfSpeech, '') AS partOfSpeech, w.knownStatus AS status, COUNT(1) AS count
+FROM WordList w
+WHERE w.language = COALESCE(?, w.language) AND w.del = 0`
+	params := []any{langArg(lang)}
+
+	if deckID != "" {
+		query += wordInDeckClause
+		params = append(params, deckID)
+	}
+
+	query += `
+GROUP BY 1, 2
+ORDER BY 1;`
+
+	rows, err := runQuery[partOfSpeechCountRow](ctx, client, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get part of speech counts: %w", err)
+	}
+
+	return rows, nil
+}
+
+// defaultDeniedTables hides SQLite's own tables, such as sqlite_sequence,
+// unless DEV_TABLES_DENY says otherwise.
+const defaultDeniedTables = "sqlite_*"
+
+// tableFilter picks the tables the dev endpoints expose. Entries are
+// case-insensitive glob patterns. A table is exposed when it matches no
+// deny entry and, if allow is set, at least one allow entry.
+type tableFilter struct {
+	allow []string
+	deny  []string
+}
+
+// exposedTables is set once at startup from DEV_TABLES_ALLOW and
+// DEV_TABLES_DENY.
+var exposedTables = tableFilter{deny: []string{defaultDeniedTables}}
+
+func (f tableFilter) allows(name string) bool {
+	name = strings.ToLower(name)
+	matches := func(pattern string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}
+	if slices.ContainsFunc(f.deny, matches) {
+		return false
+	}
+	return len(f.allow) == 0 || slices.ContainsFunc(f.allow, matches)
+}
+
+// parseTablePatterns splits a comma-separated DEV_TABLES_ALLOW or
+// DEV_TABLES_DENY value into lower-cased patterns.
+func parseTablePatterns(value string) ([]string, error) {
+	var patterns []string
+	for pattern := range strings.SplitSeq(value, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%q is not a valid pattern", pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// GetTables retrieves the database tables exposedTables lets through
 func (r *Repository) GetTables(ctx context.Context, client *MigakuClient) ([]tableRow, error) {
 	query := "SELECT name FROM sqlite_master WHERE type='table';"
 	tables, err := runQuery[tableRow](ctx, client, query)
@@ -246,7 +464,26 @@ func (r *Repository) GetTables(ctx context.Context, client *MigakuClient) ([]tab
 		return nil, fmt.Errorf("failed to get tables: %w", err)
 	}
 
-	return tables, nil
+	return slices.DeleteFunc(tables, func(t tableRow) bool {
+		return !exposedTables.allows(t.Name)
+	}), nil
+}
+
+// GetKeyValue retrieves the keyValue rows ordered by key, or only the row
+// for key when it is set
+func (r *Repository) GetKeyValue(ctx context.Context, client *MigakuClient, key string) ([]keyValueRow, error) {
+	query := "SELECT key, COALESCE(entry, '') AS entry FROM keyValue"
+	var params []any
+	if key != "" {
+		query += " WHERE key = ?"
+		params = append(params, key)
+	}
+	rows, err := runQuery[keyValueRow](ctx, client, query+" ORDER BY key;", params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key values: %w", err)
+	}
+
+	return rows, nil
 }
 
 // difficultWordRow represents words with high fail rates
@@ -260,14 +497,18 @@ type difficultWordRow struct {
 	FailRate      float64 `db:"fail_rate"      json:"fail_rate"`
 }
 
-// GetDifficultWords retrieves words with highest fail rates (min 5 reviews)
-func (r *Repository) GetDifficultWords(
-	ctx context.Context,
-	client *MigakuClient,
-	lang string,
-	limit int,
-	deckID string,
-) ([]difficultWordRow, error) {
+// difficultWordsOrder maps each difficult words sort key to its ORDER BY
+// terms. Only these fixed strings are ever spliced into the query.
+var difficultWordsOrder = map[string]string{
+	difficultSortFailRate:      "fail_rate DESC, total_reviews DESC",
+	difficultSortFailedReviews: "failed_reviews DESC, fail_rate DESC",
+	difficultSortWeighted:      "fail_rate * LN(total_reviews) DESC, total_reviews DESC",
+}
+
+// difficultWordsQuery builds the grouped fail-rate query shared by
+// GetDifficultWords and CountDifficultWords, without ordering or paging.
+// A positive fromDay only counts reviews on or after that day number.
+func difficultWordsQuery(lang, deckID string, minReviews, fromDay int) (string, []any) {
 	var params []any
 	query := `SELECT
 	            w.dictForm,
@@ -280,6 +521,7 @@ func (r *Repository) GetDifficultWords(
 	          FROM WordList w
 	          JOIN CardWordRelation cwr ON w.dictForm = cwr.dictForm
 			  	AND w.secondary = cwr.secondary AND w.partOfSpeech = cwr.partOfSpeech
+			  	AND w.language = cwr.language
 	          JOIN card c ON cwr.cardId = c.id
 	          JOIN review r ON c.id = r.cardId
 	          WHERE w.language = ? AND w.del = 0 AND c.del = 0 AND r.del = 0 AND r.type IN (1, 2)`
@@ -291,13 +533,41 @@ func (r *Repository) GetDifficultWords(
 		params = append(params, deckID)
 	}
 
+	if fromDay > 0 {
+		query += " AND r.day >= ?"
+		params = append(params, fromDay)
+	}
+
 	query += `
 	          GROUP BY w.dictForm, w.secondary, w.partOfSpeech
-	          HAVING total_reviews >= 5
-	          ORDER BY fail_rate DESC, total_reviews DESC
-	          LIMIT ?;`
+	          HAVING total_reviews >= ?`
+
+	params = append(params, minReviews)
+	return query, params
+}
 
-	params = append(params, limit)
+// GetDifficultWords retrieves words with highest fail rates among those
+// with at least minReviews answered reviews
+func (r *Repository) GetDifficultWords(
+	ctx context.Context,
+	client *MigakuClient,
+	lang string,
+	limit, offset int,
+	deckID string,
+	minReviews, fromDay int,
+	sort string,
+) ([]difficultWordRow, error) {
+	orderBy, ok := difficultWordsOrder[sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown difficult words sort %q", sort)
+	}
+
+	query, params := difficultWordsQuery(lang, deckID, minReviews, fromDay)
+	query += `
+	          ORDER BY ` + orderBy + `
+	          LIMIT ? OFFSET ?;`
+
+	params = append(params, limit, offset)
 
 	words, err := runQuery[difficultWordRow](ctx, client, query, params...)
 	if err != nil {
@@ -306,6 +576,283 @@ func (r *Repository) GetDifficultWords(
 	return words, nil
 }
 
+// CountDifficultWords counts the words GetDifficultWords would rank.
+// The HAVING filter applies per group, so the grouped query is wrapped
+// in a subquery and its rows are counted.
+func (r *Repository) CountDifficultWords(
+	ctx context.Context,
+	client *MigakuClient,
+	lang, deckID string,
+	minReviews, fromDay int,
+) (int, error) {
+	query, params := difficultWordsQuery(lang, deckID, minReviews, fromDay)
+	query = "SELECT COUNT(*) AS count FROM (" + query + ");"
+
+	type countRow struct {
+		Count int `db:"count"`
+	}
+
+	rows, err := runQuery[countRow](ctx, client, query, params...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count difficult words: %w", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return rows[0].Count, nil
+}
+
+// reviewRow represents a single row from the review table
+type reviewRow struct {
+	ID       int64   `db:"id"       json:"id"`
+	CardID   int64   `db:"cardId"   json:"cardId"`
+	Day      int     `db:"day"      json:"day"`
+	Type     int     `db:"type"     json:"type"`
+	Interval float64 `db:"interval" json:"interval"`
+	Duration int     `db:"duration" json:"duration"`
+}
+
+// reviewFilterQuery builds the FROM/WHERE fragment shared by GetReviews and
+// CountReviews.
+func reviewFilterQuery(filter ReviewFilter) (string, []any) {
+	query := `
+			FROM review r
+			JOIN card c ON r.cardId = c.id
+			JOIN card_type ct ON c.cardTypeId = ct.id
+			WHERE r.del = 0`
+	var params []any
+
+	if filter.Lang != "" {
+		query += " AND ct.lang = ?"
+		params = append(params, filter.Lang)
+	}
+
+	if filter.DeckID != "" {
+		query += deckIDClause
+		params = append(params, filter.DeckID)
+	}
+
+	if filter.FromDay > 0 {
+		query += " AND r.day >= ?"
+		params = append(params, filter.FromDay)
+	}
+
+	if filter.ToDay > 0 {
+		query += " AND r.day <= ?"
+		params = append(params, filter.ToDay)
+	}
+
+	return query, params
+}
+
+// GetReviews retrieves reviews matching the filters, most recent day first
+func (r *Repository) GetReviews(
+	ctx context.Context,
+	client *MigakuClient,
+	filter ReviewFilter,
+	limit, offset int,
+) ([]reviewRow, error) {
+	from, params := reviewFilterQuery(filter)
+
+	query := `SELECT r.id, r.cardId, r.day, r.type,
+				COALESCE(r.interval, 0) AS interval, COALESCE(r.duration, 0) AS duration` + from + `
+			ORDER BY r.day DESC, r.id DESC
+			LIMIT ? OFFSET ?;`
+	params = append(params, limit, offset)
+
+	reviews, err := runQuery[reviewRow](ctx, client, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reviews: %w", err)
+	}
+	return reviews, nil
+}
+
+// CountReviews counts reviews matching the filters
+func (r *Repository) CountReviews(
+	ctx context.Context,
+	client *MigakuClient,
+	filter ReviewFilter,
+) (int, error) {
+	from, params := reviewFilterQuery(filter)
+
+	type countRow struct {
+		Count int `db:"count"`
+	}
+
+	rows, err := runQuery[countRow](ctx, client, "SELECT COUNT(*) AS count"+from+";", params...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count reviews: %w", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return rows[0].Count, nil
+}
+
+// cardRow represents a single row from the card table
+type cardRow struct {
+	ID       int64   `db:"id"       json:"id"`
+	DeckID   int64   `db:"deckId"   json:"deckId"`
+	Due      int     `db:"due"      json:"due"`
+	Interval float64 `db:"interval" json:"interval"`
+	Created  int64   `db:"created"  json:"created"`
+}
+
+// cardFilterQuery builds the FROM/WHERE fragment shared by GetCards and
+// CountCards.
+func cardFilterQuery(filter CardFilter) (string, []any) {
+	query := `
+			FROM card c
+			JOIN card_type ct ON c.cardTypeId = ct.id
+			WHERE c.del = 0`
+	var params []any
+
+	if filter.Lang != "" {
+		query += " AND ct.lang = ?"
+		params = append(params, filter.Lang)
+	}
+
+	if filter.DeckID != "" {
+		query += deckIDClause
+		params = append(params, filter.DeckID)
+	}
+
+	if filter.DueBefore > 0 {
+		query += " AND c.due < ?"
+		params = append(params, filter.DueBefore)
+	}
+
+	return query, params
+}
+
+// GetCards retrieves cards matching the filters, soonest due first
+func (r *Repository) GetCards(
+	ctx context.Context,
+	client *MigakuClient,
+	filter CardFilter,
+	limit, offset int,
+) ([]cardRow, error) {
+	from, params := cardFilterQuery(filter)
+
+	query := `SELECT c.id, c.deckId, COALESCE(c.due, 0) AS due,
+				COALESCE(c.interval, 0) AS interval, COALESCE(c.created, 0) AS created` + from + `
+			ORDER BY c.due, c.id
+			LIMIT ? OFFSET ?;`
+	params = append(params, limit, offset)
+
+	cards, err := runQuery[cardRow](ctx, client, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cards: %w", err)
+	}
+	return cards, nil
+}
+
+// CountCards counts cards matching the filters
+func (r *Repository) CountCards(
+	ctx context.Context,
+	client *MigakuClient,
+	filter CardFilter,
+) (int, error) {
+	from, params := cardFilterQuery(filter)
+
+	type countRow struct {
+		Count int `db:"count"`
+	}
+
+	rows, err := runQuery[countRow](ctx, client, "SELECT COUNT(*) AS count"+from+";", params...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count cards: %w", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return rows[0].Count, nil
+}
+
+// cardWordRow is a word linked to a card through CardWordRelation
+type cardWordRow struct {
+	CardID       int64  `db:"cardId"       json:"cardId"`
+	DictForm     string `db:"dictForm"     json:"dictForm"`
+	Secondary    string `db:"secondary"    json:"secondary"`
+	PartOfSpeech string `db:"partOfSpeech" json:"partOfSpeech"`
+	KnownStatus  string `db:"knownStatus"  json:"knownStatus"`
+}
+
+// GetCardWords retrieves the words on the given cards, with each word's
+// status from WordList.
+func (r *Repository) GetCardWords(ctx context.Context, client *MigakuClient, cardIDs []int64) ([]cardWordRow, error) {
+	if len(cardIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `SELECT cwr.cardId, cwr.dictForm, COALESCE(cwr.secondary, '') AS secondary,
+				COALESCE(cwr.partOfSpeech, '') AS partOfSpeech,
+				COALESCE(w.knownStatus, 'UNKNOWN') AS knownStatus
+			FROM CardWordRelation cwr
+			LEFT JOIN WordList w
+				ON w.dictForm = cwr.dictForm
+				AND w.secondary = cwr.secondary
+				AND w.partOfSpeech = cwr.partOfSpeech
+				AND w.language = cwr.language
+				AND w.del = 0
+			WHERE cwr.del = 0 AND cwr.cardId IN (?` + strings.Repeat(", ?", len(cardIDs)-1) + `)
+			ORDER BY cwr.cardId, cwr.dictForm;`
+	params := make([]any, len(cardIDs))
+	for i, id := range cardIDs {
+		params[i] = id
+	}
+
+	words, err := runQuery[cardWordRow](ctx, client, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get card words: %w", err)
+	}
+	return words, nil
+}
+
+// cardTypeRow represents a card type and its raw field definitions
+type cardTypeRow struct {
+	ID     int    `db:"id"     json:"id"`
+	Name   string `db:"name"   json:"name"`
+	Lang   string `db:"lang"   json:"lang"`
+	Config string `db:"config" json:"config"`
+}
+
+// cardTypeConfigColumns lists the card_type columns known to carry the JSON
+// field definitions, in order of preference.
+var cardTypeConfigColumns = []string{"config", "fields"}
+
+// GetCardTypes retrieves active card types from the card_type table along
+// with the JSON column holding their field definitions. That column is
+// looked up in the table schema, since it has been renamed across versions.
+func (r *Repository) GetCardTypes(ctx context.Context, client *MigakuClient, lang string) ([]cardTypeRow, error) {
+	columns, err := runQuery[tableRow](ctx, client, "SELECT name FROM pragma_table_info('card_type');")
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect card_type: %w", err)
+	}
+
+	configColumn := "''"
+	for _, candidate := range cardTypeConfigColumns {
+		if slices.ContainsFunc(columns, func(c tableRow) bool { return c.Name == candidate }) {
+			configColumn = candidate
+			break
+		}
+	}
+
+	var params []any
+	query := "SELECT id, name, lang, COALESCE(" + configColumn + ", '') AS config FROM card_type WHERE del = 0"
+	if lang != "" {
+		query += " AND lang = ?"
+		params = append(params, lang)
+	}
+	query += " ORDER BY name;"
+
+	cardTypes, err := runQuery[cardTypeRow](ctx, client, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get card types: %w", err)
+	}
+	return cardTypes, nil
+}
+
 // schemaRow represents database schema information
 type schemaRow struct {
 	TableName    string `db:"table_name"  json:"table_name"`
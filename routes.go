@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// routeTable records the method-qualified routes the server registers, so
+// they can be checked against the OpenAPI spec at startup.
+type routeTable struct {
+	routes []string
+}
+
+// routeMux is a ServeMux that records every route registered on it, under
+// the prefix it is mounted at, in a shared routeTable.
+type routeMux struct {
+	*http.ServeMux
+
+	prefix string
+	table  *routeTable
+}
+
+func newRouteMux(prefix string, table *routeTable) *routeMux {
+	return &routeMux{ServeMux: http.NewServeMux(), prefix: prefix, table: table}
+}
+
+// HandleFunc registers handler for pattern, which must name a method, e.g.
+// "GET /words".
+func (m *routeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.ServeMux.HandleFunc(pattern, handler)
+	method, path, _ := strings.Cut(pattern, " ")
+	m.table.routes = append(m.table.routes, method+" "+m.prefix+path)
+}
+
+// specOperations lists the operations an OpenAPI document declares, as
+// "METHOD /path". It reads the top-level paths block by indentation, which
+// is all the embedded spec needs.
+func specOperations(spec []byte) []string {
+	var operations []string
+	inPaths := false
+	path := ""
+	scanner := bufio.NewScanner(bytes.NewReader(spec))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		switch {
+		case indent == 0:
+			inPaths = trimmed == "paths:"
+		case !inPaths:
+		case indent == 2 && strings.HasSuffix(trimmed, ":"):
+			path = strings.Trim(strings.TrimSuffix(trimmed, ":"), `"'`)
+		case indent == 4 && strings.HasSuffix(trimmed, ":"):
+			method := strings.ToUpper(strings.TrimSuffix(trimmed, ":"))
+			if slices.Contains(openAPIMethods, method) {
+				operations = append(operations, method+" "+path)
+			}
+		}
+	}
+	return operations
+}
+
+var openAPIMethods = []string{"GET", "PUT", "POST", "DELETE", "OPTIONS", "HEAD", "PATCH", "TRACE"}
+
+// diffSpec compares the registered routes with the spec's operations and
+// returns the routes the spec lacks and the operations no route serves.
+func (t *routeTable) diffSpec(spec []byte) (undocumented, unserved []string) {
+	documented := specOperations(spec)
+	for _, route := range t.routes {
+		if !slices.Contains(documented, route) {
+			undocumented = append(undocumented, route)
+		}
+	}
+	for _, operation := range documented {
+		if !slices.Contains(t.routes, operation) {
+			unserved = append(unserved, operation)
+		}
+	}
+	return undocumented, unserved
+}
+
+// routes registers every handler and returns the root handler, the probes
+// mountBasePath serves outside the base path, and the recorded API routes.
+func (app *Application) routes() (http.Handler, map[string]http.HandlerFunc, *routeTable) {
+	chainMiddlewares := func(handler http.HandlerFunc, middlewares ...func(http.HandlerFunc) http.HandlerFunc) http.HandlerFunc {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			handler = middlewares[i](handler)
+		}
+		return handler
+	}
+
+	// Every API route is recorded so it can be checked against openapi.yaml.
+	// The docs pages and the catch-all aren't part of the spec.
+	var routes routeTable
+	mux := newRouteMux("", &routes)
+	mux.ServeMux.HandleFunc("/", app.handleRoot)
+	mux.ServeMux.HandleFunc("GET /docs", app.handleDocs)
+	mux.ServeMux.HandleFunc("GET /openapi.yaml", app.handleOpenAPISpec)
+	mux.HandleFunc("POST /auth/login", chainMiddlewares(app.handleLogin, app.bodyLimitMiddleware))
+	mux.HandleFunc("POST /auth/logout", chainMiddlewares(app.handleLogout, app.bodyLimitMiddleware, app.authMiddleware))
+
+	// Reads get a 503 while the snapshot is still downloading, and reads from
+	// a snapshot that stopped refreshing are flagged per STALE_POLICY.
+	readChain := func(handler http.HandlerFunc) http.HandlerFunc {
+		return chainMiddlewares(handler, app.authMiddleware, app.readinessMiddleware, app.freshnessMiddleware)
+	}
+
+	v1 := newRouteMux("/api/v1", &routes)
+	v1.HandleFunc("GET /words", readChain(app.handleWords))
+	v1.HandleFunc("GET /words/count", readChain(app.handleWordsCount))
+	v1.HandleFunc("GET /words/changes", readChain(app.handleWordChanges))
+	v1.HandleFunc("GET /words/random", readChain(app.handleRandomWords))
+	v1.HandleFunc("POST /words/status", chainMiddlewares(app.handleSetWordStatus, app.bodyLimitMiddleware, app.authMiddleware, app.readinessMiddleware))
+	v1.HandleFunc("PATCH /words/status", chainMiddlewares(app.handlePatchWordStatus, app.bodyLimitMiddleware, app.authMiddleware, app.readinessMiddleware))
+	v1.HandleFunc("POST /words/status/reset", chainMiddlewares(app.handleResetWordStatus, app.bodyLimitMiddleware, app.authMiddleware, app.readinessMiddleware))
+	v1.HandleFunc("GET /words/status/pending", chainMiddlewares(app.handlePendingWordStatus, app.authMiddleware))
+	v1.HandleFunc("POST /words/status/flush", chainMiddlewares(app.handleFlushWordStatus, app.bodyLimitMiddleware, app.authMiddleware))
+	v1.HandleFunc("GET /decks", readChain(app.handleDecks))
+	v1.HandleFunc("PATCH /decks/{id}", chainMiddlewares(app.handleRenameDeck, app.bodyLimitMiddleware, app.authMiddleware, app.readinessMiddleware))
+	v1.HandleFunc("GET /cards", readChain(app.handleCards))
+	v1.HandleFunc("GET /cards/due", readChain(app.handleDueCards))
+	v1.HandleFunc("GET /cards/fields", readChain(app.handleCardFields))
+	v1.HandleFunc("GET /status/counts", readChain(app.handleStatusCounts))
+	v1.HandleFunc("GET /words/difficult", readChain(app.handleDifficultWords))
+	v1.HandleFunc("GET /reviews", readChain(app.handleReviews))
+	v1.HandleFunc("GET /stats/words", readChain(app.handleWordStats))
+	v1.HandleFunc("GET /stats/pos", readChain(app.handlePartOfSpeechStats))
+	v1.HandleFunc("GET /stats/due", readChain(app.handleDueStats))
+	v1.HandleFunc("GET /stats/intervals", readChain(app.handleIntervalStats))
+	v1.HandleFunc("GET /stats/study", readChain(app.handleStudyStats))
+	v1.HandleFunc("POST /stats/batch", chainMiddlewares(readChain(app.handleStatsBatch), app.bodyLimitMiddleware))
+	mux.Handle("/api/v1/", http.StripPrefix("/api/v1", v1))
+
+	dev := newRouteMux("/dev", &routes)
+	dev.HandleFunc("GET /status", app.handleStatus)
+	dev.HandleFunc("POST /cache/clear", chainMiddlewares(app.handleClearCache, app.bodyLimitMiddleware))
+	dev.HandleFunc("GET /database/schema", chainMiddlewares(app.handleDatabaseSchema, app.authMiddleware, app.readinessMiddleware))
+	dev.HandleFunc("GET /database/schema.sql", chainMiddlewares(app.handleDatabaseSchemaSQL, app.authMiddleware, app.readinessMiddleware))
+	dev.HandleFunc("GET /database/validate", chainMiddlewares(app.handleValidateSchema, app.authMiddleware, app.readinessMiddleware))
+	dev.HandleFunc("GET /database/info", chainMiddlewares(app.handleDatabaseInfo, app.authMiddleware, app.readinessMiddleware))
+	dev.HandleFunc("GET /database/tables", chainMiddlewares(app.handleTables, app.authMiddleware, app.readinessMiddleware))
+	dev.HandleFunc("GET /keyvalue", chainMiddlewares(app.handleKeyValue, app.authMiddleware, app.readinessMiddleware))
+	dev.HandleFunc("GET /audit", chainMiddlewares(app.handleAudit, app.authMiddleware))
+	mux.Handle("/dev/", http.StripPrefix("/dev", dev))
+
+	// Probes sit outside the CORS and auth chain so load balancers can reach
+	// them without credentials or an Origin.
+	probes := map[string]http.HandlerFunc{
+		"GET /healthz": app.handleHealthz,
+		"GET /readyz":  app.handleReadyz,
+	}
+	root := newRouteMux("", &routes)
+	for pattern, probe := range probes {
+		root.HandleFunc(pattern, probe)
+	}
+	root.Handle("/", app.corsHandler(app.queryStatsHandler(mux)))
+	return root, probes, &routes
+}
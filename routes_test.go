@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestRoutesMatchSpec(t *testing.T) {
+	app := newTestApp(t)
+	_, _, routes := app.routes()
+
+	for _, route := range []string{"GET /api/v1/words", "PATCH /api/v1/decks/{id}", "GET /dev/audit", "POST /auth/login", "GET /healthz"} {
+		if !slices.Contains(routes.routes, route) {
+			t.Errorf("%s not recorded; got %v", route, routes.routes)
+		}
+	}
+
+	undocumented, unserved := routes.diffSpec(openAPISpec)
+	for _, route := range undocumented {
+		t.Errorf("route %s is missing from openapi.yaml", route)
+	}
+	for _, operation := range unserved {
+		t.Errorf("openapi.yaml documents %s, which no route serves", operation)
+	}
+}
+
+func TestRoutesServe(t *testing.T) {
+	app := newTestApp(t)
+	root, _, _ := app.routes()
+
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/healthz", http.StatusOK},
+		{http.MethodGet, "/api/v1/words", http.StatusUnauthorized},
+		{http.MethodDelete, "/api/v1/words", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/v1/nope", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		root.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestDiffSpec(t *testing.T) {
+	spec := []byte(`openapi: 3.0.3
+info:
+  title: test
+paths:
+  /words:
+    parameters:
+      - name: lang
+    get:
+      summary: list
+    post:
+      summary: set
+  "/decks/{id}":
+    patch:
+      summary: rename
+  /gone:
+    delete:
+      summary: removed
+components:
+  schemas:
+    Word:
+      get:
+        type: string
+`)
+	if got, want := specOperations(spec), []string{"GET /words", "POST /words", "PATCH /decks/{id}", "DELETE /gone"}; !slices.Equal(got, want) {
+		t.Errorf("specOperations = %v, want %v", got, want)
+	}
+
+	table := routeTable{routes: []string{"GET /words", "POST /words", "PATCH /decks/{id}", "GET /new"}}
+	undocumented, unserved := table.diffSpec(spec)
+	if !slices.Equal(undocumented, []string{"GET /new"}) {
+		t.Errorf("undocumented = %v, want [GET /new]", undocumented)
+	}
+	if !slices.Equal(unserved, []string{"DELETE /gone"}) {
+		t.Errorf("unserved = %v, want [DELETE /gone]", unserved)
+	}
+}
@@ -2,20 +2,28 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"math"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// ErrInvalidWordStatus is returned when a word filter names an unknown status
+var ErrInvalidWordStatus = errors.New("invalid status: must be one of: known, learning, unknown, ignored")
+
 // Word represents a word in the domain
 type Word struct {
 	DictForm    string `json:"dictForm"`
 	Secondary   string `json:"secondary"`
 	KnownStatus string `json:"knownStatus,omitempty"`
+	Created     int64  `json:"created,omitempty"`
+	Mod         int64  `json:"mod,omitempty"`
 }
 
 const (
@@ -32,6 +40,9 @@ const (
 	cacheAllKey = "all"
 
 	periodAllTime = "All time"
+
+	defaultPeriod     = "1 Month"
+	defaultPercentile = 75
 )
 
 // WordFromRow creates a Word from a repository wordRow
@@ -48,10 +59,66 @@ func WordsFromRows(rows []wordRow) []Word {
 	return words
 }
 
+// WordChange represents a word modified after a point in time
+type WordChange struct {
+	DictForm     string `json:"dictForm"`
+	Secondary    string `json:"secondary"`
+	PartOfSpeech string `json:"partOfSpeech"`
+	Language     string `json:"language"`
+	KnownStatus  string `json:"knownStatus"`
+	Mod          int64  `json:"mod"`
+	Del          bool   `json:"del"`
+}
+
 // Deck represents a deck in the domain
 type Deck struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	CardCount *int   `json:"cardCount,omitempty"`
+	WordCount *int   `json:"wordCount,omitempty"`
+}
+
+// DeckFilter narrows the deck listing. An empty Lang lists every language's
+// decks; Search matches anywhere in the deck name; WithCounts adds each
+// deck's active card and distinct word counts.
+type DeckFilter struct {
+	Lang       string
+	Search     string
+	WithCounts bool
+}
+
+func (f DeckFilter) cacheKey() string {
+	return fmt.Sprintf("decks:%s:%q:%t", f.Lang, f.Search, f.WithCounts)
+}
+
+// ErrDeckNotFound is returned when no deck has the requested name.
+var ErrDeckNotFound = errors.New("deck not found")
+
+// ErrAmbiguousDeck is returned when several decks share the requested name.
+var ErrAmbiguousDeck = errors.New("deck name is ambiguous")
+
+// ResolveDeckName returns the ID of the active deck named name, compared
+// case-insensitively.
+func (s *MigakuService) ResolveDeckName(ctx context.Context, client *MigakuClient, name string) (string, error) {
+	decks, err := s.GetDecks(ctx, client, DeckFilter{}, 0, 0)
+	if err != nil {
+		return "", err
+	}
+
+	var ids []string
+	for _, deck := range decks {
+		if strings.EqualFold(deck.Name, name) {
+			ids = append(ids, strconv.Itoa(deck.ID))
+		}
+	}
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("%w: %s", ErrDeckNotFound, name)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("%w: %s matches decks %s; use deckId", ErrAmbiguousDeck, name, strings.Join(ids, ", "))
+	}
 }
 
 // DeckFromRow creates a Deck from a repository deckRow
@@ -94,6 +161,23 @@ func StatusCountsFromRows(rows []statusCountRow) StatusCounts {
 	return counts
 }
 
+// PartOfSpeechCounts holds word status counts keyed by part of speech
+// (e.g. NOUN, VERB).
+type PartOfSpeechCounts map[string]StatusCounts
+
+// PartOfSpeechCountsFromRows groups repository rows by part of speech
+func PartOfSpeechCountsFromRows(rows []partOfSpeechCountRow) PartOfSpeechCounts {
+	grouped := make(map[string][]statusCountRow)
+	for _, row := range rows {
+		grouped[row.PartOfSpeech] = append(grouped[row.PartOfSpeech], statusCountRow{Status: row.Status, Count: row.Count})
+	}
+	counts := make(PartOfSpeechCounts, len(grouped))
+	for pos, statusRows := range grouped {
+		counts[pos] = StatusCountsFromRows(statusRows)
+	}
+	return counts
+}
+
 // Table represents a database table
 type Table struct {
 	Name string `json:"name"`
@@ -113,10 +197,36 @@ func TablesFromRows(rows []tableRow) []Table {
 	return tables
 }
 
-// MigakuService handles business logic and caching for Migaku data
+// KeyValue is one entry of Migaku's keyValue settings store
+type KeyValue struct {
+	Key   string `json:"key"`
+	Entry string `json:"entry"`
+}
+
+// KeyValuesFromRows creates a slice of KeyValues from repository keyValueRows
+func KeyValuesFromRows(rows []keyValueRow) []KeyValue {
+	entries := make([]KeyValue, len(rows))
+	for i, row := range rows {
+		entries[i] = KeyValue(row)
+	}
+	return entries
+}
+
+// MigakuService handles business logic and caching for Migaku data.
+// Getters may return values that are shared with the cache (slices and
+// stats pointers); callers must treat them as read-only. Map-shaped results
+// are copied before they are returned.
 type MigakuService struct {
 	repo  *Repository
 	cache *Cache
+
+	// defaultPeriod and defaultPercentile apply when a request leaves the
+	// period or percentile unset.
+	defaultPeriod     string
+	defaultPercentile int
+
+	// audit records every word status change made through this service.
+	audit *auditLog
 }
 
 func (s *MigakuService) scopedCacheKey(client *MigakuClient, key string) string {
@@ -129,141 +239,266 @@ func (s *MigakuService) scopedCacheKey(client *MigakuClient, key string) string
 // NewMigakuService creates a new service instance
 func NewMigakuService(repo *Repository, cache *Cache) *MigakuService {
 	return &MigakuService{
-		repo:  repo,
-		cache: cache,
+		repo:              repo,
+		cache:             cache,
+		defaultPeriod:     defaultPeriod,
+		defaultPercentile: defaultPercentile,
+		audit:             newAuditLog(defaultAuditLogSize, nil),
+	}
+}
+
+// WordFilter holds the filters shared by the word listing and counting endpoints
+type WordFilter struct {
+	Lang         string
+	Status       string
+	DeckID       string
+	Form         string
+	FormExact    bool
+	SinceCreated int64
+	// IncludeIgnored keeps IGNORED words when no Status is given; an
+	// explicit Status always wins.
+	IncludeIgnored bool
+}
+
+// withDBStatus validates the API status of the filter and returns a copy
+// carrying the matching database status instead.
+func (f WordFilter) withDBStatus() (WordFilter, error) {
+	switch f.Status {
+	case "":
+	case statusKnown:
+		f.Status = dbStatusKnown
+	case statusLearning:
+		f.Status = dbStatusLearning
+	case statusUnknown:
+		f.Status = dbStatusUnknown
+	case statusIgnored:
+		f.Status = dbStatusIgnored
+	default:
+		return f, ErrInvalidWordStatus
 	}
+	return f, nil
+}
+
+// cacheKey covers every filter field. Free-text values are quoted, so an
+// empty filter can't share a key with a search for "all" and a colon in a
+// form can't shift the fields after it.
+func (f WordFilter) cacheKey() string {
+	cacheKey := "words:"
+	if f.Status == "" {
+		cacheKey += "all:"
+	} else {
+		cacheKey += f.Status + ":"
+	}
+	cacheKey += "deck:" + strconv.Quote(f.DeckID) + ":"
+	cacheKey += "form:" + strconv.Quote(f.Form) + ":"
+	cacheKey += "exact:" + strconv.FormatBool(f.FormExact) + ":"
+	cacheKey += "since:" + strconv.FormatInt(f.SinceCreated, 10) + ":"
+	cacheKey += "ignored:" + strconv.FormatBool(f.IncludeIgnored) + ":"
+	cacheKey += "lang:" + strconv.Quote(f.Lang)
+	return cacheKey
 }
 
 // GetWords retrieves words with optional status and language filters
 func (s *MigakuService) GetWords(
 	ctx context.Context,
 	client *MigakuClient,
-	lang, status, deckID, form string,
-	formExact bool,
+	filter WordFilter,
 	limit, offset int,
 ) ([]Word, error) {
-	if status != "" && status != statusKnown && status != statusLearning && status != statusUnknown && status != statusIgnored {
-		return nil, errors.New("invalid status: must be one of: known, learning, unknown, ignored")
+	dbFilter, err := filter.withDBStatus()
+	if err != nil {
+		return nil, err
 	}
 
-	cacheKey := "words:"
-	if status == "" {
-		cacheKey += "all:"
-	} else {
-		cacheKey += status + ":"
-	}
-	if deckID == "" {
-		cacheKey += "deck:" + cacheAllKey + ":"
-	} else {
-		cacheKey += "deck:" + deckID + ":"
-	}
-	if form == "" {
-		cacheKey += "form:" + cacheAllKey + ":"
-	} else {
-		cacheKey += "form:" + form + ":"
-	}
-	cacheKey += "exact:" + strconv.FormatBool(formExact) + ":"
-	if lang == "" {
-		cacheKey += cacheAllKey
-	} else {
-		cacheKey += lang
-	}
-	cacheKey = s.scopedCacheKey(client, cacheKey)
+	// Every filter field and the page window are part of the key, so
+	// differently filtered or paged requests never share an entry.
+	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("%s:page:%d:%d", filter.cacheKey(), limit, offset))
 
-	if cached, ok := s.cache.Get(cacheKey); ok {
-		if words, ok := cached.([]Word); ok {
-			return words, nil
-		}
-	}
-
-	var dbStatus string
-	if status != "" {
-		switch status {
-		case statusKnown:
-			dbStatus = dbStatusKnown
-		case statusLearning:
-			dbStatus = dbStatusLearning
-		case statusUnknown:
-			dbStatus = dbStatusUnknown
-		case statusIgnored:
-			dbStatus = dbStatusIgnored
-		}
+	if words, ok := CacheGet[[]Word](s.cache, cacheKey); ok {
+		return words, nil
 	}
 
 	if limit == 0 {
-		if dbStatus == "" {
+		if dbFilter.Status == "" {
 			limit = 10000
 		}
 	}
 
-	rows, err := s.repo.GetWords(ctx, client, lang, dbStatus, limit, deckID, form, formExact, offset)
+	rows, err := s.repo.GetWords(ctx, client, dbFilter, limit, offset)
 	if err != nil {
 		return nil, err
 	}
 
 	words := WordsFromRows(rows)
-	s.cache.Set(cacheKey, words)
+	CacheSet(s.cache, cacheKey, words)
 
 	return words, nil
 }
 
+const (
+	defaultRandomWordsCount = 20
+	maxRandomWordsCount     = 200
+)
+
+// GetRandomWords returns a random sample of words matching the filter.
+// Results are deliberately never cached: every call should draw a new sample.
+func (s *MigakuService) GetRandomWords(
+	ctx context.Context,
+	client *MigakuClient,
+	filter WordFilter,
+	count int,
+) ([]Word, error) {
+	dbFilter, err := filter.withDBStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	if count <= 0 {
+		count = defaultRandomWordsCount
+	}
+	count = min(count, maxRandomWordsCount)
+
+	rows, err := s.repo.GetRandomWords(ctx, client, dbFilter, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return WordsFromRows(rows), nil
+}
+
 // CountWords counts words matching the filters
 func (s *MigakuService) CountWords(
 	ctx context.Context,
 	client *MigakuClient,
-	lang, status, deckID, form string,
-	formExact bool,
+	filter WordFilter,
 ) (int, error) {
-	if status != "" && status != statusKnown && status != statusLearning && status != statusUnknown && status != statusIgnored {
-		return 0, errors.New("invalid status: must be one of: known, learning, unknown, ignored")
-	}
-
-	var dbStatus string
-	if status != "" {
-		switch status {
-		case statusKnown:
-			dbStatus = dbStatusKnown
-		case statusLearning:
-			dbStatus = dbStatusLearning
-		case statusUnknown:
-			dbStatus = dbStatusUnknown
-		case statusIgnored:
-			dbStatus = dbStatusIgnored
-		}
+	dbFilter, err := filter.withDBStatus()
+	if err != nil {
+		return 0, err
+	}
+
+	cacheKey := s.scopedCacheKey(client, "count:"+filter.cacheKey())
+
+	if count, ok := CacheGet[int](s.cache, cacheKey); ok {
+		return count, nil
+	}
+
+	count, err := s.repo.CountWords(ctx, client, dbFilter)
+	if err != nil {
+		return 0, err
 	}
 
-	return s.repo.CountWords(ctx, client, lang, dbStatus, deckID, form, formExact)
+	CacheSet(s.cache, cacheKey, count)
+	return count, nil
 }
 
-// GetDecks retrieves all decks with caching
-func (s *MigakuService) GetDecks(ctx context.Context, client *MigakuClient) ([]Deck, error) {
-	cacheKey := s.scopedCacheKey(client, "decks")
+// wordChangesCacheTTL bounds how long a delta response is reused; changes
+// are inherently time-sensitive so they expire well before other entries.
+const wordChangesCacheTTL = 2 * time.Second
 
-	if cached, ok := s.cache.Get(cacheKey); ok {
-		if decks, ok := cached.([]Deck); ok {
-			return decks, nil
-		}
+// GetWordChanges retrieves words modified after since, including deleted ones
+func (s *MigakuService) GetWordChanges(
+	ctx context.Context,
+	client *MigakuClient,
+	lang string,
+	since int64,
+) ([]WordChange, error) {
+	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("words:changes:%s:%d", lang, since))
+
+	if changes, ok := CacheGet[[]WordChange](s.cache, cacheKey); ok {
+		return changes, nil
 	}
 
-	rows, err := s.repo.GetDecks(ctx, client)
+	rows, err := s.repo.GetWordChanges(ctx, client, lang, since)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]WordChange, len(rows))
+	for i, row := range rows {
+		changes[i] = WordChange(row)
+	}
+
+	CacheSetWithTTL(s.cache, cacheKey, changes, wordChangesCacheTTL)
+	return changes, nil
+}
+
+// GetDecks retrieves decks matching the filter with caching. A non-positive
+// limit returns every match.
+func (s *MigakuService) GetDecks(
+	ctx context.Context,
+	client *MigakuClient,
+	filter DeckFilter,
+	limit, offset int,
+) ([]Deck, error) {
+	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("%s:page:%d:%d", filter.cacheKey(), limit, offset))
+
+	if decks, ok := CacheGet[[]Deck](s.cache, cacheKey); ok {
+		return decks, nil
+	}
+
+	rows, err := s.repo.GetDecks(ctx, client, filter, limit, offset)
 	if err != nil {
 		return nil, err
 	}
 
 	decks := DecksFromRows(rows)
-	s.cache.Set(cacheKey, decks)
+	CacheSet(s.cache, cacheKey, decks)
 
 	return decks, nil
 }
 
+// CountDecks counts the decks matching the filter
+func (s *MigakuService) CountDecks(ctx context.Context, client *MigakuClient, filter DeckFilter) (int, error) {
+	cacheKey := s.scopedCacheKey(client, "count:"+filter.cacheKey())
+
+	if count, ok := CacheGet[int](s.cache, cacheKey); ok {
+		return count, nil
+	}
+
+	count, err := s.repo.CountDecks(ctx, client, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	CacheSet(s.cache, cacheKey, count)
+	return count, nil
+}
+
+// WarmCache computes and caches what a dashboard asks for first: the deck
+// list and status counts for the whole account and for each language, and
+// each language's word stats. Every step runs even if an earlier one fails;
+// the failures are joined.
+func (s *MigakuService) WarmCache(ctx context.Context, client *MigakuClient) error {
+	languages, err := s.repo.GetLanguages(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, lang := range append([]string{""}, languages...) {
+		if _, err := s.GetDecks(ctx, client, DeckFilter{Lang: lang}, 0, 0); err != nil {
+			errs = append(errs, err)
+		}
+		if _, err := s.GetStatusCounts(ctx, client, lang, ""); err != nil {
+			errs = append(errs, err)
+		}
+		if lang == "" {
+			continue
+		}
+		if _, err := s.GetWordStats(ctx, client, lang, ""); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // GetStatusCounts retrieves status counts with caching
 func (s *MigakuService) GetStatusCounts(ctx context.Context, client *MigakuClient, lang, deckID string) (*StatusCounts, error) {
 	cacheKey := s.scopedCacheKey(client, s.buildStatusCountsCacheKey(lang, deckID))
 
-	if cached, ok := s.cache.Get(cacheKey); ok {
-		if counts, ok := cached.(*StatusCounts); ok {
-			return counts, nil
-		}
+	if counts, ok := CacheGet[*StatusCounts](s.cache, cacheKey); ok {
+		return counts, nil
 	}
 
 	rows, err := s.repo.GetStatusCounts(ctx, client, lang, deckID)
@@ -272,19 +507,43 @@ func (s *MigakuService) GetStatusCounts(ctx context.Context, client *MigakuClien
 	}
 
 	counts := StatusCountsFromRows(rows)
-	s.cache.Set(cacheKey, &counts)
+	CacheSet(s.cache, cacheKey, &counts)
 
 	return &counts, nil
 }
 
+// GetPartOfSpeechStats retrieves word status counts per part of speech with caching
+func (s *MigakuService) GetPartOfSpeechStats(
+	ctx context.Context,
+	client *MigakuClient,
+	lang, deckID string,
+) (PartOfSpeechCounts, error) {
+	if lang == "" {
+		return nil, errors.New("lang parameter is required")
+	}
+
+	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("stats:pos:%s:%s", lang, deckID))
+	if counts, ok := CacheGet[PartOfSpeechCounts](s.cache, cacheKey); ok {
+		return maps.Clone(counts), nil
+	}
+
+	rows, err := s.repo.GetPartOfSpeechCounts(ctx, client, lang, deckID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := PartOfSpeechCountsFromRows(rows)
+	CacheSet(s.cache, cacheKey, counts)
+
+	return maps.Clone(counts), nil
+}
+
 // GetTables retrieves all database tables with caching
 func (s *MigakuService) GetTables(ctx context.Context, client *MigakuClient) ([]Table, error) {
 	cacheKey := s.scopedCacheKey(client, "tables")
 
-	if cached, ok := s.cache.Get(cacheKey); ok {
-		if tables, ok := cached.([]Table); ok {
-			return tables, nil
-		}
+	if tables, ok := CacheGet[[]Table](s.cache, cacheKey); ok {
+		return tables, nil
 	}
 
 	rows, err := s.repo.GetTables(ctx, client)
@@ -293,11 +552,37 @@ func (s *MigakuService) GetTables(ctx context.Context, client *MigakuClient) ([]
 	}
 
 	tables := TablesFromRows(rows)
-	s.cache.Set(cacheKey, tables)
+	CacheSet(s.cache, cacheKey, tables)
 
 	return tables, nil
 }
 
+// ErrKeyNotFound is returned when a keyValue key isn't in the snapshot.
+var ErrKeyNotFound = errors.New("key not found")
+
+// GetKeyValues returns the account's keyValue settings. A non-empty key
+// returns just that entry, or ErrKeyNotFound.
+func (s *MigakuService) GetKeyValues(ctx context.Context, client *MigakuClient, key string) ([]KeyValue, error) {
+	cacheKey := s.scopedCacheKey(client, "keyvalue:"+key)
+
+	if entries, ok := CacheGet[[]KeyValue](s.cache, cacheKey); ok {
+		return entries, nil
+	}
+
+	rows, err := s.repo.GetKeyValue(ctx, client, key)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" && len(rows) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+
+	entries := KeyValuesFromRows(rows)
+	CacheSet(s.cache, cacheKey, entries)
+
+	return entries, nil
+}
+
 // buildStatusCountsCacheKey builds a cache key for status counts
 func (s *MigakuService) buildStatusCountsCacheKey(lang, deckID string) string {
 	cacheKey := "status:counts:"
@@ -328,26 +613,83 @@ type DifficultWord struct {
 	FailRate      float64 `json:"fail_rate"`
 }
 
-// GetDifficultWords retrieves words with highest fail rates
+// Orderings for the difficult words ranking. The weighted score multiplies
+// the fail rate by the log of the review count, so a high rate over few
+// reviews doesn't outrank a slightly lower rate over many.
+const (
+	difficultSortFailRate      = "failRate"
+	difficultSortFailedReviews = "failedReviews"
+	difficultSortWeighted      = "weighted"
+)
+
+// ErrInvalidDifficultSort is returned for an unknown difficult words sort key.
+var ErrInvalidDifficultSort = errors.New("sort must be one of: failRate, failedReviews, weighted")
+
+const (
+	defaultDifficultWordsLimit = 50
+	defaultDifficultMinReviews = 5
+)
+
+// rankedKey lists every parameter that can change a ranked word list or its
+// count. Parameters that don't apply to a query stay zero.
+type rankedKey struct {
+	Lang       string
+	DeckID     string
+	MinReviews int
+	FromDay    int
+	Sort       string
+	Limit      int
+	Offset     int
+}
+
+// buildRankedCacheKey builds the cache key for a ranked word endpoint. It
+// formats the whole rankedKey, so a parameter added to the struct is part of
+// every key without each call site having to remember it. %#v quotes the
+// strings, so one field's value can't read as the next field.
+func buildRankedCacheKey(kind string, key rankedKey) string {
+	return fmt.Sprintf("ranked:%s:%#v", kind, key)
+}
+
+// GetDifficultWords retrieves words with highest fail rates. A positive
+// fromDay restricts the ranking to reviews on or after that day number.
 func (s *MigakuService) GetDifficultWords(
 	ctx context.Context,
 	client *MigakuClient,
 	lang string,
-	limit int,
+	limit, offset int,
 	deckID string,
+	minReviews, fromDay int,
+	sort string,
 ) ([]DifficultWord, error) {
-	if limit == 0 {
-		limit = 50
+	if sort == "" {
+		sort = difficultSortFailRate
+	}
+	if _, ok := difficultWordsOrder[sort]; !ok {
+		return nil, ErrInvalidDifficultSort
 	}
-	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("difficult:words:%s:%d:%s", lang, limit, deckID))
+	if limit <= 0 {
+		limit = defaultDifficultWordsLimit
+	}
+	limit = min(limit, maxPageSize)
+	offset = max(offset, 0)
+	if minReviews <= 0 {
+		minReviews = defaultDifficultMinReviews
+	}
+	cacheKey := s.scopedCacheKey(client, buildRankedCacheKey("difficult:words", rankedKey{
+		Lang:       lang,
+		DeckID:     deckID,
+		MinReviews: minReviews,
+		FromDay:    fromDay,
+		Sort:       sort,
+		Limit:      limit,
+		Offset:     offset,
+	}))
 
-	if cached, ok := s.cache.Get(cacheKey); ok {
-		if words, ok := cached.([]DifficultWord); ok {
-			return words, nil
-		}
+	if words, ok := CacheGet[[]DifficultWord](s.cache, cacheKey); ok {
+		return words, nil
 	}
 
-	rows, err := s.repo.GetDifficultWords(ctx, client, lang, limit, deckID)
+	rows, err := s.repo.GetDifficultWords(ctx, client, lang, limit, offset, deckID, minReviews, fromDay, sort)
 	if err != nil {
 		return nil, err
 	}
@@ -357,10 +699,317 @@ func (s *MigakuService) GetDifficultWords(
 		words[i] = DifficultWord(row)
 	}
 
-	s.cache.Set(cacheKey, words)
+	CacheSet(s.cache, cacheKey, words)
 	return words, nil
 }
 
+// CountDifficultWords counts the words eligible for the difficult words ranking
+func (s *MigakuService) CountDifficultWords(
+	ctx context.Context,
+	client *MigakuClient,
+	lang, deckID string,
+	minReviews, fromDay int,
+) (int, error) {
+	if minReviews <= 0 {
+		minReviews = defaultDifficultMinReviews
+	}
+	cacheKey := s.scopedCacheKey(client, buildRankedCacheKey("difficult:count", rankedKey{
+		Lang:       lang,
+		DeckID:     deckID,
+		MinReviews: minReviews,
+		FromDay:    fromDay,
+	}))
+
+	if count, ok := CacheGet[int](s.cache, cacheKey); ok {
+		return count, nil
+	}
+
+	count, err := s.repo.CountDifficultWords(ctx, client, lang, deckID, minReviews, fromDay)
+	if err != nil {
+		return 0, err
+	}
+
+	CacheSet(s.cache, cacheKey, count)
+	return count, nil
+}
+
+// Review represents a single review of a card. Type is 0 for a new card,
+// 1 for a failed review and 2 for a passed one; Day is a Migaku day number.
+type Review struct {
+	ID       int64   `json:"id"`
+	CardID   int64   `json:"cardId"`
+	Day      int     `json:"day"`
+	Type     int     `json:"type"`
+	Interval float64 `json:"interval"`
+	Duration int     `json:"duration"`
+}
+
+// ReviewFilter narrows the review history. Empty strings and zero days
+// leave that filter off; FromDay and ToDay are inclusive day numbers.
+type ReviewFilter struct {
+	Lang    string
+	DeckID  string
+	FromDay int
+	ToDay   int
+}
+
+func (f ReviewFilter) cacheKey() string {
+	return fmt.Sprintf("reviews:%s:%s:%d:%d", f.Lang, f.DeckID, f.FromDay, f.ToDay)
+}
+
+// GetReviews retrieves a page of review history, most recent day first
+func (s *MigakuService) GetReviews(
+	ctx context.Context,
+	client *MigakuClient,
+	filter ReviewFilter,
+	limit, offset int,
+) ([]Review, error) {
+	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("%s:page:%d:%d", filter.cacheKey(), limit, offset))
+
+	if reviews, ok := CacheGet[[]Review](s.cache, cacheKey); ok {
+		return reviews, nil
+	}
+
+	rows, err := s.repo.GetReviews(ctx, client, filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	reviews := make([]Review, len(rows))
+	for i, row := range rows {
+		reviews[i] = Review(row)
+	}
+
+	CacheSet(s.cache, cacheKey, reviews)
+	return reviews, nil
+}
+
+// CountReviews counts the reviews matching the filter
+func (s *MigakuService) CountReviews(ctx context.Context, client *MigakuClient, filter ReviewFilter) (int, error) {
+	cacheKey := s.scopedCacheKey(client, "count:"+filter.cacheKey())
+
+	if count, ok := CacheGet[int](s.cache, cacheKey); ok {
+		return count, nil
+	}
+
+	count, err := s.repo.CountReviews(ctx, client, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	CacheSet(s.cache, cacheKey, count)
+	return count, nil
+}
+
+// Card represents a card's scheduling state. Due is a Migaku day number,
+// Interval is in days and Created is in epoch milliseconds.
+type Card struct {
+	ID       int64   `json:"id"`
+	DeckID   int64   `json:"deckId"`
+	Due      int     `json:"due"`
+	Interval float64 `json:"interval"`
+	Created  int64   `json:"created"`
+}
+
+// CardFilter narrows the card listing. Empty strings and a zero DueBefore
+// leave that filter off; DueBefore is an exclusive day number.
+type CardFilter struct {
+	Lang      string
+	DeckID    string
+	DueBefore int
+}
+
+func (f CardFilter) cacheKey() string {
+	return fmt.Sprintf("cards:%s:%s:%d", f.Lang, f.DeckID, f.DueBefore)
+}
+
+// GetCards retrieves a page of cards, soonest due first
+func (s *MigakuService) GetCards(
+	ctx context.Context,
+	client *MigakuClient,
+	filter CardFilter,
+	limit, offset int,
+) ([]Card, error) {
+	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("%s:page:%d:%d", filter.cacheKey(), limit, offset))
+
+	if cards, ok := CacheGet[[]Card](s.cache, cacheKey); ok {
+		return cards, nil
+	}
+
+	rows, err := s.repo.GetCards(ctx, client, filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	cards := make([]Card, len(rows))
+	for i, row := range rows {
+		cards[i] = Card(row)
+	}
+
+	CacheSet(s.cache, cacheKey, cards)
+	return cards, nil
+}
+
+// CountCards counts the cards matching the filter
+func (s *MigakuService) CountCards(ctx context.Context, client *MigakuClient, filter CardFilter) (int, error) {
+	cacheKey := s.scopedCacheKey(client, "count:"+filter.cacheKey())
+
+	if count, ok := CacheGet[int](s.cache, cacheKey); ok {
+		return count, nil
+	}
+
+	count, err := s.repo.CountCards(ctx, client, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	CacheSet(s.cache, cacheKey, count)
+	return count, nil
+}
+
+// CardWord is a word on a card, with its current status
+type CardWord struct {
+	DictForm     string `json:"dictForm"`
+	Secondary    string `json:"secondary"`
+	PartOfSpeech string `json:"partOfSpeech"`
+	KnownStatus  string `json:"knownStatus"`
+}
+
+// DueCard is a card due for review together with the words on it
+type DueCard struct {
+	Card
+
+	Words []CardWord `json:"words"`
+}
+
+// DueCardFilter returns the card filter for cards due today or earlier,
+// where today is the study day in loc (see currentStudyDate).
+func (s *MigakuService) DueCardFilter(
+	ctx context.Context,
+	client *MigakuClient,
+	lang, deckID string,
+	loc *time.Location,
+) CardFilter {
+	if loc == nil {
+		loc = time.Local
+	}
+	today := dayNumber(currentStudyDate(ctx, client, loc), loc)
+	return CardFilter{Lang: lang, DeckID: deckID, DueBefore: today + 1}
+}
+
+// GetDueCards retrieves a page of the cards matching filter, soonest due
+// first, with the words on each card
+func (s *MigakuService) GetDueCards(
+	ctx context.Context,
+	client *MigakuClient,
+	filter CardFilter,
+	limit, offset int,
+) ([]DueCard, error) {
+	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("due:%s:page:%d:%d", filter.cacheKey(), limit, offset))
+
+	if cards, ok := CacheGet[[]DueCard](s.cache, cacheKey); ok {
+		return cards, nil
+	}
+
+	cards, err := s.GetCards(ctx, client, filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	cardIDs := make([]int64, len(cards))
+	for i, card := range cards {
+		cardIDs[i] = card.ID
+	}
+	rows, err := s.repo.GetCardWords(ctx, client, cardIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	wordsByCard := make(map[int64][]CardWord, len(cards))
+	for _, row := range rows {
+		wordsByCard[row.CardID] = append(wordsByCard[row.CardID], CardWord{
+			DictForm:     row.DictForm,
+			Secondary:    row.Secondary,
+			PartOfSpeech: row.PartOfSpeech,
+			KnownStatus:  row.KnownStatus,
+		})
+	}
+
+	dueCards := make([]DueCard, len(cards))
+	for i, card := range cards {
+		words := wordsByCard[card.ID]
+		if words == nil {
+			words = []CardWord{}
+		}
+		dueCards[i] = DueCard{Card: card, Words: words}
+	}
+
+	CacheSet(s.cache, cacheKey, dueCards)
+	return dueCards, nil
+}
+
+// CardTypeFields lists the field names defined by a card type
+type CardTypeFields struct {
+	ID     int      `json:"id"`
+	Name   string   `json:"name"`
+	Lang   string   `json:"lang"`
+	Fields []string `json:"fields"`
+}
+
+// GetCardFields retrieves the field names of every card type, read from the
+// JSON field definitions stored on the card_type table
+func (s *MigakuService) GetCardFields(ctx context.Context, client *MigakuClient, lang string) ([]CardTypeFields, error) {
+	cacheKey := s.scopedCacheKey(client, "cards:fields:"+lang)
+
+	if fields, ok := CacheGet[[]CardTypeFields](s.cache, cacheKey); ok {
+		return fields, nil
+	}
+
+	rows, err := s.repo.GetCardTypes(ctx, client, lang)
+	if err != nil {
+		return nil, err
+	}
+
+	cardTypes := make([]CardTypeFields, len(rows))
+	for i, row := range rows {
+		cardTypes[i] = CardTypeFields{
+			ID:     row.ID,
+			Name:   row.Name,
+			Lang:   row.Lang,
+			Fields: parseCardTypeFields(row.Config),
+		}
+	}
+
+	CacheSet(s.cache, cacheKey, cardTypes)
+	return cardTypes, nil
+}
+
+// parseCardTypeFields extracts field names from a card type definition,
+// accepting both {"fields":[{"name":...}]} and a bare list of fields.
+func parseCardTypeFields(config string) []string {
+	type fieldDef struct {
+		Name string `json:"name"`
+	}
+
+	var defs []fieldDef
+	var wrapped struct {
+		Fields []fieldDef `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(config), &wrapped); err == nil {
+		defs = wrapped.Fields
+	} else if err := json.Unmarshal([]byte(config), &defs); err != nil {
+		return []string{}
+	}
+
+	fields := make([]string, 0, len(defs))
+	for _, def := range defs {
+		if def.Name != "" {
+			fields = append(fields, def.Name)
+		}
+	}
+	return fields
+}
+
 // FieldMetadata represents metadata about a database column
 type FieldMetadata struct {
 	Type       string `json:"type"`
@@ -375,10 +1024,8 @@ type DatabaseSchema map[string]map[string]FieldMetadata
 func (s *MigakuService) GetDatabaseSchema(ctx context.Context, client *MigakuClient) (DatabaseSchema, error) {
 	cacheKey := s.scopedCacheKey(client, "database:schema")
 
-	if cached, ok := s.cache.Get(cacheKey); ok {
-		if schema, ok := cached.(DatabaseSchema); ok {
-			return schema, nil
-		}
+	if schema, ok := CacheGet[DatabaseSchema](s.cache, cacheKey); ok {
+		return schema.clone(), nil
 	}
 
 	rows, err := s.repo.GetDatabaseSchema(ctx, client)
@@ -400,8 +1047,134 @@ func (s *MigakuService) GetDatabaseSchema(ctx context.Context, client *MigakuCli
 		}
 	}
 
-	s.cache.Set(cacheKey, tableToFields)
-	return tableToFields, nil
+	CacheSet(s.cache, cacheKey, tableToFields)
+	return tableToFields.clone(), nil
+}
+
+// GetDatabaseSchemaSQL renders the database schema as CREATE TABLE
+// statements, with columns in their declared order.
+func (s *MigakuService) GetDatabaseSchemaSQL(ctx context.Context, client *MigakuClient) (string, error) {
+	cacheKey := s.scopedCacheKey(client, "database:schema:sql")
+
+	if ddl, ok := CacheGet[string](s.cache, cacheKey); ok {
+		return ddl, nil
+	}
+
+	rows, err := s.repo.GetDatabaseSchema(ctx, client)
+	if err != nil {
+		return "", err
+	}
+
+	ddl := renderSchemaSQL(rows)
+	CacheSet(s.cache, cacheKey, ddl)
+	return ddl, nil
+}
+
+// renderSchemaSQL turns schema rows, ordered by table and column position,
+// into one CREATE TABLE statement per table. Primary key columns are listed
+// in a table constraint in key order.
+func renderSchemaSQL(rows []schemaRow) string {
+	quote := func(name string) string {
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(rows); {
+		table := rows[i].TableName
+		var columns []string
+		var keys []schemaRow
+		for ; i < len(rows) && rows[i].TableName == table; i++ {
+			row := rows[i]
+			column := quote(row.ColumnName)
+			if row.ColumnType != "" {
+				column += " " + row.ColumnType
+			}
+			if row.IsNotNull != 0 {
+				column += " NOT NULL"
+			}
+			columns = append(columns, column)
+			if row.IsPrimaryKey != 0 {
+				keys = append(keys, row)
+			}
+		}
+
+		if len(keys) > 0 {
+			slices.SortFunc(keys, func(a, b schemaRow) int { return a.IsPrimaryKey - b.IsPrimaryKey })
+			names := make([]string, len(keys))
+			for k, key := range keys {
+				names[k] = quote(key.ColumnName)
+			}
+			columns = append(columns, "PRIMARY KEY ("+strings.Join(names, ", ")+")")
+		}
+
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "CREATE TABLE %s (\n  %s\n);\n", quote(table), strings.Join(columns, ",\n  "))
+	}
+	return b.String()
+}
+
+// clone returns a deep copy so callers can't modify a cached schema.
+func (d DatabaseSchema) clone() DatabaseSchema {
+	out := make(DatabaseSchema, len(d))
+	for table, fields := range d {
+		out[table] = maps.Clone(fields)
+	}
+	return out
+}
+
+// expectedSchema lists the tables and columns the hardcoded queries rely on.
+var expectedSchema = map[string][]string{
+	"WordList": {
+		"dictForm", "secondary", "partOfSpeech", "language", "knownStatus", "del", "created", "mod",
+		"serverMod", "hasCard", "tracked", "isModern", "serverVersion", "isPendingEnqueue", "isPendingApply",
+	},
+	"CardWordRelation": {"cardId", "dictForm", "secondary", "partOfSpeech", "language"},
+	"card":             {"id", "deckId", "cardTypeId", "del", "due", "interval", "created", "lessonId"},
+	"card_type":        {"id", "lang", "name", "del"},
+	"deck":             {"id", "name", "del"},
+	"review":           {"id", "cardId", "day", "type", "del", "interval", "duration"},
+	"keyValue":         {"key", "entry"},
+	"vacation":         {"start", "end", "del"},
+}
+
+// SchemaValidation reports tables and columns the queries need but the
+// downloaded database lacks
+type SchemaValidation struct {
+	Valid          bool                `json:"valid"`
+	MissingTables  []string            `json:"missing_tables"`
+	MissingColumns map[string][]string `json:"missing_columns"`
+}
+
+// ValidateSchema compares the database schema against expectedSchema, turning
+// an upstream schema change into a readable report instead of SQL errors
+func (s *MigakuService) ValidateSchema(ctx context.Context, client *MigakuClient) (*SchemaValidation, error) {
+	schema, err := s.GetDatabaseSchema(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	validation := &SchemaValidation{
+		MissingTables:  []string{},
+		MissingColumns: map[string][]string{},
+	}
+	for table, columns := range expectedSchema {
+		fields, ok := schema[table]
+		if !ok {
+			validation.MissingTables = append(validation.MissingTables, table)
+			continue
+		}
+		for _, column := range columns {
+			if _, ok := fields[column]; !ok {
+				validation.MissingColumns[table] = append(validation.MissingColumns[table], column)
+			}
+		}
+	}
+	sort.Strings(validation.MissingTables)
+	validation.Valid = len(validation.MissingTables) == 0 && len(validation.MissingColumns) == 0
+
+	return validation, nil
 }
 
 type WordStats struct {
@@ -411,11 +1184,55 @@ type WordStats struct {
 	IgnoredCount  int `json:"ignored_count"`
 }
 
+// DueStats is a due forecast. StartDay/EndDay are the inclusive Migaku day
+// numbers the buckets cover and StartDate/EndDate the same days as dates.
 type DueStats struct {
 	Labels         []string `json:"labels"`
 	Counts         []int    `json:"counts"`
 	KnownCounts    []int    `json:"knownCounts"`
 	LearningCounts []int    `json:"learningCounts"`
+	StartDay       int      `json:"startDay"`
+	EndDay         int      `json:"endDay"`
+	StartDate      string   `json:"startDate"`
+	EndDate        string   `json:"endDate"`
+	// Granularity is how many days each entry covers: day, week or month.
+	Granularity string `json:"granularity"`
+}
+
+// Rebucket sums the per-day series into weeks or months and labels it in
+// locale, returning a new DueStats so the cached English daily one is left
+// alone. Each bucket is labelled with its first day in the range, so a
+// partial first week or month doesn't claim days before StartDay.
+func (ds *DueStats) Rebucket(granularity, locale string, loc *time.Location) *DueStats {
+	if granularity == ds.Granularity && locale == defaultLabelLocale {
+		return ds
+	}
+	labels := labelLocales[locale]
+
+	out := *ds
+	out.Granularity = granularity
+	out.Labels, out.Counts, out.KnownCounts, out.LearningCounts = []string{}, []int{}, []int{}, []int{}
+
+	last := -1
+	for i := range ds.Counts {
+		day := ds.StartDay + i
+		if start := bucketStart(day, granularity, loc); start != last {
+			last = start
+			label := labels.formatDay(dayStart(day, loc))
+			if granularity == granularityMonth {
+				label = labels.formatMonth(dayStart(day, loc))
+			}
+			out.Labels = append(out.Labels, label)
+			out.Counts = append(out.Counts, 0)
+			out.KnownCounts = append(out.KnownCounts, 0)
+			out.LearningCounts = append(out.LearningCounts, 0)
+		}
+		n := len(out.Counts) - 1
+		out.Counts[n] += ds.Counts[i]
+		out.KnownCounts[n] += ds.KnownCounts[i]
+		out.LearningCounts[n] += ds.LearningCounts[i]
+	}
+	return &out
 }
 
 type IntervalStats struct {
@@ -440,96 +1257,130 @@ type StudyStats struct {
 	AvgTimeNewCardSeconds    float64 `json:"avg_time_new_card_seconds"`
 	TotalTimeReviewsSeconds  int     `json:"total_time_reviews_seconds"`
 	AvgTimeReviewSeconds     float64 `json:"avg_time_review_seconds"`
+	// VacationDays is how many days were left out of the
+	// days_studied_percent denominator; only set with ExcludeVacations.
+	VacationDays int `json:"vacation_days,omitempty"`
+	// The inclusive window the period resolved to, as Migaku day numbers
+	// and dates; for "All time" it starts at the first review.
+	StartDay  int    `json:"start_day"`
+	EndDay    int    `json:"end_day"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	// Series is the per-day breakdown, only set with IncludeSeries.
+	Series *StudySeries `json:"series,omitempty"`
 }
 
-const msPerDay = int64(24 * 60 * 60 * 1000)
-
-func (s *MigakuService) GetWordStats(ctx context.Context, client *MigakuClient, lang, deckID string) (*WordStats, error) {
-	if lang == "" {
-		return nil, errors.New("lang parameter is required")
-	}
+// StudyStatsOptions changes what GetStudyStats counts.
+type StudyStatsOptions struct {
+	// IncludeLessonCards counts cards created by Migaku lessons as added.
+	IncludeLessonCards bool
+	// ExcludeVacations leaves vacation days the user didn't study on out of
+	// the days_studied_percent denominator, so a planned break doesn't
+	// count as missed days.
+	ExcludeVacations bool
+	// IncludeSeries adds the per-day review counts and time spent.
+	IncludeSeries bool
+}
 
-	useDeckFilter := deckID != "" && deckID != cacheAllKey
+// windowDateLayout formats the dates that bound a stats window.
+const windowDateLayout = "2006-01-02"
 
-	query := `
-  SELECT
-      SUM(CASE WHEN knownStatus = 'KNOWN' THEN 1 ELSE 0 END) as known_count,
-      SUM(CASE WHEN knownStatus = 'LEARNING' THEN 1 ELSE 0 END) as learning_count,
-      SUM(CASE WHEN knownStatus = 'UNKNOWN' THEN 1 ELSE 0 END) as unknown_count,
-      SUM(CASE WHEN knownStatus = 'IGNORED' THEN 1 ELSE 0 END) as ignored_count
-  FROM WordList
-  WHERE language = ? AND del = 0`
+const msPerDay = int64(24 * 60 * 60 * 1000)
 
-	params := []any{lang}
+// allLanguages is the lang value that asks the stats getters to aggregate
+// across every language instead of filtering to one.
+const allLanguages = "all"
 
-	if useDeckFilter {
-		query = `
-  SELECT
-    SUM(CASE WHEN w.knownStatus = 'KNOWN' THEN 1 ELSE 0 END) as known_count,
-    SUM(CASE WHEN w.knownStatus = 'LEARNING' THEN 1 ELSE 0 END) as learning_count,
-    SUM(CASE WHEN w.knownStatus = 'UNKNOWN' THEN 1 ELSE 0 END) as unknown_count,
-    SUM(CASE WHEN w.knownStatus = 'IGNORED' THEN 1 ELSE 0 END) as ignored_count
-  FROM (
-    SELECT DISTINCT w.dictForm, w.knownStatus
-    FROM WordList w
-    JOIN CardWordRelation cwr ON w.dictForm = cwr.dictForm
-    JOIN card c ON cwr.cardId = c.id
-    JOIN deck d ON c.deckId = d.id
-    WHERE w.language = ? AND w.del = 0 AND d.id = ? AND c.del = 0
-  ) as w`
-		params = []any{lang, deckID}
+// langArg returns the param for a stats language predicate. The predicates
+// are written as `lang = COALESCE(?, lang)`, so a nil param for allLanguages
+// matches every row while any deck filter still applies.
+func langArg(lang string) any {
+	if lang == allLanguages {
+		return nil
 	}
+	return lang
+}
 
-	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("stats:words:%s:%s", lang, deckID))
-	if cached, ok := s.cache.Get(cacheKey); ok {
-		if ws, ok := cached.(*WordStats); ok {
-			return ws, nil
-		}
-	}
+// reviewStatsFrom is the join and filter shared by every review aggregation:
+// reviews of one language (or all, see langArg) within an inclusive
+// day-number range.
+const reviewStatsFrom = `
+FROM review r
+JOIN card c ON r.cardId = c.id
+JOIN card_type ct ON c.cardTypeId = ct.id
+WHERE ct.lang = COALESCE(?, ct.lang) AND r.day BETWEEN ? AND ? AND r.del = 0`
 
-	type wordStatsRow struct {
-		KnownCount    int `db:"known_count"    json:"known_count"`
-		LearningCount int `db:"learning_count" json:"learning_count"`
-		UnknownCount  int `db:"unknown_count"  json:"unknown_count"`
-		IgnoredCount  int `db:"ignored_count"  json:"ignored_count"`
+const reviewTimeSelect = `
+  COALESCE(SUM(r.duration), 0) as total_time_seconds,
+  COUNT(*) as review_count,
+  COALESCE(ROUND(AVG(r.duration), 1), 0) as avg_time_seconds`
+
+// buildReviewStatsQuery composes a review aggregation from its select list and
+// any extra conditions, returning the query together with its params so the
+// optional deck filter can never fall out of step with its placeholder.
+func buildReviewStatsQuery(selectList, conditions, lang string, startDay, endDay int, deckID string) (string, []any) {
+	query := "\nSELECT" + selectList + reviewStatsFrom + conditions
+	return appendDeckFilter(query, []any{langArg(lang), startDay, endDay}, deckID)
+}
+
+// hasStatsCards reports whether any live card matches lang and deckID. The
+// due and study getters use it to skip their aggregations for empty accounts.
+func hasStatsCards(ctx context.Context, client *MigakuClient, lang, deckID string) (bool, error) {
+	query, params := appendDeckFilter(`
+SELECT 1 AS present
+FROM card c
+JOIN card_type ct ON c.cardTypeId = ct.id
+WHERE ct.lang = COALESCE(?, ct.lang) AND c.del = 0`, []any{langArg(lang)}, deckID)
+
+	type presentRow struct {
+		Present int `db:"present"`
 	}
 
-	rows, err := runQuery[wordStatsRow](ctx, client, query, params...)
+	rows, err := runQuery[presentRow](ctx, client, query+" LIMIT 1;", params...)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
+	return len(rows) > 0, nil
+}
 
-	stats := &WordStats{}
-	if len(rows) > 0 {
-		row := rows[0]
-		stats.KnownCount = row.KnownCount
-		stats.LearningCount = row.LearningCount
-		stats.UnknownCount = row.UnknownCount
-		stats.IgnoredCount = row.IgnoredCount
+// appendDeckFilter adds the card deck condition and its param when deckID
+// selects a specific deck.
+func appendDeckFilter(query string, params []any, deckID string) (string, []any) {
+	if deckID != "" && deckID != cacheAllKey {
+		query += deckIDClause
+		params = append(params, deckID)
 	}
-
-	s.cache.Set(cacheKey, stats)
-	return stats, nil
+	return query, params
 }
 
-func (s *MigakuService) GetDueStats(ctx context.Context, client *MigakuClient, lang, deckID, periodID string) (*DueStats, error) {
+func (s *MigakuService) GetWordStats(ctx context.Context, client *MigakuClient, lang, deckID string) (*WordStats, error) {
 	if lang == "" {
 		return nil, errors.New("lang parameter is required")
 	}
 
-	if periodID == "" {
-		periodID = "1 Month"
+	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("stats:words:%s:%s", lang, deckID))
+	if ws, ok := CacheGet[*WordStats](s.cache, cacheKey); ok {
+		return ws, nil
 	}
 
-	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("stats:due:%s:%s:%s", lang, deckID, periodID))
-	if cached, ok := s.cache.Get(cacheKey); ok {
-		if ds, ok := cached.(*DueStats); ok {
-			return ds, nil
-		}
+	// Same query as the status counts, so the two endpoints can't disagree
+	// for a deck and language.
+	rows, err := s.repo.GetStatusCounts(ctx, client, lang, deckID)
+	if err != nil {
+		return nil, err
 	}
 
-	currentDate := time.Now()
-	currentDate = time.Date(currentDate.Year(), currentDate.Month(), currentDate.Day(), 0, 0, 0, 0, currentDate.Location())
+	stats := WordStats(StatusCountsFromRows(rows))
+	CacheSet(s.cache, cacheKey, &stats)
+	return &stats, nil
+}
+
+// currentStudyDate returns the start of the day Migaku treats as today in
+// loc. The app stores its active study day in keyValue, which can lag the
+// calendar around midnight; it wins over the clock when present so "today"
+// matches the dashboard.
+func currentStudyDate(ctx context.Context, client *MigakuClient, loc *time.Location) time.Time {
+	currentDate := startOfDay(time.Now(), loc)
 
 	type currentDateRow struct {
 		Entry string `db:"entry" json:"entry"`
@@ -541,19 +1392,90 @@ FROM keyValue
 WHERE key = 'study.activeDay.currentDate';`)
 	if err == nil && len(dateRows) > 0 && dateRows[0].Entry != "" {
 		if parsed, parseErr := time.Parse("2006-01-02", dateRows[0].Entry); parseErr == nil {
-			currentDate = time.Date(parsed.Year(), parsed.Month(), parsed.Day(), 0, 0, 0, 0, currentDate.Location())
+			// The stored date is a bare calendar date; anchor it in loc
+			// rather than letting time.Parse place it at UTC midnight.
+			currentDate = time.Date(parsed.Year(), parsed.Month(), parsed.Day(), 0, 0, 0, 0, loc)
 		}
 	}
+	return currentDate
+}
+
+func (s *MigakuService) GetDueStats(
+	ctx context.Context,
+	client *MigakuClient,
+	lang, deckID, periodID string,
+	dates *DayRange,
+	today time.Time,
+	loc *time.Location,
+) (*DueStats, error) {
+	if lang == "" {
+		return nil, errors.New("lang parameter is required")
+	}
+
+	if periodID == "" {
+		periodID = s.defaultPeriod
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("stats:due:%s:%s:%s:%s:%s:%s",
+		lang, deckID, periodID, rangeKey(dates), todayKey(today), loc.String()))
+	if ds, ok := CacheGet[*DueStats](s.cache, cacheKey); ok {
+		return ds, nil
+	}
 
-	chartStartDate := time.Date(2020, time.January, 1, 0, 0, 0, 0, currentDate.Location())
-	currentDelta := currentDate.UnixMilli() - chartStartDate.UnixMilli()
-	currentDayNumber := int(currentDelta / msPerDay)
+	currentDate := currentStudyDate(ctx, client, loc)
+	if !today.IsZero() {
+		currentDate = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, loc)
+	}
+	currentDayNumber := dayNumber(currentDate, loc)
+	// A forecast starts today unless an explicit range says otherwise.
+	startDayNumber := currentDayNumber
+	if dates != nil {
+		startDayNumber = dates.From
+	}
+
+	hasCards, err := hasStatsCards(ctx, client, lang, deckID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasCards {
+		emptyEnd := startDayNumber
+		if dates != nil {
+			emptyEnd = dates.To
+		}
+		stats := &DueStats{
+			Labels:         []string{},
+			Counts:         []int{},
+			KnownCounts:    []int{},
+			LearningCounts: []int{},
+			StartDay:       startDayNumber,
+			EndDay:         emptyEnd,
+			StartDate:      dayStart(startDayNumber, loc).Format(windowDateLayout),
+			EndDate:        dayStart(emptyEnd, loc).Format(windowDateLayout),
+			Granularity:    granularityDay,
+		}
+		CacheSet(s.cache, cacheKey, stats)
+		return stats, nil
+	}
 
 	var forecastDays int
 	var endDayNumber int
 
-	switch periodID {
-	case periodAllTime:
+	var months int
+	var allTime bool
+	if dates == nil {
+		months, allTime, err = parsePeriod(periodID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case dates != nil:
+		endDayNumber = dates.To
+	case allTime:
 		forecastDays = 3650
 
 		type maxDueRow struct {
@@ -564,8 +1486,8 @@ WHERE key = 'study.activeDay.currentDate';`)
 SELECT MAX(due) as maxDue
 FROM card c
 JOIN card_type ct ON c.cardTypeId = ct.id
-WHERE ct.lang = ? AND c.due >= ? AND c.del = 0`
-		maxDueParams := []any{lang, currentDayNumber}
+WHERE ct.lang = COALESCE(?, ct.lang) AND c.due >= ? AND c.del = 0`
+		maxDueParams := []any{langArg(lang), currentDayNumber}
 		useDeckFilter := deckID != "" && deckID != cacheAllKey
 		if useDeckFilter {
 			maxDueQuery += deckIDClause
@@ -578,24 +1500,13 @@ WHERE ct.lang = ? AND c.due >= ? AND c.del = 0`
 		} else {
 			endDayNumber = currentDayNumber + forecastDays - 1
 		}
-	case "1 Year":
-		endDate := currentDate.AddDate(1, 0, 0)
-		diff := float64(endDate.UnixMilli()-currentDate.UnixMilli()) / float64(msPerDay)
-		forecastDays = max(int(math.Round(diff)), 1)
-		endDayNumber = currentDayNumber + (forecastDays - 1)
 	default:
-		monthsStr := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(periodID, " Months"), "Month"), "Months")
-		months, err := strconv.Atoi(strings.TrimSpace(monthsStr))
-		if err != nil || months <= 0 {
-			months = 1
-		}
 		endDate := currentDate.AddDate(0, months, 0)
-		diff := float64(endDate.UnixMilli()-currentDate.UnixMilli()) / float64(msPerDay)
-		forecastDays = max(int(math.Round(diff)), 1)
+		forecastDays = max(dayNumber(endDate, loc)-currentDayNumber, 1)
 		endDayNumber = currentDayNumber + (forecastDays - 1)
 	}
 
-	actualForecastDays := endDayNumber - currentDayNumber + 1
+	actualForecastDays := endDayNumber - startDayNumber + 1
 
 	type dueRow struct {
 		Due           int    `db:"due"            json:"due"`
@@ -613,9 +1524,9 @@ WHERE ct.lang = ? AND c.due >= ? AND c.del = 0`
     COUNT(*) as count
   FROM card c
   JOIN card_type ct ON c.cardTypeId = ct.id
-  WHERE ct.lang = ? AND c.due BETWEEN ? AND ? AND c.del = 0`
+  WHERE ct.lang = COALESCE(?, ct.lang) AND c.due BETWEEN ? AND ? AND c.del = 0`
 
-	params := []any{lang, currentDayNumber, endDayNumber}
+	params := []any{langArg(lang), startDayNumber, endDayNumber}
 	useDeckFilter := deckID != "" && deckID != cacheAllKey
 	if useDeckFilter {
 		query += deckIDClause
@@ -633,13 +1544,14 @@ WHERE ct.lang = ? AND c.due >= ? AND c.del = 0`
 	learningCounts := make([]int, actualForecastDays)
 	counts := make([]int, actualForecastDays)
 
+	// Labels and bucket indexes share the same calendar-day numbering, so a
+	// DST shift can never move a due count into a neighbouring day's label.
 	for i := range actualForecastDays {
-		d := chartStartDate.AddDate(0, 0, currentDayNumber+i)
-		labels[i] = d.Format("Jan 2, 2006")
+		labels[i] = dayStart(startDayNumber+i, loc).Format("Jan 2, 2006")
 	}
 
 	for _, row := range rows {
-		dayIndex := row.Due - currentDayNumber
+		dayIndex := row.Due - startDayNumber
 		if dayIndex < 0 || dayIndex >= actualForecastDays {
 			continue
 		}
@@ -652,7 +1564,7 @@ WHERE ct.lang = ? AND c.due >= ? AND c.del = 0`
 		counts[dayIndex] += row.Count
 	}
 
-	if periodID == periodAllTime {
+	if allTime {
 		lastNonZeroIndex := len(counts) - 1
 		for lastNonZeroIndex >= 0 && counts[lastNonZeroIndex] == 0 {
 			lastNonZeroIndex--
@@ -670,17 +1582,44 @@ WHERE ct.lang = ? AND c.due >= ? AND c.del = 0`
 		}
 	}
 
+	lastDayNumber := startDayNumber + len(counts) - 1
 	stats := &DueStats{
 		Labels:         labels,
 		Counts:         counts,
 		KnownCounts:    knownCounts,
 		LearningCounts: learningCounts,
+		StartDay:       startDayNumber,
+		EndDay:         lastDayNumber,
+		StartDate:      dayStart(startDayNumber, loc).Format(windowDateLayout),
+		EndDate:        dayStart(lastDayNumber, loc).Format(windowDateLayout),
+		Granularity:    granularityDay,
 	}
 
-	s.cache.Set(cacheKey, stats)
+	CacheSet(s.cache, cacheKey, stats)
 	return stats, nil
 }
 
+// ErrInvalidPercentile is returned for a percentile outside 1-100 or in an
+// unrecognised format.
+var ErrInvalidPercentile = errors.New("percentile must be an integer between 1 and 100")
+
+// parsePercentile accepts a bare number ("90") or an ordinal ("90th",
+// "1st", "2nd", "3rd"). Callers substitute their default for an empty value.
+func parsePercentile(percentileID string) (int, error) {
+	numStr := strings.TrimSpace(percentileID)
+	for _, suffix := range []string{"th", "st", "nd", "rd"} {
+		if trimmed, ok := strings.CutSuffix(numStr, suffix); ok {
+			numStr = trimmed
+			break
+		}
+	}
+	n, err := strconv.Atoi(numStr)
+	if err != nil || n < 1 || n > 100 {
+		return 0, ErrInvalidPercentile
+	}
+	return n, nil
+}
+
 func (s *MigakuService) GetIntervalStats(
 	ctx context.Context,
 	client *MigakuClient,
@@ -690,15 +1629,17 @@ func (s *MigakuService) GetIntervalStats(
 		return nil, errors.New("lang parameter is required")
 	}
 
-	if percentileID == "" {
-		percentileID = "75th"
+	percentileNum := s.defaultPercentile
+	if percentileID != "" {
+		var err error
+		if percentileNum, err = parsePercentile(percentileID); err != nil {
+			return nil, err
+		}
 	}
 
-	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("stats:interval:%s:%s:%s", lang, deckID, percentileID))
-	if cached, ok := s.cache.Get(cacheKey); ok {
-		if is, ok := cached.(*IntervalStats); ok {
-			return is, nil
-		}
+	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("stats:interval:%s:%s:%d", lang, deckID, percentileNum))
+	if is, ok := CacheGet[*IntervalStats](s.cache, cacheKey); ok {
+		return is, nil
 	}
 
 	type intervalRow struct {
@@ -712,9 +1653,9 @@ func (s *MigakuService) GetIntervalStats(
     COUNT(*) as count
   FROM card c
   JOIN card_type ct ON c.cardTypeId = ct.id
-  WHERE ct.lang = ? AND c.del = 0 AND c.interval > 0`
+  WHERE ct.lang = COALESCE(?, ct.lang) AND c.del = 0 AND c.interval > 0`
 
-	params := []any{lang}
+	params := []any{langArg(lang)}
 	useDeckFilter := deckID != "" && deckID != cacheAllKey
 	if useDeckFilter {
 		query += deckIDClause
@@ -728,7 +1669,7 @@ func (s *MigakuService) GetIntervalStats(
 	}
 	if len(rows) == 0 {
 		stats := &IntervalStats{Labels: []string{}, Counts: []int{}}
-		s.cache.Set(cacheKey, stats)
+		CacheSet(s.cache, cacheKey, stats)
 		return stats, nil
 	}
 
@@ -745,10 +1686,6 @@ func (s *MigakuService) GetIntervalStats(
 		totalCards += count
 	}
 
-	percentileNum, err := strconv.Atoi(strings.TrimSuffix(percentileID, "th"))
-	if err != nil || percentileNum <= 0 {
-		percentileNum = 75
-	}
 	cutoffPercentile := float64(percentileNum) / 100.0
 
 	sortedIntervals := make([]int, 0, len(intervalMap))
@@ -788,7 +1725,7 @@ func (s *MigakuService) GetIntervalStats(
 		Labels: labels,
 		Counts: counts,
 	}
-	s.cache.Set(cacheKey, stats)
+	CacheSet(s.cache, cacheKey, stats)
 	return stats, nil
 }
 
@@ -796,45 +1733,67 @@ func (s *MigakuService) GetStudyStats(
 	ctx context.Context,
 	client *MigakuClient,
 	lang, deckID, periodID string,
+	dates *DayRange,
+	today time.Time,
+	loc *time.Location,
+	opts StudyStatsOptions,
 ) (*StudyStats, error) {
 	if lang == "" {
 		return nil, errors.New("lang parameter is required")
 	}
 
 	if periodID == "" {
-		periodID = "1 Month"
+		periodID = s.defaultPeriod
+	}
+	if loc == nil {
+		loc = time.Local
 	}
 
-	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("stats:study:%s:%s:%s", lang, deckID, periodID))
-	if cached, ok := s.cache.Get(cacheKey); ok {
-		if ss, ok := cached.(*StudyStats); ok {
-			return ss, nil
-		}
+	cacheKey := s.scopedCacheKey(client, fmt.Sprintf("stats:study:%s:%s:%s:%s:%s:%s:%t:%t:%t",
+		lang, deckID, periodID, rangeKey(dates), todayKey(today), loc.String(),
+		opts.IncludeLessonCards, opts.ExcludeVacations, opts.IncludeSeries))
+	if ss, ok := CacheGet[*StudyStats](s.cache, cacheKey); ok {
+		return ss, nil
+	}
+
+	startDate := dayStart(0, loc)
+	currentDayNumber := dayNumber(time.Now(), loc)
+	// Cards added so far count towards the window; with a today override,
+	// so far is the end of that day.
+	cardsAddedUntil := time.Now()
+	if !today.IsZero() {
+		currentDayNumber = dayNumber(today, time.UTC)
+		cardsAddedUntil = dayStart(currentDayNumber+1, loc).Add(-time.Millisecond)
 	}
 
-	currentDate := time.Now()
-	currentDate = time.Date(currentDate.Year(), currentDate.Month(), currentDate.Day(), 0, 0, 0, 0, currentDate.Location())
-	startDate := time.Date(2020, time.January, 1, 0, 0, 0, 0, currentDate.Location())
-	currentDelta := currentDate.UnixMilli() - startDate.UnixMilli()
-	currentDayNumber := int(currentDelta / msPerDay)
+	var months int
+	var allTime bool
+	if dates == nil {
+		var err error
+		months, allTime, err = parsePeriod(periodID)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	var periodDays int
 	var startDayNumber int
+	endDayNumber := currentDayNumber
 	var earliestReviewDayForAllTime *int
 
-	if periodID == periodAllTime {
-		query := `
+	switch {
+	case dates != nil:
+		startDayNumber = dates.From
+		endDayNumber = dates.To
+		periodDays = dates.Days()
+		cardsAddedUntil = dayStart(dates.To+1, loc).Add(-time.Millisecond)
+	case allTime:
+		query, params := appendDeckFilter(`
 SELECT MIN(r.day) as minDay
 FROM review r
 JOIN card c ON r.cardId = c.id
 JOIN card_type ct ON c.cardTypeId = ct.id
-WHERE ct.lang = ? AND r.del = 0`
-		params := []any{lang}
-		useDeckFilter := deckID != "" && deckID != cacheAllKey
-		if useDeckFilter {
-			query += deckIDClause
-			params = append(params, deckID)
-		}
+WHERE ct.lang = COALESCE(?, ct.lang) AND r.del = 0`, []any{langArg(lang)}, deckID)
 
 		type minDayRow struct {
 			MinDay *int `db:"minDay" json:"minDay"`
@@ -849,27 +1808,10 @@ WHERE ct.lang = ? AND r.del = 0`
 			periodDays = currentDayNumber + 1
 			startDayNumber = 0
 		}
-	} else {
-		var months int
-		if strings.Contains(periodID, "Year") {
-			numStr := strings.TrimSpace(strings.TrimSuffix(strings.ReplaceAll(periodID, "Years", ""), "Year"))
-			n, err := strconv.Atoi(numStr)
-			if err != nil || n <= 0 {
-				n = 1
-			}
-			months = n * 12
-		} else {
-			numStr := strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(periodID, " Months"), "Month"), "Months"))
-			n, err := strconv.Atoi(numStr)
-			if err != nil || n <= 0 {
-				n = 1
-			}
-			months = n
-		}
-
-		today := startDate.AddDate(0, 0, currentDayNumber)
-		periodStartDate := today.AddDate(0, -months, 0)
-		diff := float64(today.UnixMilli()-periodStartDate.UnixMilli()) / float64(msPerDay)
+	default:
+		periodEnd := startDate.AddDate(0, 0, currentDayNumber)
+		periodStartDate := periodEnd.AddDate(0, -months, 0)
+		diff := float64(periodEnd.UnixMilli()-periodStartDate.UnixMilli()) / float64(msPerDay)
 		periodDays = int(math.Round(diff)) + 1
 		if periodDays <= 0 {
 			periodDays = 1
@@ -877,128 +1819,75 @@ WHERE ct.lang = ? AND r.del = 0`
 		startDayNumber = currentDayNumber - periodDays + 1
 	}
 
-	studyQuery := `
-SELECT
-  COUNT(DISTINCT r.day) as days_studied,
-  COUNT(*) as total_reviews
-FROM review r
-JOIN card c ON r.cardId = c.id
-JOIN card_type ct ON c.cardTypeId = ct.id
-WHERE ct.lang = ? AND r.day BETWEEN ? AND ? AND r.del = 0`
-	studyParams := []any{lang, startDayNumber, currentDayNumber}
+	startDayDate := dayStart(startDayNumber, loc)
 
-	// #nosec G101 -- SQL query string, no credentials.
-	passRateQuery := `
-SELECT
-  SUM(CASE WHEN r.type = 2 THEN 1 ELSE 0 END) as successful_reviews,
-  SUM(CASE WHEN r.type = 1 THEN 1 ELSE 0 END) as failed_reviews
-FROM review r
-JOIN card c ON r.cardId = c.id
-JOIN card_type ct ON c.cardTypeId = ct.id
-WHERE ct.lang = ? AND r.day BETWEEN ? AND ? AND r.del = 0 AND r.type IN (1, 2)`
-	passRateParams := []any{lang, startDayNumber, currentDayNumber}
+	// With no cards there are no reviews or added cards either; skip the
+	// aggregations below and report a zeroed period.
+	hasCards, err := hasStatsCards(ctx, client, lang, deckID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasCards {
+		stats := &StudyStats{
+			PeriodDays: max(periodDays, 1),
+			StartDay:   startDayNumber,
+			EndDay:     endDayNumber,
+			StartDate:  startDayDate.Format(windowDateLayout),
+			EndDate:    dayStart(endDayNumber, loc).Format(windowDateLayout),
+		}
+		if opts.IncludeSeries {
+			stats.Series = newStudySeries(startDayNumber, endDayNumber, loc)
+		}
+		CacheSet(s.cache, cacheKey, stats)
+		return stats, nil
+	}
 
-	newCardsQuery := `
-SELECT
-  COUNT(DISTINCT r.cardId) as new_cards_reviewed
-FROM review r
-JOIN card c ON r.cardId = c.id
-JOIN card_type ct ON c.cardTypeId = ct.id
-WHERE ct.lang = ? AND r.day BETWEEN ? AND ? AND r.del = 0 AND r.type = 0`
-	newCardsParams := []any{lang, startDayNumber, currentDayNumber}
+	studyQuery, studyParams := buildReviewStatsQuery(`
+  COUNT(DISTINCT r.day) as days_studied,
+  COUNT(*) as total_reviews`, "", lang, startDayNumber, endDayNumber, deckID)
 
-	cardsAddedQuery := `
+	// #nosec G101 -- SQL query string, no credentials.
+	passRateQuery, passRateParams := buildReviewStatsQuery(`
+  COALESCE(SUM(CASE WHEN r.type = 2 THEN 1 ELSE 0 END), 0) as successful_reviews,
+  COALESCE(SUM(CASE WHEN r.type = 1 THEN 1 ELSE 0 END), 0) as failed_reviews`,
+		" AND r.type IN (1, 2)", lang, startDayNumber, endDayNumber, deckID)
+
+	newCardsQuery, newCardsParams := buildReviewStatsQuery(`
+  COUNT(DISTINCT r.cardId) as new_cards_reviewed`,
+		" AND r.type = 0", lang, startDayNumber, endDayNumber, deckID)
+
+	// Cards created by Migaku lessons carry the lesson's ID in lessonId;
+	// cards the user added themselves have it empty. Only the latter count
+	// as "added" unless lesson cards are asked for.
+	cardsAddedSQL := `
 SELECT
   COUNT(*) as cards_added
 FROM card c
 JOIN card_type ct ON c.cardTypeId = ct.id
-WHERE ct.lang = ? AND c.created >= ? AND c.created <= ? AND c.del = 0 AND c.lessonId = ''`
-
-	startDayDate := startDate.AddDate(0, 0, startDayNumber)
-	startDayDate = time.Date(startDayDate.Year(), startDayDate.Month(), startDayDate.Day(), 0, 0, 0, 0, startDayDate.Location())
-	cardsAddedParams := []any{lang, startDayDate.UnixMilli(), time.Now().UnixMilli()}
-
-	cardsLearnedQuery := `
-SELECT
-  COUNT(DISTINCT c.id) as cards_learned
-FROM review r
-JOIN card c ON r.cardId = c.id
-JOIN card_type ct ON c.cardTypeId = ct.id
-WHERE ct.lang = ? AND r.day BETWEEN ? AND ? AND r.del = 0
-  AND c.interval >= 20 AND r.interval < 20 AND r.type = 2`
-	cardsLearnedParams := []any{lang, startDayNumber, currentDayNumber}
-
-	totalNewCardsQuery := `
-SELECT
-  COUNT(DISTINCT r.cardId) as total_new_cards
-FROM review r
-JOIN card c ON r.cardId = c.id
-JOIN card_type ct ON c.cardTypeId = ct.id
-WHERE ct.lang = ? AND r.day BETWEEN ? AND ? AND c.del = 0 AND r.del = 0 AND r.type = 0`
-	totalNewCardsParams := []any{lang, startDayNumber, currentDayNumber}
-
-	cardsLearnedPerDayQuery := `
-SELECT
-  ROUND(COUNT(DISTINCT c.id) * 1.0 / NULLIF(COUNT(DISTINCT r.day), 0), 1) as cards_learned_per_day
-FROM review r
-JOIN card c ON r.cardId = c.id
-JOIN card_type ct ON c.cardTypeId = ct.id
-WHERE ct.lang = ? AND r.day BETWEEN ? AND ? AND r.del = 0
-  AND c.interval >= 20 AND r.interval < 20 AND r.type = 2`
-	cardsLearnedPerDayParams := []any{lang, startDayNumber, currentDayNumber}
-
-	newCardsTimeQuery := `
-SELECT
-  SUM(r.duration) as total_time_seconds,
-  COUNT(*) as review_count,
-  ROUND(AVG(r.duration), 1) as avg_time_seconds
-FROM review r
-JOIN card c ON r.cardId = c.id
-JOIN card_type ct ON c.cardTypeId = ct.id
-WHERE ct.lang = ? AND r.day BETWEEN ? AND ? AND r.del = 0 AND r.type = 0`
-	newCardsTimeParams := []any{lang, startDayNumber, currentDayNumber}
-
-	reviewsTimeQuery := `
-SELECT
-  SUM(r.duration) as total_time_seconds,
-  COUNT(*) as review_count,
-  ROUND(AVG(r.duration), 1) as avg_time_seconds
-FROM review r
-JOIN card c ON r.cardId = c.id
-JOIN card_type ct ON c.cardTypeId = ct.id
-WHERE ct.lang = ? AND r.day BETWEEN ? AND ? AND r.del = 0 AND r.type IN (1, 2)`
-	reviewsTimeParams := []any{lang, startDayNumber, currentDayNumber}
-
-	useDeckFilter := deckID != "" && deckID != cacheAllKey
-	if useDeckFilter {
-		studyQuery += deckIDClause
-		studyParams = append(studyParams, deckID)
-
-		// #nosec G101 -- SQL query string, no credentials.
-		passRateQuery += deckIDClause
-		passRateParams = append(passRateParams, deckID)
-
-		newCardsQuery += deckIDClause
-		newCardsParams = append(newCardsParams, deckID)
-
-		cardsAddedQuery += deckIDClause
-		cardsAddedParams = append(cardsAddedParams, deckID)
+WHERE ct.lang = COALESCE(?, ct.lang) AND c.created >= ? AND c.created <= ? AND c.del = 0`
+	if !opts.IncludeLessonCards {
+		cardsAddedSQL += " AND c.lessonId = ''"
+	}
+	cardsAddedQuery, cardsAddedParams := appendDeckFilter(cardsAddedSQL,
+		[]any{langArg(lang), startDayDate.UnixMilli(), cardsAddedUntil.UnixMilli()}, deckID)
 
-		cardsLearnedQuery += deckIDClause
-		cardsLearnedParams = append(cardsLearnedParams, deckID)
+	cardsLearnedQuery, cardsLearnedParams := buildReviewStatsQuery(`
+  COUNT(DISTINCT c.id) as cards_learned`,
+		"\n  AND c.interval >= 20 AND r.interval < 20 AND r.type = 2", lang, startDayNumber, endDayNumber, deckID)
 
-		totalNewCardsQuery += deckIDClause
-		totalNewCardsParams = append(totalNewCardsParams, deckID)
+	totalNewCardsQuery, totalNewCardsParams := buildReviewStatsQuery(`
+  COUNT(DISTINCT r.cardId) as total_new_cards`,
+		" AND c.del = 0 AND r.type = 0", lang, startDayNumber, endDayNumber, deckID)
 
-		cardsLearnedPerDayQuery += deckIDClause
-		cardsLearnedPerDayParams = append(cardsLearnedPerDayParams, deckID)
+	cardsLearnedPerDayQuery, cardsLearnedPerDayParams := buildReviewStatsQuery(`
+  COALESCE(ROUND(COUNT(DISTINCT c.id) * 1.0 / NULLIF(COUNT(DISTINCT r.day), 0), 1), 0) as cards_learned_per_day`,
+		"\n  AND c.interval >= 20 AND r.interval < 20 AND r.type = 2", lang, startDayNumber, endDayNumber, deckID)
 
-		newCardsTimeQuery += deckIDClause
-		newCardsTimeParams = append(newCardsTimeParams, deckID)
+	newCardsTimeQuery, newCardsTimeParams := buildReviewStatsQuery(reviewTimeSelect,
+		" AND r.type = 0", lang, startDayNumber, endDayNumber, deckID)
 
-		reviewsTimeQuery += deckIDClause
-		reviewsTimeParams = append(reviewsTimeParams, deckID)
-	}
+	reviewsTimeQuery, reviewsTimeParams := buildReviewStatsQuery(reviewTimeSelect,
+		" AND r.type IN (1, 2)", lang, startDayNumber, endDayNumber, deckID)
 
 	type studyRow struct {
 		DaysStudied  int `db:"days_studied"  json:"days_studied"`
@@ -1087,7 +1976,7 @@ WHERE ct.lang = ? AND r.day BETWEEN ? AND ? AND r.del = 0 AND r.type IN (1, 2)`
 	}
 
 	var denominator int
-	if periodID == periodAllTime && daysStudied > 0 && earliestReviewDayForAllTime != nil {
+	if allTime && daysStudied > 0 && earliestReviewDayForAllTime != nil {
 		denominator = currentDayNumber - *earliestReviewDayForAllTime + 1
 	} else {
 		if periodDays <= 0 {
@@ -1095,6 +1984,14 @@ WHERE ct.lang = ? AND r.day BETWEEN ? AND ? AND r.del = 0 AND r.type IN (1, 2)`
 		}
 		denominator = periodDays
 	}
+	var vacationDayCount int
+	if opts.ExcludeVacations {
+		vacationDayCount, err = vacationDays(ctx, client, lang, deckID, startDayNumber, endDayNumber)
+		if err != nil {
+			return nil, err
+		}
+		denominator -= vacationDayCount
+	}
 	daysStudiedPercent := 0
 	if denominator > 0 {
 		daysStudiedPercent = int(math.Round((float64(daysStudied) / float64(denominator)) * 100))
@@ -1187,8 +2084,19 @@ WHERE ct.lang = ? AND r.day BETWEEN ? AND ? AND r.del = 0 AND r.type IN (1, 2)`
 		AvgTimeNewCardSeconds:    avgTimeNewCardSeconds,
 		TotalTimeReviewsSeconds:  totalTimeReviewsSeconds,
 		AvgTimeReviewSeconds:     avgTimeReviewSeconds,
+		VacationDays:             vacationDayCount,
+		StartDay:                 startDayNumber,
+		EndDay:                   endDayNumber,
+		StartDate:                dayStart(startDayNumber, loc).Format(windowDateLayout),
+		EndDate:                  dayStart(endDayNumber, loc).Format(windowDateLayout),
+	}
+	if opts.IncludeSeries {
+		stats.Series, err = loadStudySeries(ctx, client, lang, deckID, startDayNumber, endDayNumber, loc)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	s.cache.Set(cacheKey, stats)
+	CacheSet(s.cache, cacheKey, stats)
 	return stats, nil
 }
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestGetDueStatsAcrossDST forecasts over the 2024-03-10 spring forward in
+// New York, a 23-hour day, and checks each label names the day its bucket
+// counts.
+func TestGetDueStatsAcrossDST(t *testing.T) {
+	const mar10 = 1530 // 2024-03-10
+	due := map[int]int{mar10 - 2: 1, mar10 - 1: 2, mar10: 3, mar10 + 1: 4, mar10 + 2: 5}
+
+	var extra []string
+	id := 100
+	for day, n := range due {
+		for range n {
+			extra = append(extra, fmt.Sprintf(
+				`INSERT INTO card (id, deckId, cardTypeId, del, due, interval) VALUES (%d, 1, 1, 0, %d, 30)`, id, day))
+			id++
+		}
+	}
+	client := newTestClient(t, extra...)
+	svc := NewMigakuService(NewRepository(), NewCache(time.Minute))
+	loc := mustLoadLocation(t, "America/New_York")
+
+	today := time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)
+	stats, err := svc.GetDueStats(context.Background(), client, "ja", "", "1 Month", nil, today, loc)
+	if err != nil {
+		t.Fatalf("GetDueStats: %v", err)
+	}
+
+	if stats.StartDay != mar10-2 || stats.StartDate != "2024-03-08" {
+		t.Fatalf("forecast starts on day %d (%s), want %d (2024-03-08)", stats.StartDay, stats.StartDate, mar10-2)
+	}
+	// Mar 8 to Apr 8 is 31 calendar days even though one of them is an
+	// hour short.
+	if len(stats.Labels) != 31 || len(stats.Counts) != 31 {
+		t.Fatalf("%d labels and %d buckets, want 31 of each", len(stats.Labels), len(stats.Counts))
+	}
+	for i, label := range stats.Labels {
+		day := stats.StartDay + i
+		wantLabel := migakuEpoch.AddDate(0, 0, day).Format("Jan 2, 2006")
+		if label != wantLabel {
+			t.Errorf("label %d = %q, want %q", i, label, wantLabel)
+		}
+		if stats.Counts[i] != due[day] {
+			t.Errorf("bucket %d (%s) = %d, want %d", i, label, stats.Counts[i], due[day])
+		}
+	}
+}
+
+func TestGetDatabaseSchemaReturnsCopies(t *testing.T) {
+	client := newTestClient(t)
+	svc := NewMigakuService(NewRepository(), NewCache(time.Minute))
+	ctx := context.Background()
+
+	first, err := svc.GetDatabaseSchema(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := first["deck"]["name"]
+	delete(first, "vacation")
+	first["deck"]["name"] = FieldMetadata{Type: "BLOB", NotNull: true}
+	first["extra"] = map[string]FieldMetadata{}
+
+	second, err := svc.GetDatabaseSchema(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := second["vacation"]; !ok {
+		t.Error("deleting a table from a returned schema removed it from the cache")
+	}
+	if got := second["deck"]["name"]; got != want {
+		t.Errorf("deck.name = %+v after editing a returned schema, want %+v", got, want)
+	}
+	if _, ok := second["extra"]; ok {
+		t.Error("a table added to a returned schema reached the cache")
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		name        string
+		extra       []string
+		wantTables  []string
+		wantColumns map[string][]string
+	}{
+		{"complete", nil, []string{}, map[string][]string{}},
+		{"missing table", []string{`DROP TABLE vacation`}, []string{"vacation"}, map[string][]string{}},
+		{"missing columns", []string{
+			`ALTER TABLE review DROP COLUMN duration`,
+			`ALTER TABLE deck DROP COLUMN name`,
+			`ALTER TABLE WordList DROP COLUMN tracked`,
+		}, []string{}, map[string][]string{"review": {"duration"}, "deck": {"name"}, "WordList": {"tracked"}}},
+		{"both", []string{
+			`DROP TABLE keyValue`,
+			`ALTER TABLE card_type DROP COLUMN lang`,
+		}, []string{"keyValue"}, map[string][]string{"card_type": {"lang"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, tt.extra...)
+			svc := NewMigakuService(NewRepository(), NewCache(time.Minute))
+
+			got, err := svc.ValidateSchema(context.Background(), client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.MissingTables, tt.wantTables) {
+				t.Errorf("MissingTables = %v, want %v", got.MissingTables, tt.wantTables)
+			}
+			if !reflect.DeepEqual(got.MissingColumns, tt.wantColumns) {
+				t.Errorf("MissingColumns = %v, want %v", got.MissingColumns, tt.wantColumns)
+			}
+			if wantValid := tt.extra == nil; got.Valid != wantValid {
+				t.Errorf("Valid = %v, want %v", got.Valid, wantValid)
+			}
+		})
+	}
+}
+
+func TestWordFilterCacheKeysDistinct(t *testing.T) {
+	filters := []WordFilter{
+		{},
+		{Lang: "ja"},
+		{Lang: "all"},
+		{Lang: "en"},
+		{Status: dbStatusKnown},
+		{Status: dbStatusKnown, Lang: "ja"},
+		{DeckID: "1"},
+		{DeckID: "12"},
+		{Form: "all"},
+		{Form: "本"},
+		{Form: "本", FormExact: true},
+		{Form: `本":exact:true`},
+		{Form: "a:lang:ja"},
+		{Form: "a", Lang: "ja"},
+		{SinceCreated: 1},
+		{IncludeIgnored: true},
+	}
+	seen := map[string]WordFilter{}
+	for _, f := range filters {
+		key := f.cacheKey()
+		if other, ok := seen[key]; ok {
+			t.Errorf("%+v and %+v share cache key %s", f, other, key)
+		}
+		seen[key] = f
+	}
+}
+
+func TestRankedCacheKeysDistinct(t *testing.T) {
+	keys := []rankedKey{
+		{},
+		{Lang: "ja"},
+		{Lang: "all"},
+		{Lang: "ja DeckID:1"},
+		{Lang: "ja", DeckID: "1"},
+		{Lang: "ja", DeckID: "1 DeckID:"},
+		{Lang: "ja", Limit: 10},
+		{Lang: "ja", Limit: 10, Offset: 10},
+		{Lang: "ja", Limit: 20},
+		{Lang: "ja", Offset: 10},
+		{Lang: "ja", MinReviews: 5},
+		{Lang: "ja", FromDay: 5},
+		{Lang: "ja", Sort: difficultSortWeighted},
+	}
+	seen := map[string]rankedKey{}
+	for _, kind := range []string{"difficult:words", "difficult:count"} {
+		for _, k := range keys {
+			key := buildRankedCacheKey(kind, k)
+			if _, ok := seen[key]; ok {
+				t.Errorf("%s %+v shares cache key %s", kind, k, key)
+			}
+			seen[key] = k
+		}
+	}
+}
+
+// TestGetWordsCacheKeepsRequestsApart runs requests that used to share a
+// cache entry through one service, each after the other has been cached.
+func TestGetWordsCacheKeepsRequestsApart(t *testing.T) {
+	client := newTestClient(t)
+	svc := NewMigakuService(NewRepository(), NewCache(time.Minute))
+	ctx := context.Background()
+
+	words := func(filter WordFilter, limit, offset int) []string {
+		t.Helper()
+		got, err := svc.GetWords(ctx, client, filter, limit, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forms := make([]string, len(got))
+		for i, w := range got {
+			forms[i] = w.DictForm
+		}
+		return forms
+	}
+
+	if all := words(WordFilter{}, 0, 0); len(all) == 0 {
+		t.Fatal("no words in the fixture")
+	}
+	if got := words(WordFilter{Lang: "all"}, 0, 0); len(got) != 0 {
+		t.Errorf("lang=all served %v, want no words in a language called all", got)
+	}
+	if got := words(WordFilter{Form: "all"}, 0, 0); len(got) != 0 {
+		t.Errorf("form=all served %v, want no words containing all", got)
+	}
+
+	first, second := words(WordFilter{Lang: "ja"}, 2, 0), words(WordFilter{Lang: "ja"}, 2, 2)
+	if len(first) != 2 || len(second) != 2 || slices.Equal(first, second) {
+		t.Errorf("pages 1 and 2 = %v and %v, want two different pages of 2", first, second)
+	}
+	if wider := words(WordFilter{Lang: "ja"}, 3, 0); len(wider) != 3 {
+		t.Errorf("limit 3 after limit 2 served %v", wider)
+	}
+}
+
+func TestParsePercentile(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"1", 1, false},
+		{"50", 50, false},
+		{"99", 99, false},
+		{"100", 100, false},
+		{" 90 ", 90, false},
+		{"75th", 75, false},
+		{"1st", 1, false},
+		{"2nd", 2, false},
+		{"3rd", 3, false},
+		{"100th", 100, false},
+		{"0", 0, true},
+		{"101", 0, true},
+		{"-1", 0, true},
+		{"0th", 0, true},
+		{"101st", 0, true},
+		{"p90", 0, true},
+		{"90%", 0, true},
+		{"50.5", 0, true},
+		{"th", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePercentile(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidPercentile) {
+				t.Errorf("parsePercentile(%q) = %d, %v; want ErrInvalidPercentile", tt.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parsePercentile(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+// englishCatSQL adds an English deck with one card for 猫, spelled as the
+// Japanese fixture word, with six failed reviews one a day back from today.
+func englishCatSQL() []string {
+	today := dayNumber(time.Now(), time.UTC)
+	extra := []string{
+		`INSERT INTO card_type VALUES (2, 'en', 'Sentence', '{}', 0, 0, 0)`,
+		`INSERT INTO deck VALUES (3, 'en', 'English', 0, 0, 0)`,
+		`INSERT INTO WordList VALUES ('猫', '', 'NOUN', 'en', 0, 0, 0, 'LEARNING', 1, 0, 0, 1, 1, 0, 0)`,
+		fmt.Sprintf(`INSERT INTO card VALUES (10, 3, 2, 0, 0, 0, 0, %d, 1, 2.5, %d, 6, 6, '', '猫', '', '[]', '[]')`, today, today),
+		`INSERT INTO CardWordRelation VALUES (10, '猫', '', 'NOUN', 'en', 1, 0, 0, 0)`,
+	}
+	for k := range 6 {
+		extra = append(extra, fmt.Sprintf(`INSERT INTO review VALUES (%d, 10, %d, 1, 2.5, 1, 5, 0, 0, 0)`, 200+k, today-k))
+	}
+	return extra
+}
+
+// TestLanguageSwitchOnOneClient reads the same client in one language, then
+// another, then all of them, through one cache.
+func TestLanguageSwitchOnOneClient(t *testing.T) {
+	client := newTestClient(t, englishCatSQL()...)
+	svc := NewMigakuService(NewRepository(), NewCache(time.Minute))
+	ctx := context.Background()
+
+	// The fixture's Japanese cards have 3+4+...+8 reviews.
+	wantReviews := map[string]int{"ja": 33, "en": 6, allLanguages: 39}
+	for _, lang := range []string{"ja", "en", allLanguages, "ja"} {
+		stats, err := svc.GetStudyStats(ctx, client, lang, "", "1 Month", nil, time.Now(), time.UTC, StudyStatsOptions{})
+		if err != nil {
+			t.Fatalf("GetStudyStats(%s): %v", lang, err)
+		}
+		if stats.TotalReviews != wantReviews[lang] {
+			t.Errorf("lang %s: %d reviews, want %d", lang, stats.TotalReviews, wantReviews[lang])
+		}
+	}
+
+	wantDecks := map[string][]string{"ja": {"Main", "Other"}, "en": {"English"}}
+	for _, lang := range []string{"ja", "en"} {
+		decks, err := svc.GetDecks(ctx, client, DeckFilter{Lang: lang}, 0, 0)
+		if err != nil {
+			t.Fatalf("GetDecks(%s): %v", lang, err)
+		}
+		var names []string
+		for _, d := range decks {
+			names = append(names, d.Name)
+		}
+		slices.Sort(names)
+		if !slices.Equal(names, wantDecks[lang]) {
+			t.Errorf("lang %s decks = %v, want %v", lang, names, wantDecks[lang])
+		}
+	}
+
+	// 猫 is spelled the same in both languages; each only counts its own
+	// language's card.
+	wantCat := map[string][2]int{"ja": {7, 4}, "en": {6, 6}}
+	for _, lang := range []string{"ja", "en"} {
+		words, err := svc.GetDifficultWords(ctx, client, lang, 50, 0, "", 1, 0, "")
+		if err != nil {
+			t.Fatalf("GetDifficultWords(%s): %v", lang, err)
+		}
+		i := slices.IndexFunc(words, func(w DifficultWord) bool { return w.DictForm == "猫" })
+		if i < 0 {
+			t.Fatalf("lang %s: 猫 not ranked", lang)
+		}
+		got := [2]int{words[i].TotalReviews, words[i].FailedReviews}
+		if got != wantCat[lang] {
+			t.Errorf("lang %s: 猫 has %d reviews, %d failed; want %d, %d", lang, got[0], got[1], wantCat[lang][0], wantCat[lang][1])
+		}
+	}
+}
+
+// TestStudyStatsFields pins every StudyStats field over the fixture, with and
+// without a deck filter. A new-card review of 本 (deck 1) and 猫 (deck 2)
+// today makes the new-card fields non-zero.
+func TestStudyStatsFields(t *testing.T) {
+	today := dayNumber(time.Now(), time.UTC)
+	client := newTestClient(t, fmt.Sprintf(
+		`INSERT INTO review VALUES (100, 1, %d, 0, 2.5, 0, 20, 0, 0, 0), (101, 5, %d, 0, 2.5, 0, 40, 0, 0, 0)`, today, today))
+	svc := NewMigakuService(NewRepository(), NewCache(time.Minute))
+	date := func(day int) string { return dayStart(day, time.UTC).Format(windowDateLayout) }
+
+	// Answered reviews alternate failed and passed from today back, so the
+	// fixture has 18 failures to 15 passes (10 to 8 in deck 1), each taking
+	// 5+k seconds. Cards 4-6 have a 20+ day interval and count as learned;
+	// cards 1-3 were created within the last week.
+	tests := []struct {
+		deckID string
+		want   StudyStats
+	}{
+		{"", StudyStats{
+			DaysStudied:              8,
+			DaysStudiedPercent:       100,
+			TotalReviews:             35,
+			AvgReviewsPerCalendarDay: 4.4,
+			PeriodDays:               8,
+			PassRate:                 -20,
+			NewCardsPerDay:           0.3,
+			TotalNewCards:            2,
+			TotalCardsAdded:          3,
+			CardsAddedPerDay:         0.4,
+			TotalCardsLearned:        3,
+			CardsLearnedPerDay:       0.8,
+			TotalTimeNewCardsSeconds: 60,
+			AvgTimeNewCardSeconds:    30,
+			TotalTimeReviewsSeconds:  248,
+			AvgTimeReviewSeconds:     7.5,
+			StartDay:                 today - 7,
+			EndDay:                   today,
+			StartDate:                date(today - 7),
+			EndDate:                  date(today),
+		}},
+		{"1", StudyStats{
+			DaysStudied:              6,
+			DaysStudiedPercent:       100,
+			TotalReviews:             19,
+			AvgReviewsPerCalendarDay: 3.2,
+			PeriodDays:               6,
+			PassRate:                 -25,
+			NewCardsPerDay:           0.2,
+			TotalNewCards:            1,
+			TotalCardsAdded:          2,
+			CardsAddedPerDay:         0.3,
+			TotalCardsLearned:        1,
+			CardsLearnedPerDay:       0.3,
+			TotalTimeNewCardsSeconds: 20,
+			AvgTimeNewCardSeconds:    20,
+			TotalTimeReviewsSeconds:  124,
+			AvgTimeReviewSeconds:     6.9,
+			StartDay:                 today - 5,
+			EndDay:                   today,
+			StartDate:                date(today - 5),
+			EndDate:                  date(today),
+		}},
+	}
+	for _, tt := range tests {
+		got, err := svc.GetStudyStats(context.Background(), client, "ja", tt.deckID, periodAllTime, nil, time.Now(), time.UTC, StudyStatsOptions{})
+		if err != nil {
+			t.Fatalf("deck %q: %v", tt.deckID, err)
+		}
+		if *got != tt.want {
+			t.Errorf("deck %q:\n got %+v\nwant %+v", tt.deckID, *got, tt.want)
+		}
+	}
+}
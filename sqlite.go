@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// defaultSQLitePragmas are applied to every connection on a local snapshot.
+// The file is replaced on each refresh and only word status updates write to
+// it, so the read handle is query_only (the write handle never is), temp
+// b-trees stay in memory and there is a 16 MiB page cache. busy_timeout lets
+// the read and write handles wait out each other's locks.
+var defaultSQLitePragmas = []string{"query_only=1", "temp_store=MEMORY", "cache_size=-16000", "busy_timeout=5000"}
+
+// safeSQLitePragmas are the pragmas SQLITE_PRAGMAS may set. Anything that
+// changes the file format or journal is left out.
+var safeSQLitePragmas = []string{"busy_timeout", "cache_size", "mmap_size", "query_only", "synchronous", "temp_store"}
+
+var sqlitePragmaValue = regexp.MustCompile(`^-?[A-Za-z0-9_]+$`)
+
+// sqlitePragmas is the effective pragma list, set once at startup.
+var sqlitePragmas = defaultSQLitePragmas
+
+// configureSQLitePragmas overrides or extends the default pragmas with a
+// comma-separated list of name=value pairs, e.g. "cache_size=-64000,query_only=0".
+func configureSQLitePragmas(spec string) error {
+	if strings.TrimSpace(spec) == "" {
+		return nil
+	}
+
+	pragmas := slices.Clone(defaultSQLitePragmas)
+	for entry := range strings.SplitSeq(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		name, value = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(value)
+		if !ok || !sqlitePragmaValue.MatchString(value) {
+			return fmt.Errorf("invalid pragma %q: expected name=value", entry)
+		}
+		if !slices.Contains(safeSQLitePragmas, name) {
+			return fmt.Errorf("pragma %q is not allowed; allowed: %s", name, strings.Join(safeSQLitePragmas, ", "))
+		}
+		pragmas = slices.DeleteFunc(pragmas, func(p string) bool {
+			return strings.HasPrefix(p, name+"=")
+		})
+		pragmas = append(pragmas, name+"="+value)
+	}
+	sqlitePragmas = pragmas
+	return nil
+}
+
+// openSnapshotDB opens the local snapshot at path on a single connection.
+// The pragmas are passed in the DSN rather than executed once, so the driver
+// reapplies them if the pool ever replaces the connection. A writable handle
+// gets the same pragmas except query_only.
+func openSnapshotDB(path string, writable bool) (*sqlx.DB, error) {
+	query := url.Values{}
+	for _, pragma := range sqlitePragmas {
+		if writable && strings.HasPrefix(pragma, "query_only=") {
+			continue
+		}
+		query.Add("_pragma", pragma)
+	}
+
+	db, err := sqlx.Open("sqlite", path+"?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	return db, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Sections a stats batch can ask for.
+const (
+	statsSectionWord     = "word"
+	statsSectionDue      = "due"
+	statsSectionInterval = "interval"
+	statsSectionStudy    = "study"
+)
+
+// allStatsSections is what a batch returns when it doesn't name any sections.
+var allStatsSections = []string{statsSectionWord, statsSectionDue, statsSectionInterval, statsSectionStudy}
+
+// StatsBatchQuery holds the parameters shared by every section of a batch.
+type StatsBatchQuery struct {
+	Lang         string
+	DeckID       string
+	PeriodID     string
+	PercentileID string
+	Location     *time.Location
+	Sections     []string
+	// IncludeLessonCards counts lesson-created cards as added in the study section.
+	IncludeLessonCards bool
+}
+
+// StatsBatch combines the stats sections a dashboard needs. Sections that
+// weren't requested or failed to load are left nil.
+type StatsBatch struct {
+	Word     *WordStats     `json:"word,omitempty"`
+	Due      *DueStats      `json:"due,omitempty"`
+	Interval *IntervalStats `json:"interval,omitempty"`
+	Study    *StudyStats    `json:"study,omitempty"`
+}
+
+// GetStatsBatch loads the requested sections concurrently. A failing section
+// doesn't fail the batch: its error is returned keyed by section name and
+// the other sections are still filled in.
+func (s *MigakuService) GetStatsBatch(
+	ctx context.Context,
+	client *MigakuClient,
+	query StatsBatchQuery,
+) (*StatsBatch, map[string]error) {
+	batch := &StatsBatch{}
+	errs := make(map[string]error)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	record := func(section string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs[section] = err
+	}
+
+	for _, section := range query.Sections {
+		switch section {
+		case statsSectionWord:
+			wg.Go(func() {
+				stats, err := s.GetWordStats(ctx, client, query.Lang, query.DeckID)
+				if err != nil {
+					record(section, err)
+					return
+				}
+				batch.Word = stats
+			})
+		case statsSectionDue:
+			wg.Go(func() {
+				stats, err := s.GetDueStats(ctx, client, query.Lang, query.DeckID, query.PeriodID, nil, time.Time{}, query.Location)
+				if err != nil {
+					record(section, err)
+					return
+				}
+				batch.Due = stats
+			})
+		case statsSectionInterval:
+			wg.Go(func() {
+				stats, err := s.GetIntervalStats(ctx, client, query.Lang, query.DeckID, query.PercentileID)
+				if err != nil {
+					record(section, err)
+					return
+				}
+				batch.Interval = stats
+			})
+		case statsSectionStudy:
+			wg.Go(func() {
+				stats, err := s.GetStudyStats(
+					ctx, client, query.Lang, query.DeckID, query.PeriodID, nil, time.Time{}, query.Location,
+					StudyStatsOptions{IncludeLessonCards: query.IncludeLessonCards},
+				)
+				if err != nil {
+					record(section, err)
+					return
+				}
+				batch.Study = stats
+			})
+		}
+	}
+	wg.Wait()
+
+	return batch, errs
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// StudySeries breaks a study window down by day. Each array has one entry
+// per day from StartDay to EndDay, days without reviews included.
+type StudySeries struct {
+	Labels      []string `json:"labels"`
+	Reviews     []int    `json:"reviews"`
+	TimeSeconds []int    `json:"time_seconds"`
+}
+
+// newStudySeries returns a zeroed series covering [startDay, endDay].
+func newStudySeries(startDay, endDay int, loc *time.Location) *StudySeries {
+	days := max(endDay-startDay+1, 0)
+	series := &StudySeries{
+		Labels:      make([]string, days),
+		Reviews:     make([]int, days),
+		TimeSeconds: make([]int, days),
+	}
+	labels := labelLocales[defaultLabelLocale]
+	for i := range days {
+		series.Labels[i] = labels.formatDay(dayStart(startDay+i, loc))
+	}
+	return series
+}
+
+// loadStudySeries counts the reviews and the time spent on them for each day
+// of the window, on the same reviews total_reviews covers.
+func loadStudySeries(
+	ctx context.Context,
+	client *MigakuClient,
+	lang, deckID string,
+	startDay, endDay int,
+	loc *time.Location,
+) (*StudySeries, error) {
+	type dayRow struct {
+		Day         int `db:"day"`
+		Reviews     int `db:"reviews"`
+		TimeSeconds int `db:"time_seconds"`
+	}
+
+	query, params := buildReviewStatsQuery(`
+  r.day as day,
+  COUNT(*) as reviews,
+  COALESCE(SUM(r.duration), 0) as time_seconds`, "", lang, startDay, endDay, deckID)
+	rows, err := runQuery[dayRow](ctx, client, query+" GROUP BY r.day;", params...)
+	if err != nil {
+		return nil, err
+	}
+
+	series := newStudySeries(startDay, endDay, loc)
+	for _, row := range rows {
+		i := row.Day - startDay
+		if i < 0 || i >= len(series.Reviews) {
+			continue
+		}
+		series.Reviews[i] = row.Reviews
+		series.TimeSeconds[i] = row.TimeSeconds
+	}
+	return series, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxPendingSyncs caps how many word status changes a client holds while
+// the sync server is unreachable; past it, changes fail as they did before.
+const maxPendingSyncs = 100
+
+// pendingSyncInterval is how often the refresh loop retries queued pushes.
+const pendingSyncInterval = time.Minute
+
+// pendingSyncFlushTimeout bounds the last flush attempt when a client closes.
+const pendingSyncFlushTimeout = 10 * time.Second
+
+var (
+	ErrSyncQueued    = errors.New("sync queued: saved locally and will be pushed when the sync server is reachable")
+	ErrSyncQueueFull = errors.New("sync queue full")
+)
+
+// pendingSync is a word status change applied to the local db whose push
+// failed because the sync server was unreachable. attempts counts the
+// pushes tried so far, the first one included, and lastErr is why the
+// latest failed.
+type pendingSync struct {
+	records  []wordRecord
+	update   wordStatusUpdate
+	payloads []map[string]any
+	mod      int64
+	queuedAt time.Time
+	attempts int
+	lastErr  string
+}
+
+// PendingSync is a queued word status change as the API reports it.
+type PendingSync struct {
+	QueuedAt time.Time        `json:"queuedAt"`
+	Items    []WordStatusItem `json:"items"`
+	Language string           `json:"language,omitempty"`
+	// KnownStatus and Tracked are the fields the change sets; an unset one
+	// is left as it was.
+	KnownStatus *string `json:"knownStatus,omitempty"`
+	Tracked     *bool   `json:"tracked,omitempty"`
+	Attempts    int     `json:"attempts"`
+	LastError   string  `json:"lastError,omitempty"`
+}
+
+func (p pendingSync) view() PendingSync {
+	v := PendingSync{
+		QueuedAt:  p.queuedAt.UTC(),
+		Items:     make([]WordStatusItem, 0, len(p.records)),
+		Tracked:   p.update.Tracked,
+		Attempts:  p.attempts,
+		LastError: p.lastErr,
+	}
+	for _, record := range p.records {
+		v.Items = append(v.Items, WordStatusItem{WordText: record.DictForm.String, Secondary: record.Secondary.String})
+		v.Language = record.Language.String
+	}
+	if p.update.KnownStatus != nil {
+		status := strings.ToLower(*p.update.KnownStatus)
+		v.KnownStatus = &status
+	}
+	return v
+}
+
+// FlushResult is the outcome of a forced push of a client's queue.
+type FlushResult struct {
+	// Pushed counts the changes the server accepted and Dropped the ones it
+	// rejected, which are gone from the queue either way.
+	Pushed  int           `json:"pushed"`
+	Dropped int           `json:"dropped"`
+	Pending []PendingSync `json:"pending"`
+}
+
+// enqueueSync queues a change for a later push, or returns ErrSyncQueueFull.
+func (c *MigakuClient) enqueueSync(p pendingSync) error {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	if len(c.pending) >= maxPendingSyncs {
+		return fmt.Errorf("%w: %d changes waiting", ErrSyncQueueFull, len(c.pending))
+	}
+	c.pending = append(c.pending, p)
+	return nil
+}
+
+// pendingSyncs returns a copy of the queued changes, oldest first.
+func (c *MigakuClient) pendingSyncs() []pendingSync {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	return append([]pendingSync(nil), c.pending...)
+}
+
+// flushPendingSyncs pushes queued changes oldest first, so a later change to
+// the same word lands after an earlier one. It stops at the first push that
+// can't reach the server and returns that error. A push the server rejects
+// outright would fail the same way on every retry, so it is logged and
+// dropped instead. It returns how many changes were pushed and dropped.
+func (c *MigakuClient) flushPendingSyncs(ctx context.Context) (pushed, dropped int, err error) {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.mu.RLock()
+	session := c.session
+	c.mu.RUnlock()
+
+	for {
+		c.pendingMu.Lock()
+		if len(c.pending) == 0 {
+			c.pendingMu.Unlock()
+			return pushed, dropped, nil
+		}
+		next := c.pending[0]
+		c.pendingMu.Unlock()
+
+		if session == nil {
+			return pushed, dropped, errors.New("missing migaku session")
+		}
+		err := session.PushSync(ctx, next.payloads)
+		if errors.Is(err, ErrSyncUnavailable) || (err != nil && ctx.Err() != nil) {
+			c.pendingMu.Lock()
+			c.pending[0].attempts++
+			c.pending[0].lastErr = err.Error()
+			c.pendingMu.Unlock()
+			return pushed, dropped, err
+		}
+		if err != nil {
+			dropped++
+			c.logger.Error(
+				"Dropping queued word status change the server rejected",
+				"error", err,
+				"count", len(next.records),
+				"queuedAt", next.queuedAt,
+			)
+		} else {
+			pushed++
+			c.logger.Info("Pushed queued word status change", "count", len(next.records), "queuedAt", next.queuedAt)
+		}
+
+		c.pendingMu.Lock()
+		c.pending = c.pending[1:]
+		c.pendingMu.Unlock()
+	}
+}
+
+// reapplyPendingSyncs writes queued changes into a freshly downloaded
+// snapshot, which doesn't have them yet since the server never got them.
+func (c *MigakuClient) reapplyPendingSyncs(ctx context.Context) error {
+	for _, p := range c.pendingSyncs() {
+		if err := updateLocalWordStatus(ctx, c, p.records, p.update, p.mod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PendingSyncs returns the client's queued word status changes, oldest
+// first.
+func (s *MigakuService) PendingSyncs(client *MigakuClient) []PendingSync {
+	pending := client.pendingSyncs()
+	out := make([]PendingSync, 0, len(pending))
+	for _, p := range pending {
+		out = append(out, p.view())
+	}
+	return out
+}
+
+// FlushPendingSyncs tries to push the client's queue now rather than waiting
+// for the refresh loop. A sync server that is still unreachable isn't an
+// error: the changes stay queued with the failure as their lastError.
+func (s *MigakuService) FlushPendingSyncs(ctx context.Context, client *MigakuClient) (FlushResult, error) {
+	pushed, dropped, err := client.flushPendingSyncs(ctx)
+	if err != nil && !errors.Is(err, ErrSyncUnavailable) {
+		return FlushResult{}, err
+	}
+	if dropped > 0 {
+		// The local db still shows the rejected changes; a fresh snapshot
+		// puts back what the server holds.
+		client.requestRefresh()
+	}
+	return FlushResult{Pushed: pushed, Dropped: dropped, Pending: s.PendingSyncs(client)}, nil
+}
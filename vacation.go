@@ -0,0 +1,47 @@
+package main
+
+import "context"
+
+// vacationDays counts the days in [startDay, endDay] covered by a live
+// vacation on which no review matching lang and deckID was done. Vacation
+// days that were studied anyway stay in, so the percentage can't pass 100.
+// A vacation row spans its start through end day numbers inclusive; one
+// without an end is still running.
+func vacationDays(ctx context.Context, client *MigakuClient, lang, deckID string, startDay, endDay int) (int, error) {
+	type vacationRow struct {
+		Start int `db:"start"`
+		End   int `db:"end"`
+	}
+
+	vacations, err := runQuery[vacationRow](ctx, client, `
+SELECT start, COALESCE("end", ?) AS "end"
+FROM vacation
+WHERE del = 0 AND start <= ? AND COALESCE("end", ?) >= ?;`, endDay, endDay, endDay, startDay)
+	if err != nil {
+		return 0, err
+	}
+	if len(vacations) == 0 {
+		return 0, nil
+	}
+
+	onVacation := make(map[int]bool)
+	for _, v := range vacations {
+		for day := max(v.Start, startDay); day <= min(v.End, endDay); day++ {
+			onVacation[day] = true
+		}
+	}
+
+	type studiedRow struct {
+		Day int `db:"day"`
+	}
+
+	query, params := buildReviewStatsQuery(" DISTINCT r.day as day", "", lang, startDay, endDay, deckID)
+	studied, err := runQuery[studiedRow](ctx, client, query, params...)
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range studied {
+		delete(onVacation, row.Day)
+	}
+	return len(onVacation), nil
+}
@@ -1,11 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -15,6 +26,16 @@ const (
 // ErrorResponse represents error details in error responses
 type ErrorResponse struct {
 	Error string `json:"error"`
+	// Code is a stable, machine-readable identifier for the error, such as
+	// "word_not_found". Unlike Error, it won't change wording.
+	Code string `json:"code,omitempty"`
+	// RetryAfter mirrors the Retry-After header, in seconds, on 503s that
+	// are expected to clear on their own.
+	RetryAfter int `json:"retryAfter,omitempty"`
+	// Fields maps each invalid request body field to what is wrong with
+	// it, on 400s from a failed Validator. Error still summarises them for
+	// clients that only read the message.
+	Fields map[string]string `json:"fields,omitempty"`
 }
 
 // Validator is an object that can be validated.
@@ -25,18 +46,184 @@ type Validator interface {
 	Valid(ctx context.Context) (problems map[string]string)
 }
 
-func encode[T any](w http.ResponseWriter, _ *http.Request, status int, v T) error {
+// encode writes v as JSON with an exact Content-Length. HEAD requests get
+// the same headers without the body.
+func encode[T any](w http.ResponseWriter, r *http.Request, status int, v T) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return fmt.Errorf("encode json: %w", err)
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
 	w.WriteHeader(status)
-	if err := json.NewEncoder(w).Encode(v); err != nil {
-		return fmt.Errorf("encode json: %w", err)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write response: %w", err)
 	}
 	return nil
 }
 
+// Errors returned by decode. Each is wrapped with the detail a client needs
+// to fix the request, so the message is safe to send back as a 400.
+var (
+	ErrEmptyBody    = errors.New("request body is empty")
+	ErrBodySyntax   = errors.New("request body must be valid JSON")
+	ErrUnknownField = errors.New("unknown field")
+	ErrFieldType    = errors.New("wrong type for field")
+	ErrBodyTooLarge = errors.New("request body too large")
+)
+
+// decode reads the JSON request body into a T, rejecting unknown fields.
+// Failures wrap one of ErrEmptyBody, ErrBodySyntax, ErrUnknownField,
+// ErrFieldType or ErrBodyTooLarge.
+func decode[T any](r *http.Request) (T, error) {
+	var v T
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&v); err != nil {
+		return v, decodeError(err)
+	}
+	return v, nil
+}
+
+// decodeError turns an encoding/json error into one of decode's errors.
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var sizeErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &sizeErr):
+		return fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, sizeErr.Limit)
+	case errors.Is(err, io.EOF):
+		return ErrEmptyBody
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("%w: unexpected end of input", ErrBodySyntax)
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("%w: %s at offset %d", ErrBodySyntax, syntaxErr.Error(), syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return fmt.Errorf("%w: body is %s, not an object", ErrFieldType, typeErr.Value)
+		}
+		return fmt.Errorf("%w %s: got %s", ErrFieldType, typeErr.Field, typeErr.Value)
+	}
+	// encoding/json has no typed error for unknown fields.
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return fmt.Errorf("%w %s", ErrUnknownField, field)
+	}
+	return fmt.Errorf("%w: %s", ErrBodySyntax, err.Error())
+}
+
+// decodeErrorStatus maps a decode error to its HTTP status.
+func decodeErrorStatus(err error) int {
+	if errors.Is(err, ErrBodyTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// decodeValid decodes the JSON request body into a T and validates it.
+// A non-nil error with empty problems is a decode error; non-empty problems
+// come from T's Valid.
+func decodeValid[T Validator](r *http.Request) (T, map[string]string, error) {
+	v, err := decode[T](r)
+	if err != nil {
+		return v, nil, err
+	}
+	if problems := v.Valid(r.Context()); len(problems) > 0 {
+		return v, problems, fmt.Errorf("invalid %T: %d problems", v, len(problems))
+	}
+	return v, nil, nil
+}
+
+// errorCodes gives the code sent for each sentinel error, checked in order
+// with errors.Is. Codes are part of the API: add new ones, don't rename.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrWordNotFound, "word_not_found"},
+	{ErrInvalidStatus, "invalid_status"},
+	{ErrInvalidWordStatus, "invalid_status"},
+	{ErrWordTextRequired, "word_text_required"},
+	{ErrClientNotAuth, "unauthorized"},
+	{ErrAmbiguousWord, "ambiguous_word"},
+	{ErrSyncNotConfirmed, "sync_not_confirmed"},
+	{ErrEmptyPatch, "empty_patch"},
+	{ErrDeckNotFound, "deck_not_found"},
+	{ErrAmbiguousDeck, "ambiguous_deck"},
+	{errInvalidDeckID, "invalid_deck_id"},
+	{ErrDeckNameRequired, "deck_name_required"},
+	{ErrDeckNameTaken, "deck_name_taken"},
+	{ErrKeyNotFound, "key_not_found"},
+	{ErrInvalidPeriod, "invalid_period"},
+	{ErrInvalidGranularity, "invalid_granularity"},
+	{ErrInvalidDateRange, "invalid_date_range"},
+	{ErrInvalidToday, "invalid_today"},
+	{ErrUnsupportedLocale, "unsupported_locale"},
+	{ErrEmptyBody, "empty_body"},
+	{ErrBodySyntax, "invalid_json"},
+	{ErrUnknownField, "unknown_field"},
+	{ErrFieldType, "invalid_field_type"},
+	{ErrBodyTooLarge, "body_too_large"},
+}
+
+// statusCode is the code for an error without a more specific one.
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "bad_request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusMethodNotAllowed:
+		return "method_not_allowed"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusRequestEntityTooLarge:
+		return "body_too_large"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	case http.StatusGatewayTimeout:
+		return "timeout"
+	default:
+		if status >= 500 {
+			return "internal_error"
+		}
+		return "error"
+	}
+}
+
+// errorCode returns the code for err, falling back to the one for status.
+// 5xx responses always get the generic code, as their message is masked.
+func errorCode(err error, status int) string {
+	if status < 500 {
+		for _, c := range errorCodes {
+			if errors.Is(err, c.err) {
+				return c.code
+			}
+		}
+	}
+	return statusCode(status)
+}
+
+// writeError writes err with its code from errorCodes. Use it where the
+// error may wrap a sentinel; writeJSONError only knows the status.
+func (app *Application) writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	app.writeErrorResponse(w, r, status, errorCode(err, status), err.Error())
+}
+
 func (app *Application) writeJSONError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	app.writeErrorResponse(w, r, status, statusCode(status), message)
+}
+
+func (app *Application) writeErrorResponse(w http.ResponseWriter, r *http.Request, status int, code, message string) {
 	app.logger.Error("HTTP error",
 		slog.Int("status", status),
+		slog.String("code", code),
 		slog.String("message", message),
 		slog.String("path", r.URL.Path),
 		slog.String("method", r.Method),
@@ -49,9 +236,196 @@ func (app *Application) writeJSONError(w http.ResponseWriter, r *http.Request, s
 
 	response := ErrorResponse{
 		Error: message,
+		Code:  code,
 	}
 
 	if err := encode(w, r, status, response); err != nil {
 		app.logger.Error("Failed to encode JSON error response", slog.String("error", err.Error()))
 	}
 }
+
+// writeValidationError writes the 400 for a request body that failed
+// validation. The problem with each field goes in Fields, and Error joins
+// them in field order so the message alone is still useful.
+func (app *Application) writeValidationError(w http.ResponseWriter, r *http.Request, problems map[string]string) {
+	app.logger.Warn("Request validation failed",
+		slog.String("path", r.URL.Path),
+		slog.Any("fields", problems),
+	)
+
+	messages := make([]string, 0, len(problems))
+	for _, field := range slices.Sorted(maps.Keys(problems)) {
+		messages = append(messages, field+" "+problems[field])
+	}
+	response := ErrorResponse{
+		Error:  "Invalid request body: " + strings.Join(messages, "; "),
+		Code:   "validation_failed",
+		Fields: problems,
+	}
+	if err := encode(w, r, http.StatusBadRequest, response); err != nil {
+		app.logger.Error("Failed to encode JSON error response", slog.String("error", err.Error()))
+	}
+}
+
+// dbNotReadyRetryAfter is how long clients are told to wait while a
+// snapshot download is in progress.
+const dbNotReadyRetryAfter = 10 * time.Second
+
+// writeNotReady writes the 503 returned while the local snapshot is still
+// being downloaded.
+func (app *Application) writeNotReady(w http.ResponseWriter, r *http.Request) {
+	seconds := int(dbNotReadyRetryAfter.Seconds())
+	app.logger.Warn("Local database not ready", slog.String("path", r.URL.Path))
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	response := ErrorResponse{
+		Error:      "Local database is not ready yet, retry shortly",
+		Code:       "not_ready",
+		RetryAfter: seconds,
+	}
+	if err := encode(w, r, http.StatusServiceUnavailable, response); err != nil {
+		app.logger.Error("Failed to encode JSON error response", slog.String("error", err.Error()))
+	}
+}
+
+// responseETag derives a weak ETag for a GET read from the client's snapshot
+// version, the request's path and query, its label locale (which can come
+// from Accept-Language rather than the query) and today's day number
+// (day-based stats roll over at midnight without a refresh). It reports
+// false for requests that shouldn't be conditional.
+func (app *Application) responseETag(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "", false
+	}
+	client, ok := clientFromContext(r.Context())
+	if !ok {
+		return "", false
+	}
+
+	loc, err := app.requestLocation(r)
+	if err != nil {
+		loc = app.location
+	}
+	locale, err := app.requestLocale(r)
+	if err != nil {
+		locale = defaultLabelLocale
+	}
+
+	h := sha256.New()
+	for _, part := range []string{
+		client.snapshotVersion(),
+		r.URL.Path,
+		r.URL.Query().Encode(),
+		locale,
+		strconv.Itoa(dayNumber(time.Now(), loc)),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, true
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using
+// the weak comparison RFC 9110 prescribes for If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for candidate := range strings.SplitSeq(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// staticAssetCacheControl lets browsers keep the docs assets but makes them
+// revalidate on every use, which costs a 304 until the next deploy.
+const staticAssetCacheControl = "public, no-cache"
+
+// staticAsset is an embedded file served with an ETag and a gzipped copy,
+// both computed once at startup.
+type staticAsset struct {
+	contentType string
+	body        []byte
+	gzipped     []byte
+	etag        string
+	gzipETag    string
+}
+
+func newStaticAsset(contentType string, body []byte) (*staticAsset, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(body)
+	tag := hex.EncodeToString(sum[:16])
+	return &staticAsset{
+		contentType: contentType,
+		body:        body,
+		gzipped:     buf.Bytes(),
+		etag:        `"` + tag + `"`,
+		gzipETag:    `"` + tag + `-gzip"`,
+	}, nil
+}
+
+// serve writes the asset, gzipped if the client accepts it, or a 304 when
+// If-None-Match already names the variant it would get.
+func (a *staticAsset) serve(w http.ResponseWriter, r *http.Request) error {
+	body, etag := a.body, a.etag
+	useGzip := acceptsGzip(r.Header.Get("Accept-Encoding"))
+	if useGzip {
+		body, etag = a.gzipped, a.gzipETag
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", a.contentType)
+	h.Set("Cache-Control", staticAssetCacheControl)
+	h.Set("ETag", etag)
+	h.Add("Vary", "Accept-Encoding")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	if useGzip {
+		h.Set("Content-Encoding", "gzip")
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, either
+// by name or through "*", and doesn't rule it out with q=0.
+func acceptsGzip(acceptEncoding string) bool {
+	for part := range strings.SplitSeq(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if qValue, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(qValue), 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
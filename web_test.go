@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResponseETagLocale(t *testing.T) {
+	app := newTestApp(t)
+	client := newTestClient(t)
+
+	etag := func(target, acceptLanguage string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if acceptLanguage != "" {
+			req.Header.Set("Accept-Language", acceptLanguage)
+		}
+		rec := serveAs(func(w http.ResponseWriter, r *http.Request) {
+			tag, ok := app.responseETag(r)
+			if !ok {
+				t.Fatalf("no ETag for GET %s", target)
+			}
+			w.Header().Set("ETag", tag)
+		}, client, req)
+		return rec.Header().Get("ETag")
+	}
+
+	const target = "/api/v1/stats/due?lang=ja"
+	english := etag(target, "en-US,en;q=0.9")
+	if japanese := etag(target, "ja-JP,ja;q=0.9"); japanese == english {
+		t.Errorf("Accept-Language ja and en share ETag %s", english)
+	}
+	if german := etag(target+"&locale=de", ""); german == english {
+		t.Errorf("locale=de and Accept-Language en share ETag %s", english)
+	}
+	if same := etag(target, "en-GB"); same != english {
+		t.Errorf("en-GB and en-US both format English labels but got ETags %s and %s", same, english)
+	}
+	if fallback := etag(target, "xx"); fallback != english {
+		t.Errorf("an unsupported language falls back to English labels but got ETag %s, want %s", fallback, english)
+	}
+}
+
+func TestRespondJSONConditional(t *testing.T) {
+	app := newTestApp(t)
+	client := newTestClient(t)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/decks?lang=ja", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		return serveAs(app.handleDecks, client, req)
+	}
+
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first GET: status %d, ETag %q; want 200 with an ETag", first.Code, etag)
+	}
+
+	cached := get(etag)
+	if cached.Code != http.StatusNotModified {
+		t.Fatalf("GET with If-None-Match %s: status %d, want 304", etag, cached.Code)
+	}
+	if cached.Body.Len() != 0 {
+		t.Errorf("304 carried a body: %s", cached.Body)
+	}
+	if got := cached.Header().Get("ETag"); got != etag {
+		t.Errorf("304 ETag = %q, want %q", got, etag)
+	}
+
+	if stale := get(`W/"something-else"`); stale.Code != http.StatusOK {
+		t.Errorf("GET with a non-matching If-None-Match: status %d, want 200", stale.Code)
+	}
+
+	// A refresh swaps in a new snapshot, so the old ETag no longer matches.
+	client.mu.Lock()
+	client.lastRefresh = client.lastRefresh.Add(-time.Minute)
+	client.mu.Unlock()
+	if err := client.swapDB(newFixtureDB(t)); err != nil {
+		t.Fatalf("swap snapshot: %v", err)
+	}
+	refreshed := get(etag)
+	if refreshed.Code != http.StatusOK {
+		t.Fatalf("GET after a refresh with the old ETag: status %d, want 200", refreshed.Code)
+	}
+	newETag := refreshed.Header().Get("ETag")
+	if newETag == "" || newETag == etag {
+		t.Fatalf("ETag after a refresh = %q, want a new one (old %q)", newETag, etag)
+	}
+
+	// So does a local write.
+	if _, err := runWriteQuery(context.Background(), client, `UPDATE deck SET name = 'Renamed' WHERE id = 1`); err != nil {
+		t.Fatalf("local write: %v", err)
+	}
+	if written := get(newETag); written.Code != http.StatusOK {
+		t.Errorf("GET after a local write with the old ETag: status %d, want 200", written.Code)
+	}
+}
+
+func TestRespondJSONNotConditional(t *testing.T) {
+	app := newTestApp(t)
+	client := newTestClient(t)
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		handler func(app *Application) http.HandlerFunc
+	}{
+		{"POST", http.MethodPost, "/api/v1/words/status/flush", func(app *Application) http.HandlerFunc { return app.handleFlushWordStatus }},
+		{"PATCH", http.MethodPatch, "/api/v1/decks/1", func(app *Application) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) { app.respondJSON(w, r, map[string]string{"status": "ok"}) }
+		}},
+		{"random words", http.MethodGet, "/api/v1/words/random?lang=ja", func(app *Application) http.HandlerFunc { return app.handleRandomWords }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Header.Set("If-None-Match", "*")
+			rec := serveAs(tt.handler(app), client, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+			}
+			if etag := rec.Header().Get("ETag"); etag != "" {
+				t.Errorf("got ETag %s on a response that must not be conditional", etag)
+			}
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
 	"strings"
 	"time"
 )
@@ -15,13 +18,38 @@ var (
 	ErrInvalidStatus    = errors.New("invalid status: must be one of: known, learning, tracked, ignored")
 	ErrWordTextRequired = errors.New("wordText is required")
 	ErrClientNotAuth    = errors.New("client not authenticated")
+	ErrAmbiguousWord    = errors.New("word is ambiguous: pass secondary to pick one")
+	ErrSyncNotConfirmed = errors.New("sync not confirmed: the server did not apply the change")
+	ErrEmptyPatch       = errors.New("nothing to update: set knownStatus or tracked")
 )
 
+// WordStatusOptions tunes how a word status change is applied.
+type WordStatusOptions struct {
+	// Partial skips and reports items that can't be found instead of
+	// rejecting the whole batch.
+	Partial bool
+	// Verify re-downloads the snapshot after the push and checks the server
+	// holds the new status, at the cost of an extra download.
+	Verify bool
+	// QueueIfOffline applies the change locally and queues the push when
+	// the sync server can't be reached, returning ErrSyncQueued, instead of
+	// failing. Verify is skipped for a queued change.
+	QueueIfOffline bool
+}
+
 type WordStatusItem struct {
 	WordText  string `json:"wordText"`
 	Secondary string `json:"secondary,omitempty"`
 }
 
+// WordStatusFailure is a batch item skipped in partial mode because it
+// couldn't be resolved to a single word.
+type WordStatusFailure struct {
+	WordText  string `json:"wordText"`
+	Secondary string `json:"secondary,omitempty"`
+	Error     string `json:"error"`
+}
+
 type wordRecord struct {
 	DictForm         sql.NullString `db:"dictForm"`
 	Secondary        sql.NullString `db:"secondary"`
@@ -39,33 +67,68 @@ type wordRecord struct {
 	IsPendingApply   sql.NullInt64  `db:"isPendingApply"`
 }
 
+// wordStatusUpdate is the change applied to each word. A nil field keeps the
+// word's current value, so a patch can change one without resetting the
+// other.
 type wordStatusUpdate struct {
-	KnownStatus string
-	Tracked     bool
+	KnownStatus *string
+	Tracked     *bool
+}
+
+func fullStatusUpdate(knownStatus string, tracked bool) wordStatusUpdate {
+	return wordStatusUpdate{KnownStatus: &knownStatus, Tracked: &tracked}
+}
+
+// WordStatusPatch changes only the fields that are set. KnownStatus takes
+// the API names: known, learning, unknown or ignored.
+type WordStatusPatch struct {
+	KnownStatus *string
+	Tracked     *bool
 }
 
 const languageFilterClause = " AND language = ?"
 
+// resetWordStatusUpdate returns a word to its default state: unknown and
+// not tracked.
+var resetWordStatusUpdate = fullStatusUpdate(dbStatusUnknown, false)
+
 func statusToUpdate(status string) (wordStatusUpdate, bool) {
 	normalized := strings.ToLower(strings.TrimSpace(status))
 	switch normalized {
 	case "known":
-		return wordStatusUpdate{KnownStatus: "KNOWN", Tracked: false}, true
+		return fullStatusUpdate(dbStatusKnown, false), true
 	case "learning":
-		return wordStatusUpdate{KnownStatus: "LEARNING", Tracked: false}, true
+		return fullStatusUpdate(dbStatusLearning, false), true
 	case "ignored":
-		return wordStatusUpdate{KnownStatus: "IGNORED", Tracked: false}, true
+		return fullStatusUpdate(dbStatusIgnored, false), true
 	case "tracked":
-		return wordStatusUpdate{KnownStatus: "UNKNOWN", Tracked: true}, true
+		return fullStatusUpdate(dbStatusUnknown, true), true
 	default:
 		return wordStatusUpdate{}, false
 	}
 }
 
+// dbKnownStatus maps an API knownStatus name to its database value.
+func dbKnownStatus(name string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case statusKnown:
+		return dbStatusKnown, true
+	case statusLearning:
+		return dbStatusLearning, true
+	case statusUnknown:
+		return dbStatusUnknown, true
+	case statusIgnored:
+		return dbStatusIgnored, true
+	default:
+		return "", false
+	}
+}
+
 func (s *MigakuService) SetWordStatus(
 	ctx context.Context,
 	client *MigakuClient,
 	wordText, secondary, status, language string,
+	opts WordStatusOptions,
 ) error {
 	wordText = strings.TrimSpace(wordText)
 	secondary = strings.TrimSpace(secondary)
@@ -77,47 +140,117 @@ func (s *MigakuService) SetWordStatus(
 		slog.String("language", language),
 	)
 
-	return s.setWordStatusItems(ctx, client, []WordStatusItem{
+	update, ok := statusToUpdate(status)
+	if !ok {
+		return ErrInvalidStatus
+	}
+	_, err := s.setWordStatusItems(ctx, client, []WordStatusItem{
 		{
 			WordText:  wordText,
 			Secondary: secondary,
 		},
-	}, status, language)
+	}, update, language, WordStatusOptions{Verify: opts.Verify, QueueIfOffline: opts.QueueIfOffline})
+	return err
 }
 
+// SetWordStatusBatch updates every item or none of them. With opts.Partial,
+// items that can't be found (or are ambiguous) are skipped and returned
+// instead, and the rest are still updated.
 func (s *MigakuService) SetWordStatusBatch(
 	ctx context.Context,
 	client *MigakuClient,
 	items []WordStatusItem,
 	status string,
 	language string,
-) error {
+	opts WordStatusOptions,
+) ([]WordStatusFailure, error) {
 	client.logger.Info(
 		"Updating word status batch",
 		slog.String("status", status),
 		slog.Int("count", len(items)),
+		slog.Bool("partial", opts.Partial),
+		slog.Bool("verify", opts.Verify),
 	)
-	return s.setWordStatusItems(ctx, client, items, status, language)
+	update, ok := statusToUpdate(status)
+	if !ok {
+		return nil, ErrInvalidStatus
+	}
+	return s.setWordStatusItems(ctx, client, items, update, language, opts)
 }
 
-func (s *MigakuService) setWordStatusItems(
+// ResetWordStatus sets the items back to unknown and untracked, undoing any
+// earlier status change. opts behave as in SetWordStatusBatch.
+func (s *MigakuService) ResetWordStatus(
 	ctx context.Context,
 	client *MigakuClient,
 	items []WordStatusItem,
-	status string,
 	language string,
-) error {
-	if client == nil {
-		return ErrClientNotAuth
+	opts WordStatusOptions,
+) ([]WordStatusFailure, error) {
+	client.logger.Info(
+		"Resetting word status",
+		slog.Int("count", len(items)),
+		slog.Bool("partial", opts.Partial),
+		slog.Bool("verify", opts.Verify),
+	)
+	return s.setWordStatusItems(ctx, client, items, resetWordStatusUpdate, language, opts)
+}
+
+// PatchWordStatus changes only the fields set in patch, so a client can
+// track a word without touching its knownStatus, or the reverse. opts behave
+// as in SetWordStatusBatch.
+func (s *MigakuService) PatchWordStatus(
+	ctx context.Context,
+	client *MigakuClient,
+	items []WordStatusItem,
+	patch WordStatusPatch,
+	language string,
+	opts WordStatusOptions,
+) ([]WordStatusFailure, error) {
+	var update wordStatusUpdate
+	if patch.KnownStatus != nil {
+		knownStatus, ok := dbKnownStatus(*patch.KnownStatus)
+		if !ok {
+			return nil, ErrInvalidWordStatus
+		}
+		update.KnownStatus = &knownStatus
+	}
+	update.Tracked = patch.Tracked
+	if update.KnownStatus == nil && update.Tracked == nil {
+		return nil, ErrEmptyPatch
 	}
 
-	update, ok := statusToUpdate(status)
-	if !ok {
-		return ErrInvalidStatus
+	client.logger.Info(
+		"Patching word status",
+		slog.Int("count", len(items)),
+		slog.Bool("knownStatus", update.KnownStatus != nil),
+		slog.Bool("tracked", update.Tracked != nil),
+		slog.Bool("partial", opts.Partial),
+		slog.Bool("verify", opts.Verify),
+	)
+	return s.setWordStatusItems(ctx, client, items, update, language, opts)
+}
+
+func (s *MigakuService) setWordStatusItems(
+	ctx context.Context,
+	client *MigakuClient,
+	items []WordStatusItem,
+	update wordStatusUpdate,
+	language string,
+	opts WordStatusOptions,
+) (failures []WordStatusFailure, err error) {
+	defer func() {
+		if auditErr := s.audit.record(client, items, update, language, failures, err); auditErr != nil && client != nil {
+			client.logger.Warn("Failed to write audit record", "error", auditErr)
+		}
+	}()
+
+	if client == nil {
+		return nil, ErrClientNotAuth
 	}
 
 	if len(items) == 0 {
-		return ErrWordTextRequired
+		return nil, ErrWordTextRequired
 	}
 
 	normalizedItems := make([]WordStatusItem, 0, len(items))
@@ -125,7 +258,7 @@ func (s *MigakuService) setWordStatusItems(
 		wordText := strings.TrimSpace(item.WordText)
 		secondary := strings.TrimSpace(item.Secondary)
 		if wordText == "" {
-			return ErrWordTextRequired
+			return nil, ErrWordTextRequired
 		}
 		normalizedItems = append(normalizedItems, WordStatusItem{
 			WordText:  wordText,
@@ -137,15 +270,28 @@ func (s *MigakuService) setWordStatusItems(
 	updateRecords := make([]wordRecord, 0, len(normalizedItems))
 	modTimestamp := time.Now().UnixMilli()
 
-	if err := client.refreshDBIfStale(ctx, s.cache.ttl); err != nil {
-		return err
+	if err := client.refreshDBIfStale(ctx); err != nil {
+		return nil, err
 	}
 
-	for _, item := range normalizedItems {
-		record, payload, recErr := lookupWordRecord(ctx, client, item.WordText, item.Secondary, language)
-		if recErr != nil {
-			return fmt.Errorf("%w: %s", ErrWordNotFound, item.WordText)
+	lookups, err := lookupWordRecords(ctx, client, normalizedItems, language)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up words: %w", err)
+	}
+
+	for i, lookup := range lookups {
+		if lookup.err != nil {
+			if !opts.Partial {
+				return nil, lookup.err
+			}
+			failures = append(failures, WordStatusFailure{
+				WordText:  normalizedItems[i].WordText,
+				Secondary: normalizedItems[i].Secondary,
+				Error:     lookup.err.Error(),
+			})
+			continue
 		}
+		record, payload := lookup.record, lookup.payload
 
 		serverMod := int64(-1)
 		if record.ServerMod.Valid {
@@ -158,151 +304,266 @@ func (s *MigakuService) setWordStatusItems(
 			delete(payload, "hasCard")
 		}
 
-		payload["knownStatus"] = update.KnownStatus
-		payload["tracked"] = update.Tracked
+		if update.KnownStatus != nil {
+			payload["knownStatus"] = *update.KnownStatus
+		}
+		if update.Tracked != nil {
+			payload["tracked"] = *update.Tracked
+		}
 		payload["mod"] = modTimestamp
 		payload["serverMod"] = serverMod
 		updates = append(updates, payload)
 		updateRecords = append(updateRecords, record)
 	}
 
-	if err := client.session.PushSync(ctx, updates); err != nil {
-		return fmt.Errorf("failed to sync: %w", err)
+	if len(updates) == 0 {
+		return failures, nil
+	}
+
+	// Changes queued earlier go first, or they would later overwrite this
+	// one.
+	_, _, err = client.flushPendingSyncs(ctx)
+	if err == nil {
+		err = client.session.PushSync(ctx, updates)
+	}
+	if err != nil {
+		if !opts.QueueIfOffline || !errors.Is(err, ErrSyncUnavailable) {
+			return nil, fmt.Errorf("failed to sync: %w", err)
+		}
+		return failures, s.queueWordStatus(ctx, client, pendingSync{
+			records:  updateRecords,
+			update:   update,
+			payloads: updates,
+			mod:      modTimestamp,
+			queuedAt: time.Now(),
+		}, err)
+	}
+
+	if opts.Verify {
+		// The fresh snapshot already holds whatever the server kept, so
+		// there is nothing to update locally either way.
+		err := verifyWordStatus(ctx, client, updateRecords, update)
+		s.cache.Clear()
+		if err != nil {
+			return nil, err
+		}
+		return failures, nil
 	}
 
 	if err := updateLocalWordStatus(ctx, client, updateRecords, update, modTimestamp); err != nil {
-		return fmt.Errorf("failed to update local db: %w", err)
+		return nil, fmt.Errorf("failed to update local db: %w", err)
 	}
 
 	s.cache.Clear()
-	return nil
+	return failures, nil
 }
 
-func lookupWordRecord(
-	ctx context.Context,
-	client *MigakuClient,
-	wordText, secondary, language string,
-) (wordRecord, map[string]any, error) {
-	query := `SELECT dictForm, secondary, partOfSpeech, language, serverMod, knownStatus, hasCard, tracked,
-created, del, isModern, serverVersion, isPendingEnqueue, isPendingApply
-FROM WordList
-WHERE del = 0 AND dictForm = ?`
-	params := []any{wordText}
-	if strings.TrimSpace(language) != "" {
-		query += languageFilterClause
-		params = append(params, language)
+// queueWordStatus applies a change whose push failed with pushErr to the
+// local db and queues it for the refresh loop to push, returning
+// ErrSyncQueued. A full queue fails the change like any other failed push.
+// Once queued the change will be pushed, so a failed local write is only
+// logged; the next refresh applies it again.
+func (s *MigakuService) queueWordStatus(ctx context.Context, client *MigakuClient, p pendingSync, pushErr error) error {
+	p.attempts, p.lastErr = 1, pushErr.Error()
+	if err := client.enqueueSync(p); err != nil {
+		return fmt.Errorf("failed to sync: %w (%w)", pushErr, err)
 	}
-	if strings.TrimSpace(secondary) != "" {
-		query += " AND secondary = ?"
-		params = append(params, secondary)
-	} else {
-		query += " AND (secondary = '' OR secondary IS NULL)"
+	client.logger.Warn("Sync server unreachable, queued word status change", "count", len(p.records), "error", pushErr)
+
+	if err := updateLocalWordStatus(ctx, client, p.records, p.update, p.mod); err != nil {
+		client.logger.Error("Failed to apply queued word status change locally", "error", err)
 	}
-	query += " LIMIT 1;"
+	s.cache.Clear()
+	return ErrSyncQueued
+}
 
-	raw, err := runReadRow(ctx, client, query, params...)
+// verifyWordStatus downloads a fresh snapshot and checks every pushed record
+// now has the new status, returning ErrSyncNotConfirmed naming the words the
+// server didn't update.
+func verifyWordStatus(ctx context.Context, client *MigakuClient, records []wordRecord, update wordStatusUpdate) error {
+	// Download directly rather than joining a refresh already in flight,
+	// which may have fetched its snapshot before the push.
+	err := client.refreshDB(ctx)
+	client.recordRefreshResult(err)
 	if err != nil {
-		return wordRecord{}, nil, fmt.Errorf("word not found: %w", err)
+		return fmt.Errorf("failed to download snapshot for verification: %w", err)
 	}
 
-	payload := normalizeRow(raw)
-	record := wordRecord{
-		DictForm:         getNullString(payload, "dictForm"),
-		Secondary:        getNullString(payload, "secondary"),
-		PartOfSpeech:     getNullString(payload, "partOfSpeech"),
-		Language:         getNullString(payload, "language"),
-		ServerMod:        getNullInt64(payload, "serverMod"),
-		KnownStatus:      getNullString(payload, "knownStatus"),
-		HasCard:          getNullBool(payload, "hasCard"),
-		Tracked:          getNullBool(payload, "tracked"),
-		Created:          getNullInt64(payload, "created"),
-		Del:              getNullInt64(payload, "del"),
-		IsModern:         getNullInt64(payload, "isModern"),
-		ServerVersion:    getNullInt64(payload, "serverVersion"),
-		IsPendingEnqueue: getNullInt64(payload, "isPendingEnqueue"),
-		IsPendingApply:   getNullInt64(payload, "isPendingApply"),
+	query := `SELECT knownStatus, tracked
+FROM WordList
+WHERE del = 0 AND dictForm = ? AND COALESCE(secondary, '') = ? AND partOfSpeech = ? AND language = ?;`
+
+	var unconfirmed []string
+	for _, record := range records {
+		dictForm, secondary, partOfSpeech, language, err := requireRecordKeys(record)
+		if err != nil {
+			return err
+		}
+		raw, err := runReadRow(ctx, client, query, dictForm, secondary, partOfSpeech, language)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to read back %s: %w", dictForm, err)
+		}
+		row := normalizeRow(raw)
+		if err != nil ||
+			(update.KnownStatus != nil && getNullString(row, "knownStatus").String != *update.KnownStatus) ||
+			(update.Tracked != nil && getNullBool(row, "tracked").Bool != *update.Tracked) {
+			unconfirmed = append(unconfirmed, dictForm)
+		}
 	}
 
-	return record, payload, nil
+	if len(unconfirmed) > 0 {
+		return fmt.Errorf("%w: %s", ErrSyncNotConfirmed, strings.Join(unconfirmed, ", "))
+	}
+	return nil
+}
+
+// wordLookup is the WordList row resolved for one requested item, or the
+// reason it couldn't be resolved.
+type wordLookup struct {
+	record  wordRecord
+	payload map[string]any
+	err     error
 }
 
-func normalizeRow(raw map[string]any) map[string]any {
-	result := make(map[string]any, len(raw))
-	for key, value := range raw {
-		if value == nil {
+// lookupBatchSize caps the dictForms bound in one lookup query, keeping large
+// imports well under SQLite's parameter limit.
+const lookupBatchSize = 500
+
+// lookupWordRecords resolves all items with one query per lookupBatchSize
+// distinct dictForms. A given secondary must match exactly. Without one the
+// entry with an empty secondary wins; failing that, a dictForm that matches
+// exactly one entry is used whatever its secondary, and several matches
+// yield ErrAmbiguousWord listing the candidates. Per-item failures are set
+// on the lookup; the returned error is only for a failed query.
+func lookupWordRecords(
+	ctx context.Context,
+	client *MigakuClient,
+	items []WordStatusItem,
+	language string,
+) ([]wordLookup, error) {
+	dictForms := make([]string, 0, len(items))
+	seen := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		if _, ok := seen[item.WordText]; ok {
 			continue
 		}
-		switch v := value.(type) {
-		case []byte:
-			result[key] = string(v)
-		case int64:
-			result[key] = coerceInt64Value(key, v)
-		case int:
-			result[key] = coerceInt64Value(key, int64(v))
-		case float64:
-			result[key] = coerceInt64Value(key, int64(v))
-		default:
-			result[key] = v
+		seen[item.WordText] = struct{}{}
+		dictForms = append(dictForms, item.WordText)
+	}
+
+	rowsByDictForm := make(map[string][]map[string]any, len(dictForms))
+	for chunk := range slices.Chunk(dictForms, lookupBatchSize) {
+		query := `SELECT dictForm, secondary, partOfSpeech, language, serverMod, knownStatus, hasCard, tracked,
+created, del, isModern, serverVersion, isPendingEnqueue, isPendingApply
+FROM WordList
+WHERE del = 0 AND dictForm IN (?` + strings.Repeat(", ?", len(chunk)-1) + ")"
+		params := make([]any, 0, len(chunk)+1)
+		for _, dictForm := range chunk {
+			params = append(params, dictForm)
+		}
+		if strings.TrimSpace(language) != "" {
+			query += languageFilterClause
+			params = append(params, language)
+		}
+
+		raws, err := runReadRows(ctx, client, query+";", params...)
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range raws {
+			payload := normalizeRow(raw)
+			dictForm := getNullString(payload, "dictForm").String
+			rowsByDictForm[dictForm] = append(rowsByDictForm[dictForm], payload)
 		}
 	}
-	return result
-}
 
-func coerceInt64Value(key string, value int64) any {
-	switch key {
-	case "hasCard", "tracked", "isModern", "isPendingEnqueue", "isPendingApply":
-		return value != 0
-	default:
-		return value
+	lookups := make([]wordLookup, len(items))
+	for i, item := range items {
+		payload, err := resolveWordRow(rowsByDictForm[item.WordText], item, language)
+		if err != nil {
+			lookups[i].err = err
+			continue
+		}
+		// Callers fill the payload in for the push, so duplicate items
+		// mustn't share one map.
+		payload = maps.Clone(payload)
+		lookups[i] = wordLookup{record: wordRecordFromPayload(payload), payload: payload}
 	}
+	return lookups, nil
 }
 
-func getNullString(row map[string]any, key string) sql.NullString {
-	value, ok := row[key]
-	if !ok || value == nil {
-		return sql.NullString{}
+// resolveWordRow picks the row for item among the rows sharing its dictForm.
+func resolveWordRow(rows []map[string]any, item WordStatusItem, language string) (map[string]any, error) {
+	secondaryOf := func(row map[string]any) string {
+		return getNullString(row, "secondary").String
 	}
-	if v, ok := value.(string); ok {
-		return sql.NullString{String: v, Valid: true}
+
+	if item.Secondary != "" {
+		for _, row := range rows {
+			if secondaryOf(row) == item.Secondary {
+				return row, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrWordNotFound, item.WordText)
 	}
-	return sql.NullString{String: fmt.Sprint(value), Valid: true}
-}
 
-func getNullInt64(row map[string]any, key string) sql.NullInt64 {
-	value, ok := row[key]
-	if !ok || value == nil {
-		return sql.NullInt64{}
-	}
-	switch v := value.(type) {
-	case int64:
-		return sql.NullInt64{Int64: v, Valid: true}
-	case int:
-		return sql.NullInt64{Int64: int64(v), Valid: true}
-	case float64:
-		return sql.NullInt64{Int64: int64(v), Valid: true}
-	default:
-		return sql.NullInt64{}
+	for _, row := range rows {
+		if secondaryOf(row) == "" {
+			return row, nil
+		}
+	}
+
+	type candidate struct {
+		secondary string
+		language  string
+	}
+	var candidates []candidate
+	firstRow := make(map[candidate]map[string]any)
+	for _, row := range rows {
+		c := candidate{secondary: secondaryOf(row), language: getNullString(row, "language").String}
+		if _, ok := firstRow[c]; ok {
+			continue
+		}
+		firstRow[c] = row
+		candidates = append(candidates, c)
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", ErrWordNotFound, item.WordText)
+	case 1:
+		return firstRow[candidates[0]], nil
+	}
+
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		return cmp.Or(cmp.Compare(a.language, b.language), cmp.Compare(a.secondary, b.secondary))
+	})
+	names := make([]string, len(candidates))
+	for i, c := range candidates {
+		names[i] = c.secondary
+		if strings.TrimSpace(language) == "" {
+			names[i] += " (" + c.language + ")"
+		}
 	}
+	return nil, fmt.Errorf("%w: %s has candidates %s", ErrAmbiguousWord, item.WordText, strings.Join(names, ", "))
 }
 
-func getNullBool(row map[string]any, key string) sql.NullBool {
-	value, ok := row[key]
-	if !ok || value == nil {
-		return sql.NullBool{}
-	}
-	switch v := value.(type) {
-	case bool:
-		return sql.NullBool{Bool: v, Valid: true}
-	case int64:
-		return sql.NullBool{Bool: v != 0, Valid: true}
-	case int:
-		return sql.NullBool{Bool: v != 0, Valid: true}
-	case float64:
-		return sql.NullBool{Bool: v != 0, Valid: true}
-	case string:
-		return sql.NullBool{Bool: v == "1" || strings.EqualFold(v, "true"), Valid: true}
-	default:
-		return sql.NullBool{}
+func wordRecordFromPayload(payload map[string]any) wordRecord {
+	return wordRecord{
+		DictForm:         getNullString(payload, "dictForm"),
+		Secondary:        getNullString(payload, "secondary"),
+		PartOfSpeech:     getNullString(payload, "partOfSpeech"),
+		Language:         getNullString(payload, "language"),
+		ServerMod:        getNullInt64(payload, "serverMod"),
+		KnownStatus:      getNullString(payload, "knownStatus"),
+		HasCard:          getNullBool(payload, "hasCard"),
+		Tracked:          getNullBool(payload, "tracked"),
+		Created:          getNullInt64(payload, "created"),
+		Del:              getNullInt64(payload, "del"),
+		IsModern:         getNullInt64(payload, "isModern"),
+		ServerVersion:    getNullInt64(payload, "serverVersion"),
+		IsPendingEnqueue: getNullInt64(payload, "isPendingEnqueue"),
+		IsPendingApply:   getNullInt64(payload, "isPendingApply"),
 	}
 }
 
@@ -317,10 +578,23 @@ func updateLocalWordStatus(
 		return nil
 	}
 
+	// The push has already been accepted, so the row mirrors what the server
+	// now holds: serverMod matches the pushed mod and nothing is pending.
+	// Without this a re-edit before the next refresh would send a stale
+	// serverMod. A field the update leaves alone is bound as NULL and keeps
+	// its value.
 	query := `UPDATE WordList
-SET knownStatus = ?, tracked = ?, mod = ?
+SET knownStatus = COALESCE(?, knownStatus), tracked = COALESCE(?, tracked), mod = ?, serverMod = ?, isPendingEnqueue = 0, isPendingApply = 0
 WHERE dictForm = ? AND secondary = ? AND partOfSpeech = ? AND language = ?;`
 
+	var knownStatus, tracked any
+	if update.KnownStatus != nil {
+		knownStatus = *update.KnownStatus
+	}
+	if update.Tracked != nil {
+		tracked = *update.Tracked
+	}
+
 	for _, record := range records {
 		dictForm, secondary, partOfSpeech, language, err := requireRecordKeys(record)
 		if err != nil {
@@ -330,8 +604,9 @@ WHERE dictForm = ? AND secondary = ? AND partOfSpeech = ? AND language = ?;`
 			ctx,
 			client,
 			query,
-			update.KnownStatus,
-			update.Tracked,
+			knownStatus,
+			tracked,
+			modTimestamp,
 			modTimestamp,
 			dictForm,
 			secondary,
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+// newSyncingClient returns a fixture client on fake's session that refreshes
+// its snapshot every hour, and a service whose cache expires at once.
+func newSyncingClient(t *testing.T, fake *fakeMigaku, extra ...string) (*MigakuClient, *MigakuService) {
+	t.Helper()
+	client := newTestClient(t, extra...)
+	client.session = fake.session()
+	client.refreshTTL = time.Hour
+	return client, NewMigakuService(NewRepository(), NewCache(time.Millisecond))
+}
+
+func TestSetWordStatusWarmSnapshotSkipsDownload(t *testing.T) {
+	fake := newFakeMigaku(t)
+	client, svc := newSyncingClient(t, fake)
+
+	if err := svc.SetWordStatus(context.Background(), client, "水", "", "known", "ja", WordStatusOptions{}); err != nil {
+		t.Fatalf("SetWordStatus: %v", err)
+	}
+	if urlFetches, downloads, _ := fake.counts(); urlFetches != 0 || downloads != 0 {
+		t.Errorf("write on a warm snapshot made %d URL fetches and %d downloads, want none", urlFetches, downloads)
+	}
+	if pushes := fake.recordedPushes(); len(pushes) != 1 {
+		t.Errorf("%d pushes, want 1", len(pushes))
+	}
+}
+
+func TestSetWordStatusStaleSnapshotDownloads(t *testing.T) {
+	fake := newFakeMigaku(t)
+	snapshot, err := os.ReadFile(newFixtureDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.snapshot = gzipBytes(t, snapshot)
+	client, svc := newSyncingClient(t, fake)
+	client.mu.Lock()
+	client.lastRefresh = time.Now().Add(-2 * time.Hour)
+	client.mu.Unlock()
+
+	if err := svc.SetWordStatus(context.Background(), client, "水", "", "known", "ja", WordStatusOptions{}); err != nil {
+		t.Fatalf("SetWordStatus: %v", err)
+	}
+	if _, downloads, _ := fake.counts(); downloads != 1 {
+		t.Errorf("write on a stale snapshot made %d downloads, want 1", downloads)
+	}
+	if pushes := fake.recordedPushes(); len(pushes) != 1 {
+		t.Errorf("%d pushes, want 1", len(pushes))
+	}
+}
+
+// pushedWords decodes the words section of every push fake received.
+func pushedWords(t *testing.T, fake *fakeMigaku) []map[string]any {
+	t.Helper()
+	var words []map[string]any
+	for _, push := range fake.recordedPushes() {
+		var payload struct {
+			Words []map[string]any `json:"words"`
+		}
+		if err := json.Unmarshal(push.body, &payload); err != nil {
+			t.Fatalf("decode push %s: %v", push.body, err)
+		}
+		words = append(words, payload.Words...)
+	}
+	return words
+}
+
+// localWord reads the fields of dictForm's WordList row that a push changes.
+type localWord struct {
+	KnownStatus      string `db:"knownStatus"`
+	Tracked          bool   `db:"tracked"`
+	Mod              int64  `db:"mod"`
+	ServerMod        int64  `db:"serverMod"`
+	IsPendingEnqueue int64  `db:"isPendingEnqueue"`
+	IsPendingApply   int64  `db:"isPendingApply"`
+}
+
+func readLocalWord(t *testing.T, client *MigakuClient, dictForm string) localWord {
+	t.Helper()
+	rows, err := runReadQuery[localWord](context.Background(), client,
+		`SELECT knownStatus, tracked, mod, serverMod, isPendingEnqueue, isPendingApply FROM WordList WHERE dictForm = ?`, dictForm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("%d rows for %s, want 1", len(rows), dictForm)
+	}
+	return rows[0]
+}
+
+func TestSetWordStatusLocalRowMatchesPush(t *testing.T) {
+	fake := newFakeMigaku(t)
+	client, svc := newSyncingClient(t, fake,
+		`UPDATE WordList SET isPendingEnqueue = 1, isPendingApply = 1, serverMod = 5 WHERE dictForm = '水'`)
+	ctx := context.Background()
+
+	if err := svc.SetWordStatus(ctx, client, "水", "", "tracked", "ja", WordStatusOptions{}); err != nil {
+		t.Fatalf("SetWordStatus: %v", err)
+	}
+	words := pushedWords(t, fake)
+	if len(words) != 1 {
+		t.Fatalf("%d words pushed, want 1", len(words))
+	}
+	pushed := words[0]
+	if pushed["serverMod"] != float64(5) {
+		t.Errorf("pushed serverMod = %v, want the local 5", pushed["serverMod"])
+	}
+
+	got := readLocalWord(t, client, "水")
+	want := localWord{
+		KnownStatus: pushed["knownStatus"].(string),
+		Tracked:     pushed["tracked"].(bool),
+		Mod:         int64(pushed["mod"].(float64)),
+		ServerMod:   int64(pushed["mod"].(float64)),
+	}
+	if got != want {
+		t.Errorf("local row after the push = %+v, want %+v", got, want)
+	}
+	if want.KnownStatus != dbStatusUnknown || !want.Tracked {
+		t.Errorf("pushed knownStatus %s, tracked %v; want UNKNOWN and tracked", want.KnownStatus, want.Tracked)
+	}
+
+	// A second edit before any refresh carries the first push's mod as its
+	// serverMod.
+	if err := svc.SetWordStatus(ctx, client, "水", "", "known", "ja", WordStatusOptions{}); err != nil {
+		t.Fatalf("second SetWordStatus: %v", err)
+	}
+	words = pushedWords(t, fake)
+	if len(words) != 2 {
+		t.Fatalf("%d words pushed, want 2", len(words))
+	}
+	if words[1]["serverMod"] != pushed["mod"] {
+		t.Errorf("second push serverMod = %v, want the first push's mod %v", words[1]["serverMod"], pushed["mod"])
+	}
+	if got := readLocalWord(t, client, "水"); got.KnownStatus != dbStatusKnown || got.Tracked || got.ServerMod != int64(words[1]["mod"].(float64)) {
+		t.Errorf("local row after the second push = %+v, want KNOWN, untracked, serverMod %v", got, words[1]["mod"])
+	}
+}